@@ -0,0 +1,122 @@
+package apihelper
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/json-iterator/go"
+	"gitlab.com/Cacophony/dhelpers"
+)
+
+// defaultJobHistoryLimit is the number of runs returned per Job, if no limit is requested
+const defaultJobHistoryLimit = 10
+
+// JobInformation contains information about one Job at a Worker, including its last runs
+type JobInformation struct {
+	WorkerJobInformation
+	History []dhelpers.JobRun
+}
+
+// JobsHandler returns a handler for the jobs of a Scheduler, to be mounted at /jobs
+// GET /jobs?history=10 lists all jobs including their last runs
+// POST /jobs/trigger?name=, /jobs/pause?name=, /jobs/resume?name= control a job on all instances
+// use it behind the middleware.Service and middleware.Recoverer middlewares
+func JobsHandler(scheduler *dhelpers.Scheduler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", ListJobsHandler(scheduler))
+	mux.HandleFunc("/jobs/trigger", JobControlHandler(scheduler, dhelpers.JobControlTrigger))
+	mux.HandleFunc("/jobs/pause", JobControlHandler(scheduler, dhelpers.JobControlPause))
+	mux.HandleFunc("/jobs/resume", JobControlHandler(scheduler, dhelpers.JobControlResume))
+	return mux
+}
+
+// ListJobsHandler lists all jobs of a Scheduler including their last runs
+// the number of runs can be set using the history query parameter
+func ListJobsHandler(scheduler *dhelpers.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := int64(defaultJobHistoryLimit)
+		if r.URL.Query().Get("history") != "" {
+			var err error
+			limit, err = strconv.ParseInt(r.URL.Query().Get("history"), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid history limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var jobs []JobInformation
+		for _, entry := range GenerateWorkerJobInformation(scheduler) {
+			history, err := dhelpers.GetJobHistory(entry.Function, limit)
+			dhelpers.CheckErr(err)
+
+			jobs = append(jobs, JobInformation{
+				WorkerJobInformation: entry,
+				History:              history,
+			})
+		}
+
+		writeJSON(w, http.StatusOK, jobs)
+	}
+}
+
+// JobControlHandler triggers, pauses, or resumes the job given in the name query parameter on all instances
+func JobControlHandler(scheduler *dhelpers.Scheduler, action dhelpers.JobControlAction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		if !hasJob(scheduler, name) {
+			http.Error(w, dhelpers.ErrJobNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		var err error
+		switch action {
+		case dhelpers.JobControlTrigger:
+			err = dhelpers.TriggerJob(name)
+		case dhelpers.JobControlPause:
+			err = dhelpers.PauseJob(name)
+		case dhelpers.JobControlResume:
+			err = dhelpers.ResumeJob(name)
+		default:
+			http.Error(w, "invalid job control action", http.StatusBadRequest)
+			return
+		}
+		dhelpers.CheckErr(err)
+
+		writeJSON(w, http.StatusAccepted, map[string]string{
+			"Job":    name,
+			"Action": string(action),
+		})
+	}
+}
+
+func hasJob(scheduler *dhelpers.Scheduler, name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, status := range scheduler.Status() {
+		if status.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	body, err := jsoniter.Marshal(data)
+	dhelpers.CheckErr(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body) // nolint: errcheck
+}
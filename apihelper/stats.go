@@ -17,9 +17,14 @@ import (
 
 // WorkerJobInformation contains information about one Job at a Worker
 type WorkerJobInformation struct {
-	Function string
-	Next     time.Time
-	Prev     time.Time
+	Function     string
+	Next         time.Time
+	Prev         time.Time
+	Running      bool
+	Paused       bool
+	LastDuration time.Duration
+	LastOutcome  string
+	LastError    string
 }
 
 // GatewayEventInformation contains information about the events received by a Gateway
@@ -109,6 +114,23 @@ func GenerateServiceInformation() (information ServiceInformation) {
 	return information
 }
 
+// GenerateWorkerJobInformation generates information about all Jobs of a Scheduler
+func GenerateWorkerJobInformation(scheduler *dhelpers.Scheduler) (entries []WorkerJobInformation) {
+	for _, status := range scheduler.Status() {
+		entries = append(entries, WorkerJobInformation{
+			Function:     status.Name,
+			Next:         status.Next,
+			Prev:         status.LastRun,
+			Running:      status.Running,
+			Paused:       status.Paused,
+			LastDuration: status.LastDuration,
+			LastOutcome:  string(status.LastOutcome),
+			LastError:    status.LastError,
+		})
+	}
+	return entries
+}
+
 // ReadWorkerStatus returns information about all workers
 // the addresses are read from WORKER_ADDRESSES, split using commas
 func ReadWorkerStatus() (stats map[string]WorkerStatus) {
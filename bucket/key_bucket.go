@@ -1,8 +1,10 @@
 package bucket
 
 import (
+	"container/list"
 	"context"
 	"math"
+	"time"
 
 	"sync"
 
@@ -10,53 +12,186 @@ import (
 )
 
 // KeyBucket is a ratelimit bucket with keys
+// limiters of keys which have not been used for IdleTimeout are evicted, so the bucket does not grow forever
 type KeyBucket struct {
 	rate  rate.Limit
 	burst int
 
-	limiters map[string]*rate.Limiter
+	// IdleTimeout is the duration after which the limiter of an unused key is evicted, default 10 minutes
+	// limiters are only evicted once they are full again, so an idle eviction never allows additional events
+	IdleTimeout time.Duration
+	// MaxKeys is the maximum number of limiters kept, the least recently used limiters are evicted first
+	// evicting a limiter which is not full again resets it, default 0, which does not limit the number of limiters
+	MaxKeys int
+
+	limiters  map[string]*list.Element
+	lru       *list.List // the most recently used limiter is at the front
+	overrides map[string]keyRate
 	sync.RWMutex
 }
 
+// keyLimiter is an entry of the KeyBucket LRU list
+type keyLimiter struct {
+	key      string
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// keyRate is the rate of a single key, overriding the rate of the KeyBucket
+type keyRate struct {
+	rate  rate.Limit
+	burst int
+}
+
 // NewKeyBucket creates a bucket with the following conditions:
 // initially full, refilled at limit tokens per second (limit events per seconds)
 func NewKeyBucket(perSecond float64) *KeyBucket {
 	return &KeyBucket{
-		rate:     rate.Limit(perSecond),     // limit
-		burst:    int(math.Ceil(perSecond)), // set burst to (ceil value of) the rate, allow maximum bursts
-		limiters: make(map[string]*rate.Limiter),
+		rate:        rate.Limit(perSecond),     // limit
+		burst:       int(math.Ceil(perSecond)), // set burst to (ceil value of) the rate, allow maximum bursts
+		IdleTimeout: 10 * time.Minute,
+		limiters:    make(map[string]*list.Element),
+		lru:         list.New(),
+		overrides:   make(map[string]keyRate),
 	}
 }
 
 // Allow returns true when the event may happen now
 func (b *KeyBucket) Allow(key string) bool {
+	return b.limiter(key).Allow()
+}
+
+// Wait blocks until event may happen, returns true when the event may happen
+// returns false if the context is cancelled or the deadline is exceeded
+func (b *KeyBucket) Wait(ctx context.Context, key string) bool {
+	// the bucket is not locked while waiting, waiting for one key does not block other keys
+	return b.limiter(key).Wait(ctx) == nil
+}
+
+// Reserve takes a token for the key, returns the duration the caller has to wait before the event may happen
+// the token is taken even if the delay is above zero, returns false if the event can never happen
+func (b *KeyBucket) Reserve(key string) (delay time.Duration, ok bool) {
+	reservation := b.limiter(key).Reserve()
+	if !reservation.OK() {
+		return 0, false
+	}
+	return reservation.Delay(), true
+}
+
+// Tokens returns the number of tokens currently available for the key, can be used for cooldown messages
+// the value is negative if events have been reserved in the future
+func (b *KeyBucket) Tokens(key string) float64 {
 	b.Lock()
 	defer b.Unlock()
 
-	// reuse existing bucket if possible
-	_, ok := b.limiters[key]
-	if ok && b.limiters[key] != nil {
-		return b.limiters[key].Allow()
+	if element, ok := b.limiters[key]; ok {
+		return element.Value.(*keyLimiter).limiter.TokensAt(time.Now())
 	}
 
-	// create new bucket
-	b.limiters[key] = rate.NewLimiter(b.rate, b.burst)
-	return b.limiters[key].Allow()
+	// unknown keys have a full bucket, no need to create a limiter
+	_, burst := b.rateFor(key)
+	return float64(burst)
 }
 
-// Wait blocks until event may happen, returns true when the event may happen
-// returns false if the context is cancelled or the deadline is exceeded
-func (b *KeyBucket) Wait(ctx context.Context, key string) bool {
+// SetKeyRate overrides the rate of a single key, for example to give premium guilds a higher limit
+// the override is kept until it is removed using ResetKeyRate
+func (b *KeyBucket) SetKeyRate(key string, perSecond float64) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.overrides[key] = keyRate{
+		rate:  rate.Limit(perSecond),
+		burst: int(math.Ceil(perSecond)),
+	}
+	b.updateLimiter(key)
+}
+
+// ResetKeyRate removes the rate override of a single key, the key uses the rate of the bucket again
+func (b *KeyBucket) ResetKeyRate(key string) {
 	b.Lock()
 	defer b.Unlock()
 
-	// reuse existing bucket if possible
-	_, ok := b.limiters[key]
-	if ok && b.limiters[key] != nil {
-		return b.limiters[key].Wait(ctx) == nil
+	delete(b.overrides, key)
+	b.updateLimiter(key)
+}
+
+// limiter returns the limiter for the key, creates a new limiter if required
+func (b *KeyBucket) limiter(key string) *rate.Limiter {
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	b.evictIdle(now)
+
+	// reuse existing limiter if possible
+	if element, ok := b.limiters[key]; ok {
+		entry := element.Value.(*keyLimiter)
+		entry.lastUsed = now
+		b.lru.MoveToFront(element)
+		return entry.limiter
+	}
+
+	// create new limiter
+	limit, burst := b.rateFor(key)
+	entry := &keyLimiter{
+		key:      key,
+		limiter:  rate.NewLimiter(limit, burst),
+		lastUsed: now,
+	}
+	b.limiters[key] = b.lru.PushFront(entry)
+
+	// evict least recently used limiters
+	for b.MaxKeys > 0 && b.lru.Len() > b.MaxKeys {
+		b.remove(b.lru.Back())
+	}
+
+	return entry.limiter
+}
+
+// evictIdle removes limiters which have been unused for IdleTimeout and are full again
+// the list is sorted by last usage, so only idle limiters are visited
+func (b *KeyBucket) evictIdle(now time.Time) {
+	if b.IdleTimeout <= 0 {
+		return
+	}
+
+	element := b.lru.Back()
+	for element != nil {
+		entry := element.Value.(*keyLimiter)
+		if now.Sub(entry.lastUsed) < b.IdleTimeout {
+			return
+		}
+
+		previous := element.Prev()
+		if entry.limiter.TokensAt(now) >= float64(entry.limiter.Burst()) {
+			b.remove(element)
+		}
+		element = previous
+	}
+}
+
+func (b *KeyBucket) remove(element *list.Element) {
+	delete(b.limiters, element.Value.(*keyLimiter).key)
+	b.lru.Remove(element)
+}
+
+// rateFor returns the rate and burst for the key, respects overrides
+func (b *KeyBucket) rateFor(key string) (limit rate.Limit, burst int) {
+	if override, ok := b.overrides[key]; ok {
+		return override.rate, override.burst
+	}
+	return b.rate, b.burst
+}
+
+// updateLimiter applies the current rate to an existing limiter of the key
+func (b *KeyBucket) updateLimiter(key string) {
+	element, ok := b.limiters[key]
+	if !ok {
+		return
 	}
 
-	// create new bucket
-	b.limiters[key] = rate.NewLimiter(b.rate, b.burst)
-	return b.limiters[key].Wait(ctx) == nil
+	limit, burst := b.rateFor(key)
+	limiter := element.Value.(*keyLimiter).limiter
+	limiter.SetLimit(limit)
+	limiter.SetBurst(burst)
 }
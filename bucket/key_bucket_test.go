@@ -2,6 +2,7 @@ package bucket
 
 import (
 	"context"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -69,3 +70,122 @@ func TestKeyBucket_Wait(t *testing.T) {
 		t.Error("expected wait time for third call to be above 0.5 seconds")
 	}
 }
+
+func TestKeyBucket_Reserve(t *testing.T) {
+	t.Parallel()
+
+	bucket := NewKeyBucket(2)
+
+	for i := 0; i < 2; i++ {
+		delay, ok := bucket.Reserve("foo")
+		if !ok || delay > 0 {
+			t.Error("expected bucket.Reserve() to return no delay, got ", delay)
+		}
+	}
+
+	delay, ok := bucket.Reserve("foo")
+	if !ok {
+		t.Error("expected bucket.Reserve() to be ok, was not ok")
+	}
+	if delay < 400*time.Millisecond || delay > 500*time.Millisecond {
+		t.Error("expected bucket.Reserve() to return a delay of about 0.5 seconds, got ", delay)
+	}
+}
+
+func TestKeyBucket_Tokens(t *testing.T) {
+	t.Parallel()
+
+	bucket := NewKeyBucket(3)
+
+	if tokens := bucket.Tokens("foo"); tokens != 3 {
+		t.Error("expected 3 tokens for an unknown key, got ", tokens)
+	}
+	if len(bucket.limiters) != 0 {
+		t.Error("expected bucket.Tokens() to not create a limiter, got ", len(bucket.limiters))
+	}
+
+	bucket.Allow("foo")
+	bucket.Allow("foo")
+
+	if tokens := bucket.Tokens("foo"); tokens < 1 || tokens >= 1.5 {
+		t.Error("expected about 1 token, got ", tokens)
+	}
+}
+
+func TestKeyBucket_SetKeyRate(t *testing.T) {
+	t.Parallel()
+
+	bucket := NewKeyBucket(1)
+	bucket.SetKeyRate("premium", 5)
+
+	for i := 0; i < 5; i++ {
+		if !bucket.Allow("premium") {
+			t.Error("expected bucket.Allow() to be true for an overridden key, was false")
+		}
+	}
+	if bucket.Allow("premium") {
+		t.Error("expected bucket.Allow() to be false, was true")
+	}
+
+	bucket.SetKeyRate("reset", 5)
+	bucket.ResetKeyRate("reset")
+
+	if !bucket.Allow("reset") {
+		t.Error("expected bucket.Allow() to be true, was false")
+	}
+	if bucket.Allow("reset") {
+		t.Error("expected bucket.Allow() to be false after resetting the key rate, was true")
+	}
+}
+
+func TestKeyBucket_MaxKeys(t *testing.T) {
+	t.Parallel()
+
+	bucket := NewKeyBucket(1)
+	bucket.MaxKeys = 100
+
+	for i := 0; i < 10000; i++ {
+		bucket.Allow(strconv.Itoa(i))
+	}
+
+	if len(bucket.limiters) != 100 || bucket.lru.Len() != 100 {
+		t.Error("expected 100 limiters, got ", len(bucket.limiters), bucket.lru.Len())
+	}
+
+	// the most recently used keys are kept
+	if bucket.Allow("9999") {
+		t.Error("expected bucket.Allow() to be false for a recently used key, was true")
+	}
+	if !bucket.Allow("0") {
+		t.Error("expected bucket.Allow() to be true for an evicted key, was false")
+	}
+}
+
+func TestKeyBucket_IdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	bucket := NewKeyBucket(20)
+	bucket.IdleTimeout = 100 * time.Millisecond
+
+	for i := 0; i < 1000; i++ {
+		bucket.Allow(strconv.Itoa(i))
+	}
+
+	// drain a slow key, it must not be evicted until it is full again
+	bucket.SetKeyRate("slow", 1)
+	bucket.Allow("slow")
+
+	time.Sleep(200 * time.Millisecond)
+
+	bucket.Allow("new")
+
+	if _, ok := bucket.limiters["slow"]; !ok {
+		t.Error("expected limiter which is not full again to be kept")
+	}
+	if len(bucket.limiters) != 2 || bucket.lru.Len() != 2 {
+		t.Error("expected idle limiters to be evicted, got ", len(bucket.limiters), bucket.lru.Len())
+	}
+	if bucket.Allow("slow") {
+		t.Error("expected bucket.Allow() to be false for a drained key, was true")
+	}
+}
@@ -0,0 +1,28 @@
+package bucket
+
+import "context"
+
+// Limiter is a ratelimit bucket, implemented by Bucket and RedisBucket
+type Limiter interface {
+	// Allow returns true when the event may happen now
+	Allow() bool
+	// Wait blocks until event may happen, returns true when the event may happen
+	// returns false if the context is cancelled or the deadline is exceeded
+	Wait(ctx context.Context) bool
+}
+
+// KeyLimiter is a ratelimit bucket with keys, implemented by KeyBucket and RedisKeyBucket
+type KeyLimiter interface {
+	// Allow returns true when the event may happen now
+	Allow(key string) bool
+	// Wait blocks until event may happen, returns true when the event may happen
+	// returns false if the context is cancelled or the deadline is exceeded
+	Wait(ctx context.Context, key string) bool
+}
+
+var (
+	_ Limiter    = &Bucket{}
+	_ Limiter    = &RedisBucket{}
+	_ KeyLimiter = &KeyBucket{}
+	_ KeyLimiter = &RedisKeyBucket{}
+)
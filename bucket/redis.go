@@ -0,0 +1,240 @@
+package bucket
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// gcraScript implements the generic cell rate algorithm
+// KEYS[1]: the key of the bucket
+// ARGV[1]: the emission interval in milliseconds, 1000 / rate
+// ARGV[2]: the burst
+// ARGV[3]: the number of tokens to take
+// returns {1, 0} if the tokens have been taken, or {0, retry after in milliseconds}
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local tokens = tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + tonumber(time[2]) / 1000
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local newTat = tat + interval * tokens
+local allowAt = newTat - interval * burst
+if allowAt > now then
+	return {0, math.ceil(allowAt - now)}
+end
+
+redis.call('SET', KEYS[1], tostring(newTat), 'PX', math.ceil(newTat - now) + 1)
+return {1, 0}
+`)
+
+// reservationSweepInterval is the interval in which expired reservations are removed
+const reservationSweepInterval = 1 * time.Minute
+
+// reservation are tokens taken from redis, which can be used locally
+type reservation struct {
+	tokens    int
+	expiresAt time.Time
+}
+
+// redisLimiter contains the logic shared by RedisBucket and RedisKeyBucket
+type redisLimiter struct {
+	client   *redis.Client
+	prefix   string
+	interval float64 // the emission interval in milliseconds
+	burst    int
+
+	// Batch is the number of tokens reserved at once, reserved tokens are used locally first
+	// reserved tokens expire after the time it takes to refill them, to not starve other processes
+	// default 1, which does not reserve tokens locally
+	Batch int
+
+	// fallback is used if redis is unavailable
+	fallback *KeyBucket
+
+	reservations      map[string]*reservation
+	reservationsSwept time.Time // the last time expired reservations have been removed
+	reservationsMutex sync.Mutex
+}
+
+func newRedisLimiter(client *redis.Client, name string, perSecond float64) *redisLimiter {
+	return &redisLimiter{
+		client:       client,
+		prefix:       "project-d:bucket:" + name,
+		interval:     1000 / perSecond,
+		burst:        int(math.Ceil(perSecond)), // set burst to (ceil value of) the rate, allow maximum bursts
+		Batch:        1,
+		fallback:     NewKeyBucket(perSecond),
+		reservations: make(map[string]*reservation),
+	}
+}
+
+// take takes a token for the key, returns the duration to wait before trying again if no token is available
+func (l *redisLimiter) take(key string) (allowed bool, retryAfter time.Duration) {
+	// use locally reserved tokens first
+	if l.Batch > 1 {
+		l.reservationsMutex.Lock()
+		l.sweepReservations(time.Now())
+		if reserved, ok := l.reservations[key]; ok {
+			if reserved.tokens > 0 && time.Now().Before(reserved.expiresAt) {
+				reserved.tokens--
+				if reserved.tokens <= 0 {
+					delete(l.reservations, key)
+				}
+				l.reservationsMutex.Unlock()
+				return true, 0
+			}
+			delete(l.reservations, key)
+		}
+		l.reservationsMutex.Unlock()
+	}
+
+	batch := l.Batch
+	if batch > l.burst {
+		batch = l.burst
+	}
+	if batch < 1 {
+		batch = 1
+	}
+
+	// try to reserve a batch, then a single token
+	for _, tokens := range []int{batch, 1} {
+		allowed, retryAfter, err := l.takeFromRedis(key, tokens)
+		if err != nil {
+			// redis is unavailable, limit per process
+			if l.fallback.Allow(key) {
+				return true, 0
+			}
+			return false, time.Duration(l.interval) * time.Millisecond
+		}
+		if allowed {
+			if tokens > 1 {
+				l.reservationsMutex.Lock()
+				l.reservations[key] = &reservation{
+					tokens:    tokens - 1,
+					expiresAt: time.Now().Add(time.Duration(l.interval*float64(tokens)) * time.Millisecond),
+				}
+				l.reservationsMutex.Unlock()
+			}
+			return true, 0
+		}
+		if tokens == 1 {
+			return false, retryAfter
+		}
+	}
+
+	return false, time.Duration(l.interval) * time.Millisecond
+}
+
+// sweepReservations removes expired reservations, at most once per reservationSweepInterval
+// reservations of keys which are not used again would never be removed otherwise
+// reservationsMutex has to be held
+func (l *redisLimiter) sweepReservations(now time.Time) {
+	if now.Sub(l.reservationsSwept) < reservationSweepInterval {
+		return
+	}
+	l.reservationsSwept = now
+
+	for key, reserved := range l.reservations {
+		if !now.Before(reserved.expiresAt) {
+			delete(l.reservations, key)
+		}
+	}
+}
+
+func (l *redisLimiter) takeFromRedis(key string, tokens int) (allowed bool, retryAfter time.Duration, err error) {
+	result, err := gcraScript.Run(l.client, []string{key}, l.interval, l.burst, tokens).Result()
+	if err != nil {
+		return false, 0, err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) < 2 {
+		return false, 0, redis.Nil
+	}
+	allowedValue, _ := values[0].(int64)
+	retryAfterValue, _ := values[1].(int64)
+
+	return allowedValue == 1, time.Duration(retryAfterValue) * time.Millisecond, nil
+}
+
+// wait blocks until a token for the key can be taken
+func (l *redisLimiter) wait(ctx context.Context, key string) bool {
+	for {
+		allowed, retryAfter := l.take(key)
+		if allowed {
+			return true
+		}
+
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// RedisBucket is a ratelimit bucket shared by all processes using the same name
+type RedisBucket struct {
+	*redisLimiter
+}
+
+// NewRedisBucket creates a bucket shared by all processes using the same name with the following conditions:
+// initially full, refilled at limit tokens per second (limit events per seconds)
+// if redis is unavailable the limit will be applied per process
+func NewRedisBucket(client *redis.Client, name string, perSecond float64) *RedisBucket {
+	return &RedisBucket{
+		redisLimiter: newRedisLimiter(client, name, perSecond),
+	}
+}
+
+// Allow returns true when the event may happen now
+func (b *RedisBucket) Allow() bool {
+	allowed, _ := b.take(b.prefix)
+	return allowed
+}
+
+// Wait blocks until event may happen, returns true when the event may happen
+// returns false if the context is cancelled or the deadline is exceeded
+func (b *RedisBucket) Wait(ctx context.Context) bool {
+	return b.wait(ctx, b.prefix)
+}
+
+// RedisKeyBucket is a ratelimit bucket with keys shared by all processes using the same name
+type RedisKeyBucket struct {
+	*redisLimiter
+}
+
+// NewRedisKeyBucket creates a bucket with keys shared by all processes using the same name with the following conditions:
+// initially full, refilled at limit tokens per second (limit events per seconds)
+// if redis is unavailable the limit will be applied per process
+// example, a command cooldown per user: NewRedisKeyBucket(cache.GetRedisClient(), "command-cooldown", 0.2)
+func NewRedisKeyBucket(client *redis.Client, name string, perSecond float64) *RedisKeyBucket {
+	return &RedisKeyBucket{
+		redisLimiter: newRedisLimiter(client, name, perSecond),
+	}
+}
+
+// Allow returns true when the event may happen now
+func (b *RedisKeyBucket) Allow(key string) bool {
+	allowed, _ := b.take(b.prefix + ":" + key)
+	return allowed
+}
+
+// Wait blocks until event may happen, returns true when the event may happen
+// returns false if the context is cancelled or the deadline is exceeded
+func (b *RedisKeyBucket) Wait(ctx context.Context, key string) bool {
+	return b.wait(ctx, b.prefix+":"+key)
+}
@@ -0,0 +1,155 @@
+package bucket
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+func newTestRedisClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     os.Getenv("REDIS_ADDRESS"),
+		Password: "",
+		DB:       0,
+	})
+}
+
+func TestRedisBucket_Allow(t *testing.T) {
+	name := "test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	// two buckets with the same name simulate two processes
+	bucketA := NewRedisBucket(newTestRedisClient(), name, 2)
+	bucketB := NewRedisBucket(newTestRedisClient(), name, 2)
+
+	if !bucketA.Allow() {
+		t.Error("expected bucketA.Allow() to be true, was false")
+	}
+
+	if !bucketB.Allow() {
+		t.Error("expected bucketB.Allow() to be true, was false")
+	}
+
+	if bucketA.Allow() {
+		t.Error("expected bucketA.Allow() to be false, was true")
+	}
+
+	if bucketB.Allow() {
+		t.Error("expected bucketB.Allow() to be false, was true")
+	}
+
+	time.Sleep(1 * time.Second)
+
+	if !bucketB.Allow() {
+		t.Error("expected bucketB.Allow() to be true, was false")
+	}
+}
+
+func TestRedisBucket_Wait(t *testing.T) {
+	name := "test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	bucket := NewRedisBucket(newTestRedisClient(), name, 2)
+
+	if !bucket.Wait(context.Background()) {
+		t.Error("expected bucket.Wait() to be true, was false")
+	}
+
+	if !bucket.Wait(context.Background()) {
+		t.Error("expected bucket.Wait() to be true, was false")
+	}
+
+	start := time.Now()
+
+	if !bucket.Wait(context.Background()) {
+		t.Error("expected bucket.Wait() to be true, was false")
+	}
+
+	if time.Since(start).Seconds() < 0.45 {
+		t.Error("expected wait time for third call to be above 0.45 seconds")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if bucket.Wait(ctx) {
+		t.Error("expected bucket.Wait() to be false after the deadline, was true")
+	}
+}
+
+func TestRedisBucket_Batch(t *testing.T) {
+	name := "test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	bucketA := NewRedisBucket(newTestRedisClient(), name, 4)
+	bucketA.Batch = 4
+	bucketB := NewRedisBucket(newTestRedisClient(), name, 4)
+
+	// bucketA reserves all tokens at once
+	if !bucketA.Allow() {
+		t.Error("expected bucketA.Allow() to be true, was false")
+	}
+
+	if bucketB.Allow() {
+		t.Error("expected bucketB.Allow() to be false, was true")
+	}
+
+	for i := 0; i < 3; i++ {
+		if !bucketA.Allow() {
+			t.Error("expected bucketA.Allow() to use reserved token, was false")
+		}
+	}
+
+	if bucketA.Allow() {
+		t.Error("expected bucketA.Allow() to be false, was true")
+	}
+}
+
+func TestRedisLimiter_sweepReservations(t *testing.T) {
+	limiter := newRedisLimiter(newTestRedisClient(), "test", 4)
+	now := time.Now()
+	limiter.reservations["expired"] = &reservation{tokens: 3, expiresAt: now.Add(-time.Second)}
+	limiter.reservations["active"] = &reservation{tokens: 3, expiresAt: now.Add(time.Second)}
+
+	limiter.sweepReservations(now)
+	if _, ok := limiter.reservations["expired"]; ok {
+		t.Error("expected expired reservation to be removed")
+	}
+	if _, ok := limiter.reservations["active"]; !ok {
+		t.Error("expected active reservation to be kept")
+	}
+
+	// sweeps at most once per interval
+	limiter.reservations["expired"] = &reservation{tokens: 3, expiresAt: now.Add(-time.Second)}
+	limiter.sweepReservations(now.Add(time.Second))
+	if _, ok := limiter.reservations["expired"]; !ok {
+		t.Error("expected no sweep within the sweep interval")
+	}
+	limiter.sweepReservations(now.Add(reservationSweepInterval))
+	if _, ok := limiter.reservations["expired"]; ok {
+		t.Error("expected expired reservation to be removed after the sweep interval")
+	}
+}
+
+func TestRedisKeyBucket_Allow(t *testing.T) {
+	name := "test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	bucketA := NewRedisKeyBucket(newTestRedisClient(), name, 2)
+	bucketB := NewRedisKeyBucket(newTestRedisClient(), name, 2)
+
+	if !bucketA.Allow("foo") || !bucketB.Allow("foo") {
+		t.Error("expected bucket.Allow(foo) to be true, was false")
+	}
+
+	if bucketA.Allow("foo") {
+		t.Error("expected bucketA.Allow(foo) to be false, was true")
+	}
+
+	if !bucketB.Allow("bar") || !bucketA.Allow("bar") {
+		t.Error("expected bucket.Allow(bar) to be true, was false")
+	}
+
+	if bucketB.Allow("bar") {
+		t.Error("expected bucketB.Allow(bar) to be false, was true")
+	}
+}
@@ -0,0 +1,63 @@
+package catalog
+
+import (
+	"io/ioutil"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// Catalog contains all messages of translation files, by language and message ID
+type Catalog map[language.Tag]map[string]*i18n.Message
+
+// Load parses the given translation files, the language is taken from the filename, example: active.de.toml
+func Load(files ...string) (catalog Catalog, err error) {
+	catalog = make(Catalog)
+	unmarshalFuncs := map[string]i18n.UnmarshalFunc{"toml": toml.Unmarshal}
+
+	for _, file := range files {
+		var data []byte
+		data, err = ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var messageFile *i18n.MessageFile
+		messageFile, err = i18n.ParseMessageFileBytes(data, file, unmarshalFuncs)
+		if err != nil {
+			return nil, err
+		}
+
+		if catalog[messageFile.Tag] == nil {
+			catalog[messageFile.Tag] = make(map[string]*i18n.Message)
+		}
+		for _, message := range messageFile.Messages {
+			catalog[messageFile.Tag][message.ID] = message
+		}
+	}
+
+	return catalog, nil
+}
+
+// Languages returns all languages of the catalog, sorted
+func (c Catalog) Languages() (languages []language.Tag) {
+	for tag := range c {
+		languages = append(languages, tag)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		return languages[i].String() < languages[j].String()
+	})
+	return languages
+}
+
+// contains returns true if any language of the catalog contains the message ID
+func (c Catalog) contains(messageID string) bool {
+	for _, messages := range c {
+		if _, ok := messages[messageID]; ok {
+			return true
+		}
+	}
+	return false
+}
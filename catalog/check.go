@@ -0,0 +1,197 @@
+package catalog
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// pluralForms contains the plural forms required by a language, by base language
+// languages not in the list require one and other
+var pluralForms = map[string][]string{
+	"ja": {"other"},
+	"ko": {"other"},
+	"zh": {"other"},
+	"th": {"other"},
+	"vi": {"other"},
+	"id": {"other"},
+	"tr": {"one", "other"},
+	"fr": {"one", "other"},
+	"pl": {"one", "few", "many", "other"},
+	"ru": {"one", "few", "many", "other"},
+	"uk": {"one", "few", "many", "other"},
+	"cs": {"one", "few", "other"},
+	"ar": {"zero", "one", "two", "few", "many", "other"},
+}
+
+// Issue is a single problem found by Check
+type Issue struct {
+	Language  language.Tag
+	MessageID string
+	Calls     []Call   // the calls using the message ID, empty for unused messages
+	Forms     []string // the missing plural forms, only set for plural incomplete messages
+}
+
+// Report contains all problems found by Check
+type Report struct {
+	Missing          []Issue // messages used in code, but not translated
+	Unused           []Issue // messages translated, but not used in code
+	PluralIncomplete []Issue // plural messages missing a plural form required by the language
+}
+
+// OK returns true if no messages are missing or plural incomplete
+// unused messages are not considered, as message IDs can be built at runtime
+func (r Report) OK() bool {
+	return len(r.Missing) <= 0 && len(r.PluralIncomplete) <= 0
+}
+
+// Write writes a human readable version of the report
+func (r Report) Write(writer io.Writer) (err error) {
+	for _, issue := range r.Missing {
+		_, err = fmt.Fprintf(writer, "missing [%s] %s used at %s\n", issue.Language, issue.MessageID, positions(issue.Calls))
+		if err != nil {
+			return err
+		}
+	}
+	for _, issue := range r.PluralIncomplete {
+		_, err = fmt.Fprintf(writer, "plural incomplete [%s] %s missing %s\n", issue.Language, issue.MessageID, strings.Join(issue.Forms, ", "))
+		if err != nil {
+			return err
+		}
+	}
+	for _, issue := range r.Unused {
+		_, err = fmt.Fprintf(writer, "unused [%s] %s\n", issue.Language, issue.MessageID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check compares the calls found by Scan with the catalog, and reports problems for each language
+// calls with literals which can be raw text are only used if the message ID is part of the catalog in any language
+func Check(calls []Call, catalog Catalog) (report Report) {
+	callsByID := make(map[string][]Call)
+	pluralIDs := make(map[string]bool)
+	for _, call := range calls {
+		if call.RawText && !catalog.contains(call.MessageID) {
+			continue
+		}
+
+		callsByID[call.MessageID] = append(callsByID[call.MessageID], call)
+		if call.Plural {
+			pluralIDs[call.MessageID] = true
+		}
+	}
+
+	messageIDs := make([]string, 0, len(callsByID))
+	for messageID := range callsByID {
+		messageIDs = append(messageIDs, messageID)
+	}
+	sort.Strings(messageIDs)
+
+	for _, tag := range catalog.Languages() {
+		messages := catalog[tag]
+
+		for _, messageID := range messageIDs {
+			if _, ok := messages[messageID]; !ok {
+				report.Missing = append(report.Missing, Issue{
+					Language:  tag,
+					MessageID: messageID,
+					Calls:     callsByID[messageID],
+				})
+			}
+		}
+
+		catalogIDs := make([]string, 0, len(messages))
+		for messageID := range messages {
+			catalogIDs = append(catalogIDs, messageID)
+		}
+		sort.Strings(catalogIDs)
+
+		for _, messageID := range catalogIDs {
+			message := messages[messageID]
+
+			if _, ok := callsByID[messageID]; !ok {
+				report.Unused = append(report.Unused, Issue{
+					Language:  tag,
+					MessageID: messageID,
+				})
+			}
+
+			if !pluralIDs[messageID] && !isPlural(message) {
+				continue
+			}
+			missingForms := missingPluralForms(tag, message)
+			if len(missingForms) > 0 {
+				report.PluralIncomplete = append(report.PluralIncomplete, Issue{
+					Language:  tag,
+					MessageID: messageID,
+					Calls:     callsByID[messageID],
+					Forms:     missingForms,
+				})
+			}
+		}
+	}
+
+	return report
+}
+
+// isPlural returns true if the message contains a plural form other than other
+func isPlural(message *i18n.Message) bool {
+	return message.Zero != "" || message.One != "" || message.Two != "" || message.Few != "" || message.Many != ""
+}
+
+func missingPluralForms(tag language.Tag, message *i18n.Message) (missing []string) {
+	base, _ := tag.Base()
+	forms, ok := pluralForms[base.String()]
+	if !ok {
+		forms = []string{"one", "other"}
+	}
+
+	values := map[string]string{
+		"zero":  message.Zero,
+		"one":   message.One,
+		"two":   message.Two,
+		"few":   message.Few,
+		"many":  message.Many,
+		"other": message.Other,
+	}
+	for _, form := range forms {
+		if values[form] == "" {
+			missing = append(missing, form)
+		}
+	}
+	return missing
+}
+
+func positions(calls []Call) string {
+	result := make([]string, len(calls))
+	for i, call := range calls {
+		result[i] = call.Position.String()
+	}
+	return strings.Join(result, ", ")
+}
+
+// Run scans the directories, loads the translation files, and writes the report
+// returns false if messages are missing or plural incomplete
+// example, in a test: ok, err := catalog.Run(os.Stdout, []string{"."}, []string{"translations/active.en.toml"})
+func Run(writer io.Writer, dirs, files []string) (ok bool, err error) {
+	calls, err := Scan(nil, dirs...)
+	if err != nil {
+		return false, err
+	}
+
+	catalog, err := Load(files...)
+	if err != nil {
+		return false, err
+	}
+
+	report := Check(calls, catalog)
+	err = report.Write(writer)
+	return report.OK(), err
+}
@@ -0,0 +1,69 @@
+package catalog
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestCheck(t *testing.T) {
+	calls, err := Scan(nil, "testdata/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 6 {
+		t.Error("Expected 6 calls, got ", len(calls))
+	}
+
+	catalog, err := Load("testdata/translations/active.en.toml", "testdata/translations/active.de.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Languages()) != 2 {
+		t.Error("Expected 2 languages, got ", len(catalog.Languages()))
+	}
+
+	report := Check(calls, catalog)
+	if report.OK() {
+		t.Error("Expected report to not be OK")
+	}
+
+	// done is raw text, welcome is a message ID as it is part of the catalog
+	if len(report.Missing) != 3 {
+		t.Fatal("Expected 3 missing messages, got ", len(report.Missing))
+	}
+	if report.Missing[0].Language != language.German || report.Missing[0].MessageID != "module.missing" {
+		t.Error("Expected de module.missing, got ", report.Missing[0].Language, report.Missing[0].MessageID)
+	}
+	if report.Missing[1].Language != language.German || report.Missing[1].MessageID != "welcome" {
+		t.Error("Expected de welcome, got ", report.Missing[1].Language, report.Missing[1].MessageID)
+	}
+	if report.Missing[2].Language != language.English || report.Missing[2].MessageID != "module.missing" {
+		t.Error("Expected en module.missing, got ", report.Missing[2].Language, report.Missing[2].MessageID)
+	}
+	if len(report.Missing[2].Calls) != 1 || report.Missing[2].Calls[0].Position.Line != 8 {
+		t.Error("Expected module.missing to be used in line 8, got ", report.Missing[2].Calls)
+	}
+
+	if len(report.Unused) != 1 || report.Unused[0].MessageID != "module.unused" {
+		t.Error("Expected module.unused to be unused, got ", report.Unused)
+	}
+
+	if len(report.PluralIncomplete) != 1 {
+		t.Fatal("Expected 1 plural incomplete message, got ", len(report.PluralIncomplete))
+	}
+	if report.PluralIncomplete[0].MessageID != "module.apples" ||
+		len(report.PluralIncomplete[0].Forms) != 1 || report.PluralIncomplete[0].Forms[0] != "one" {
+		t.Error("Expected module.apples to miss one, got ", report.PluralIncomplete[0])
+	}
+
+	var buf bytes.Buffer
+	err = report.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("missing [en] module.missing used at testdata/src/module.go:8")) {
+		t.Error("Expected report to contain missing module.missing, got ", buf.String())
+	}
+}
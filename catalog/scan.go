@@ -0,0 +1,144 @@
+package catalog
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Function describes a function which receives a message ID
+type Function struct {
+	Argument int  // the position of the message ID argument, starting at 0
+	Plural   bool // true if the function receives a pluralization count
+	RawText  bool // true if the function receives raw text as well, single words are only used as message IDs if they are part of the catalog
+}
+
+// DefaultFunctions contains all translation functions of dhelpers, by function name
+var DefaultFunctions = map[string]Function{
+	"T":                        {Argument: 0},
+	"Tf":                       {Argument: 0},
+	"Tfc":                      {Argument: 0, Plural: true},
+	"SendMessage":              {Argument: 1, RawText: true},
+	"SendMessagef":             {Argument: 1, RawText: true},
+	"SendMessagefc":            {Argument: 1, Plural: true, RawText: true},
+	"SendMessageBoxed":         {Argument: 1, RawText: true},
+	"SendMessageWithBot":       {Argument: 2, RawText: true},
+	"SendMessagefWithBot":      {Argument: 2, RawText: true},
+	"SendMessagefcWithBot":     {Argument: 2, Plural: true, RawText: true},
+	"SendMessageBoxedWithBot":  {Argument: 2, RawText: true},
+	"SendMessageBoxedfWithBot": {Argument: 2, RawText: true},
+	"EditMessage":              {Argument: 2, RawText: true},
+	"EditMessagef":             {Argument: 2, RawText: true},
+	"EditMessagefc":            {Argument: 2, Plural: true, RawText: true},
+	"EditMessageWithBot":       {Argument: 3, RawText: true},
+	"EditMessagefWithBot":      {Argument: 3, RawText: true},
+	"EditMessagefcWithBot":     {Argument: 3, Plural: true, RawText: true},
+}
+
+// messageIDRegex matches literals which look like message IDs, used for functions which only receive message IDs
+var messageIDRegex = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// namespacedMessageIDRegex matches literals which look like namespaced message IDs, like module.hello
+// for functions which receive raw text as well, other literals are only message IDs if they are part of the catalog
+var namespacedMessageIDRegex = regexp.MustCompile(`^[A-Za-z0-9_\-]+(\.[A-Za-z0-9_\-]+)+$`)
+
+// Call is a call of a translation function with a literal message ID
+type Call struct {
+	Position  token.Position
+	Function  string
+	MessageID string
+	Plural    bool
+	RawText   bool // true if the literal can be raw text as well, see Function.RawText
+}
+
+// Scan parses all Go files in the given directories, and their subdirectories, and returns all calls with literal message IDs
+// vendor and testdata directories, and test files are skipped
+// functions	: the functions to look for, DefaultFunctions if nil
+func Scan(functions map[string]Function, dirs ...string) (calls []Call, err error) {
+	if functions == nil {
+		functions = DefaultFunctions
+	}
+
+	fileSet := token.NewFileSet()
+	for _, dir := range dirs {
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if info.Name() == "vendor" || info.Name() == "testdata" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+				return nil
+			}
+
+			file, err := parser.ParseFile(fileSet, path, nil, 0)
+			if err != nil {
+				return err
+			}
+
+			calls = append(calls, scanFile(fileSet, file, functions)...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return calls, nil
+}
+
+func scanFile(fileSet *token.FileSet, file *ast.File, functions map[string]Function) (calls []Call) {
+	ast.Inspect(file, func(node ast.Node) bool {
+		callExpr, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		var name string
+		switch fun := callExpr.Fun.(type) {
+		case *ast.Ident:
+			name = fun.Name
+		case *ast.SelectorExpr:
+			name = fun.Sel.Name
+		default:
+			return true
+		}
+
+		function, ok := functions[name]
+		if !ok || len(callExpr.Args) <= function.Argument {
+			return true
+		}
+
+		literal, ok := callExpr.Args[function.Argument].(*ast.BasicLit)
+		if !ok || literal.Kind != token.STRING {
+			return true
+		}
+		messageID, err := strconv.Unquote(literal.Value)
+		if err != nil {
+			return true
+		}
+		if !messageIDRegex.MatchString(messageID) {
+			return true
+		}
+
+		calls = append(calls, Call{
+			Position:  fileSet.Position(literal.Pos()),
+			Function:  name,
+			MessageID: messageID,
+			Plural:    function.Plural,
+			RawText:   function.RawText && !namespacedMessageIDRegex.MatchString(messageID),
+		})
+		return true
+	})
+
+	return calls
+}
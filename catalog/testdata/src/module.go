@@ -0,0 +1,13 @@
+package module
+
+import "gitlab.com/Cacophony/dhelpers"
+
+func run(event dhelpers.EventContainer, channelID string, count int) {
+	event.SendMessage(channelID, "module.hello")
+	event.SendMessagefc(channelID, "module.apples", count, "count", count)
+	dhelpers.Tf("module.missing", "key", "value")
+	event.SendMessage(channelID, "raw text is not a message ID")
+	event.SendMessage(channelID, dhelpers.T("module.goodbye"))
+	event.SendMessage(channelID, "done")
+	event.SendMessage(channelID, "welcome")
+}
@@ -0,0 +1,34 @@
+// translationcheck reports missing, unused, and plural incomplete translations
+// usage: translationcheck -src ./ -translations "translations/*.toml"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/Cacophony/dhelpers/catalog"
+)
+
+func main() {
+	src := flag.String("src", ".", "comma separated list of directories to scan")
+	translations := flag.String("translations", "*.toml", "glob matching the translation files")
+	flag.Parse()
+
+	files, err := filepath.Glob(*translations)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	ok, err := catalog.Run(os.Stdout, strings.Split(*src, ","), files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
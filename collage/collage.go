@@ -15,6 +15,7 @@ import (
 )
 
 // FromUrls creates a Collage PNG Image from internet image urls (PNG or JPEG).
+// The urls are fetched using a safe client, urls of internal addresses will create an empty space.
 // imageUrls		: a slice with all image URLs. Empty strings will create an empty space in the collage.
 // descriptions		: a slice with text that will be written on each tile. Can be empty.
 // width			: the width of the result collage image.
@@ -28,14 +29,24 @@ func FromUrls(ctx context.Context, imageUrls, descriptions []string, width, heig
 	span, ctx = opentracing.StartSpanFromContext(ctx, "dhelpers.collage.FromUrls")
 	defer span.Finish()
 
-	imageDataArray := make([][]byte, 0)
+	return FromBytes(ctx, downloadImages(ctx, safeImageClient, imageUrls), descriptions, width, height, tileWidth, tileHeight, backgroundColour)
+}
+
+// safeImageClient downloads user supplied image urls, only public addresses and PNG or JPEG images are allowed
+var safeImageClient = net.NewSafeClient(net.SafeOptions{
+	AllowedContentTypes: []string{"image/png", "image/jpeg"},
+})
+
+// downloadImages downloads all given image urls, failed downloads and empty urls will be nil
+func downloadImages(ctx context.Context, client *net.Client, imageUrls []string) (imageDataArray [][]byte) {
+	imageDataArray = make([][]byte, 0)
 	// download images
 	for _, imageURL := range imageUrls {
 		if imageURL == "" {
 			imageDataArray = append(imageDataArray, nil)
 			continue
 		}
-		imageData, err := net.Get(imageURL)
+		imageData, err := client.Get(ctx, imageURL)
 		if err == nil {
 			imageDataArray = append(imageDataArray, imageData)
 		} else {
@@ -43,8 +54,7 @@ func FromUrls(ctx context.Context, imageUrls, descriptions []string, width, heig
 			imageDataArray = append(imageDataArray, nil)
 		}
 	}
-
-	return FromBytes(ctx, imageDataArray, descriptions, width, height, tileWidth, tileHeight, backgroundColour)
+	return imageDataArray
 }
 
 // FromBytes creates a Collage PNG Image from image []byte (PNG or JPEG).
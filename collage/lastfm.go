@@ -0,0 +1,220 @@
+package collage
+
+import (
+	"bytes"
+	"context"
+	"image"
+	// register image decoders for the Last.FM images
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/opentracing/opentracing-go"
+	"github.com/ungerik/go-cairo"
+	"gitlab.com/Cacophony/dhelpers"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"gitlab.com/Cacophony/dhelpers/net"
+)
+
+const (
+	// size of the Last.FM extralarge images
+	lastFmTileSize = 300
+
+	nowPlayingCardWidth   = 700
+	nowPlayingCardHeight  = 200
+	nowPlayingCardPadding = 16
+)
+
+// LastFmAlbumChart creates a chart PNG Image of the top albums of a Last.FM user
+// username	: the Last.FM username
+// period	: the Last.FM period
+// columns	: the number of albums per row
+// rows		: the number of rows
+func LastFmAlbumChart(ctx context.Context, username string, period dhelpers.LastFmPeriod, columns, rows int) (chartBytes []byte, err error) {
+	// start tracing span
+	var span opentracing.Span
+	span, ctx = opentracing.StartSpanFromContext(ctx, "dhelpers.collage.LastFmAlbumChart")
+	defer span.Finish()
+
+	albums, err := dhelpers.LastFmGetTopAlbums(ctx, username, columns*rows, period)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromLastFmAlbums(ctx, albums, columns, rows), nil
+}
+
+// LastFmArtistChart creates a chart PNG Image of the top artists of a Last.FM user
+// username	: the Last.FM username
+// period	: the Last.FM period
+// columns	: the number of artists per row
+// rows		: the number of rows
+func LastFmArtistChart(ctx context.Context, username string, period dhelpers.LastFmPeriod, columns, rows int) (chartBytes []byte, err error) {
+	// start tracing span
+	var span opentracing.Span
+	span, ctx = opentracing.StartSpanFromContext(ctx, "dhelpers.collage.LastFmArtistChart")
+	defer span.Finish()
+
+	artists, err := dhelpers.LastFmGetTopArtists(ctx, username, columns*rows, period)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromLastFmArtists(ctx, artists, columns, rows), nil
+}
+
+// FromLastFmAlbums creates a chart PNG Image from albums, with the names and play counts written on each tile
+// columns	: the number of albums per row
+// rows		: the number of rows
+func FromLastFmAlbums(ctx context.Context, albums []dhelpers.LastfmAlbumData, columns, rows int) (chartBytes []byte) {
+	imageUrls := make([]string, 0, columns*rows)
+	descriptions := make([]string, 0, columns*rows)
+	for i, album := range albums {
+		if i >= columns*rows {
+			break
+		}
+		imageUrls = append(imageUrls, album.ImageURL)
+		descriptions = append(descriptions, album.Artist+"\n"+album.Name+"\n"+lastFmPlays(album.Scrobbles))
+	}
+
+	return FromBytes(
+		ctx,
+		downloadImages(ctx, net.DefaultClient, imageUrls),
+		descriptions,
+		columns*lastFmTileSize, rows*lastFmTileSize,
+		lastFmTileSize, lastFmTileSize,
+		dhelpers.DiscordDarkThemeBackgroundColor,
+	)
+}
+
+// FromLastFmArtists creates a chart PNG Image from artists, with the names and play counts written on each tile
+// columns	: the number of artists per row
+// rows		: the number of rows
+func FromLastFmArtists(ctx context.Context, artists []dhelpers.LastfmArtistData, columns, rows int) (chartBytes []byte) {
+	imageUrls := make([]string, 0, columns*rows)
+	descriptions := make([]string, 0, columns*rows)
+	for i, artist := range artists {
+		if i >= columns*rows {
+			break
+		}
+		imageUrls = append(imageUrls, artist.ImageURL)
+		descriptions = append(descriptions, artist.Name+"\n"+lastFmPlays(artist.Scrobbles))
+	}
+
+	return FromBytes(
+		ctx,
+		downloadImages(ctx, net.DefaultClient, imageUrls),
+		descriptions,
+		columns*lastFmTileSize, rows*lastFmTileSize,
+		lastFmTileSize, lastFmTileSize,
+		dhelpers.DiscordDarkThemeBackgroundColor,
+	)
+}
+
+// LastFmNowPlayingCard creates a PNG Image showing the given track, and information about the user
+// track	: the track to show, usually the first result of dhelpers.LastFmGetRecentTracks
+// user		: the user listening to the track
+func LastFmNowPlayingCard(ctx context.Context, track dhelpers.LastfmTrackData, user dhelpers.LastfmUserData) (cardBytes []byte) {
+	// start tracing span
+	var span opentracing.Span
+	span, _ = opentracing.StartSpanFromContext(ctx, "dhelpers.collage.LastFmNowPlayingCard")
+	defer span.Finish()
+
+	// create surface with discord background colour
+	backgroundColourRGB, _ := colorful.Hex(dhelpers.DiscordDarkThemeBackgroundColor) // nolint: errcheck, gas
+	cairoSurface := cairo.NewSurface(cairo.FORMAT_RGB24, nowPlayingCardWidth, nowPlayingCardHeight)
+	cairoSurface.SetSourceRGB(backgroundColourRGB.R, backgroundColourRGB.G, backgroundColourRGB.B)
+	cairoSurface.Paint()
+
+	// draw cover scaled to the height of the card
+	imageURL := track.ImageURL
+	if imageURL == "" {
+		imageURL = track.ArtistImageURL
+	}
+	coverData := downloadImages(ctx, net.DefaultClient, []string{imageURL})[0]
+	if len(coverData) > 0 {
+		coverImage, _, err := image.Decode(bytes.NewReader(coverData))
+		if err != nil {
+			cache.GetLogger().WithField("module", "collage").Errorln("error decoding cover image", err.Error())
+		}
+		if err == nil && coverImage.Bounds().Dy() > 0 {
+			coverSurface := cairo.NewSurfaceFromImage(coverImage)
+			scale := float64(nowPlayingCardHeight) / float64(coverImage.Bounds().Dy())
+			cairoSurface.Save()
+			cairoSurface.Scale(scale, scale)
+			cairoSurface.SetSourceSurface(coverSurface, 0, 0)
+			cairoSurface.Paint()
+			cairoSurface.Restore()
+		}
+	}
+
+	// draw text next to the cover
+	posX := float64(nowPlayingCardHeight + nowPlayingCardPadding)
+	maxWidth := float64(nowPlayingCardWidth) - posX - nowPlayingCardPadding
+
+	status := "last played"
+	if track.NowPlaying {
+		status = "now playing"
+	}
+	statusLine := user.Username + " " + status
+	if track.Loved {
+		statusLine += " ♥"
+	}
+
+	posY := float64(nowPlayingCardPadding)
+	posY = drawCardLine(cairoSurface, statusLine, posX, posY, maxWidth, 18, cairo.FONT_WEIGHT_NORMAL, 0.7)
+	posY = drawCardLine(cairoSurface, track.Name, posX, posY+8, maxWidth, 30, cairo.FONT_WEIGHT_BOLD, 1)
+	posY = drawCardLine(cairoSurface, track.Artist, posX, posY+4, maxWidth, 24, cairo.FONT_WEIGHT_NORMAL, 1)
+	if track.Album != "" {
+		drawCardLine(cairoSurface, track.Album, posX, posY+4, maxWidth, 20, cairo.FONT_WEIGHT_NORMAL, 0.7)
+	}
+
+	// draw scrobbles at the bottom
+	if user.Scrobbles > 0 {
+		drawCardLine(
+			cairoSurface,
+			humanize.Comma(int64(user.Scrobbles))+" scrobbles",
+			posX, float64(nowPlayingCardHeight-nowPlayingCardPadding-16),
+			maxWidth, 16, cairo.FONT_WEIGHT_NORMAL, 0.7,
+		)
+	}
+
+	// write surface to byte slice and return it
+	bytesData, _ := cairoSurface.WriteToPNGStream()
+	return bytesData
+}
+
+// drawCardLine draws a single line of text, shrinks the font to fit maxWidth, and returns the y position below the line
+func drawCardLine(cairoSurface *cairo.Surface, line string, posX, posY, maxWidth float64, fontSize float64, weight cairo.FontWeight, brightness float64) (nextPosY float64) {
+	line = strings.TrimSpace(line)
+
+	cairoSurface.SelectFontFace("UnDotum", cairo.FONT_SLANT_NORMAL, weight)
+	// adjust font size to fit card
+	for {
+		cairoSurface.SetFontSize(fontSize)
+		extend := cairoSurface.TextExtents(line)
+		// break if line fits into card, or font size is <= 10
+		if extend.Width < maxWidth || fontSize <= 10 {
+			break
+		}
+		// try a smaller font
+		fontSize--
+	}
+
+	cairoSurface.SetSourceRGB(brightness, brightness, brightness)
+	cairoSurface.MoveTo(posX, posY+fontSize)
+	cairoSurface.ShowText(line)
+
+	return posY + fontSize
+}
+
+// lastFmPlays formats the number of plays
+// example: 1234 => 1,234 plays
+func lastFmPlays(scrobbles int) string {
+	if scrobbles == 1 {
+		return "1 play"
+	}
+	return humanize.Comma(int64(scrobbles)) + " plays"
+}
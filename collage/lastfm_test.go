@@ -0,0 +1,122 @@
+package collage
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gitlab.com/Cacophony/dhelpers"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+func init() {
+	// init logger
+	cache.SetLogger(logrus.NewEntry(logrus.New()))
+}
+
+// startImageStub starts a server responding with a 300x300 PNG image to all requests
+func startImageStub(t *testing.T) *httptest.Server {
+	stubImage := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	for x := 0; x < 300; x++ {
+		for y := 0; y < 300; y++ {
+			stubImage.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, stubImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(buf.Bytes()) // nolint: errcheck
+	}))
+}
+
+func decodePNG(t *testing.T, data []byte) image.Image {
+	result, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Expected a valid PNG, got ", err)
+	}
+	return result
+}
+
+func TestFromLastFmAlbums(t *testing.T) {
+	server := startImageStub(t)
+	defer server.Close()
+
+	albums := []dhelpers.LastfmAlbumData{
+		{Name: "Album A", Artist: "Artist A", ImageURL: server.URL + "/a.png", Scrobbles: 1234},
+		{Name: "Album B", Artist: "Artist B", ImageURL: server.URL + "/b.png", Scrobbles: 1},
+		{Name: "Album C", Artist: "Artist C", Scrobbles: 42},
+		{Name: "Album D", Artist: "Artist D", ImageURL: server.URL + "/d.png", Scrobbles: 7},
+		{Name: "Album E", Artist: "Artist E", ImageURL: server.URL + "/e.png", Scrobbles: 3},
+	}
+
+	v := decodePNG(t, FromLastFmAlbums(context.Background(), albums, 2, 2))
+	if v.Bounds().Dx() != 600 || v.Bounds().Dy() != 600 {
+		t.Error("Expected 600x600, got ", v.Bounds().Dx(), "x", v.Bounds().Dy())
+	}
+}
+
+func TestFromLastFmArtists(t *testing.T) {
+	server := startImageStub(t)
+	defer server.Close()
+
+	artists := []dhelpers.LastfmArtistData{
+		{Name: "Artist A", ImageURL: server.URL + "/a.png", Scrobbles: 1234},
+		{Name: "Artist B", ImageURL: server.URL + "/b.png", Scrobbles: 12},
+		{Name: "Artist C", ImageURL: server.URL + "/c.png", Scrobbles: 1},
+	}
+
+	v := decodePNG(t, FromLastFmArtists(context.Background(), artists, 3, 1))
+	if v.Bounds().Dx() != 900 || v.Bounds().Dy() != 300 {
+		t.Error("Expected 900x300, got ", v.Bounds().Dx(), "x", v.Bounds().Dy())
+	}
+}
+
+func TestLastFmNowPlayingCard(t *testing.T) {
+	server := startImageStub(t)
+	defer server.Close()
+
+	track := dhelpers.LastfmTrackData{
+		Name:       "Track",
+		Artist:     "Artist",
+		Album:      "Album",
+		ImageURL:   server.URL + "/cover.png",
+		NowPlaying: true,
+		Loved:      true,
+	}
+	user := dhelpers.LastfmUserData{
+		Username:  "stubuser",
+		Scrobbles: 1337,
+	}
+
+	v := decodePNG(t, LastFmNowPlayingCard(context.Background(), track, user))
+	if v.Bounds().Dx() != nowPlayingCardWidth || v.Bounds().Dy() != nowPlayingCardHeight {
+		t.Error("Expected ", nowPlayingCardWidth, "x", nowPlayingCardHeight, ", got ", v.Bounds().Dx(), "x", v.Bounds().Dy())
+	}
+	// cover should be drawn in the top left corner
+	r, g, b, _ := v.At(10, 10).RGBA()
+	if r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+		t.Error("Expected red cover at 10x10, got ", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestLastFmPlays(t *testing.T) {
+	v := lastFmPlays(1)
+	if v != "1 play" {
+		t.Error("Expected 1 play, got ", v)
+	}
+	v = lastFmPlays(1234)
+	if v != "1,234 plays" {
+		t.Error("Expected 1,234 plays, got ", v)
+	}
+}
@@ -12,12 +12,23 @@ import (
 	"github.com/mongodb/mongo-go-driver/mongo"
 	"github.com/mongodb/mongo-go-driver/mongo/clientopt"
 	"gitlab.com/Cacophony/dhelpers/cache"
+	dmongo "gitlab.com/Cacophony/dhelpers/mongo"
 )
 
 // InitMongoDB initialises the MongoDB session
 // reads the MongoDB URL from the environment variable MONGODB_URL
 // reads the MongoDB Database from the environment variable MONGODB_DATABASE
+// reads the slow query threshold from the environment variable MONGODB_SLOW_QUERY_THRESHOLD, for example 200ms
+// creates the indexes declared by repositories, and runs pending migrations
+// if migrations are registered, InitRedis has to be called first
 func InitMongoDB() (err error) {
+	if os.Getenv("MONGODB_SLOW_QUERY_THRESHOLD") != "" {
+		dmongo.SlowQueryThreshold, err = time.ParseDuration(os.Getenv("MONGODB_SLOW_QUERY_THRESHOLD"))
+		if err != nil {
+			return err
+		}
+	}
+
 	// TODO: logging?
 	mDbSession, err := mongo.NewClientWithOptions(
 		os.Getenv("MONGODB_URL"),
@@ -37,5 +48,20 @@ func InitMongoDB() (err error) {
 	}
 
 	cache.SetMongo(mDbSession.Database(os.Getenv("MONGODB_DATABASE")))
+
+	// create indexes declared by the repositories
+	err = dmongo.EnsureIndexes(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// run pending migrations, requires redis for the lock
+	if dmongo.HasMigrations() {
+		_, err = dmongo.RunMigrations(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
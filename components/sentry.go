@@ -3,18 +3,26 @@ package components
 import (
 	"os"
 
-	"github.com/getsentry/raven-go"
+	"github.com/getsentry/sentry-go"
+	"gitlab.com/Cacophony/dhelpers"
 )
 
-// InitSentry sets up the raven client
-// it reads the DSN from the environment variable RAVEN_DSN
+// InitSentry sets up the sentry client
+// it reads the DSN from the environment variable SENTRY_DSN, or RAVEN_DSN for older deployments
 // it sets the release to the environment variable VERSION if set
+// it sets the environment to the current environment, see dhelpers.GetEnvironment
 func InitSentry() (err error) {
-	if os.Getenv("RAVEN_DSN") != "" {
-		err = raven.SetDSN(os.Getenv("RAVEN_DSN"))
-		if os.Getenv("VERSION") != "" {
-			raven.SetRelease(os.Getenv("VERSION"))
-		}
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("RAVEN_DSN")
 	}
-	return err
+	if dsn == "" {
+		return nil
+	}
+
+	return sentry.Init(sentry.ClientOptions{
+		Dsn:         dsn,
+		Release:     os.Getenv("VERSION"),
+		Environment: string(dhelpers.GetEnvironment()),
+	})
 }
@@ -1,7 +1,18 @@
 package components
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/BurntSushi/toml"
+	"github.com/minio/minio-go"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"gitlab.com/Cacophony/dhelpers/cache"
 	"golang.org/x/text/language"
@@ -19,3 +30,208 @@ func InitTranslator(files []string) {
 
 	cache.SetLocalizationBundle(bundle)
 }
+
+// TranslationSource is a source of translation files, the language is taken from the filename, example: active.de.toml
+type TranslationSource interface {
+	// Versions returns the version of all translation files, by name
+	// the version changes whenever the content of the file changes
+	Versions() (versions map[string]string, err error)
+	// Read returns the content of a translation file
+	Read(name string) (data []byte, err error)
+}
+
+// DirectoryTranslationSource reads all .toml files in a directory
+type DirectoryTranslationSource struct {
+	Directory string
+}
+
+// Versions returns the modification times of all .toml files in the directory, by path
+func (s DirectoryTranslationSource) Versions() (versions map[string]string, err error) {
+	files, err := filepath.Glob(filepath.Join(s.Directory, "*.toml"))
+	if err != nil {
+		return nil, err
+	}
+
+	versions = make(map[string]string)
+	for _, file := range files {
+		var info os.FileInfo
+		info, err = os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		versions[file] = info.ModTime().String() + "-" + strconv.FormatInt(info.Size(), 10)
+	}
+	return versions, nil
+}
+
+// Read returns the content of a file in the directory
+func (s DirectoryTranslationSource) Read(name string) (data []byte, err error) {
+	return ioutil.ReadFile(name) // nolint: gosec
+}
+
+// MinioTranslationSource reads all .toml objects with a prefix in a bucket, using cache.GetMinio
+type MinioTranslationSource struct {
+	Bucket string
+	Prefix string // example: translations/
+}
+
+// Versions returns the ETags of all .toml objects with the prefix, by object name
+func (s MinioTranslationSource) Versions() (versions map[string]string, err error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	versions = make(map[string]string)
+	for object := range cache.GetMinio().ListObjects(s.Bucket, s.Prefix, true, doneCh) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if path.Ext(object.Key) != ".toml" {
+			continue
+		}
+		versions[object.Key] = object.ETag
+	}
+	return versions, nil
+}
+
+// Read returns the content of an object in the bucket
+func (s MinioTranslationSource) Read(name string) (data []byte, err error) {
+	object, err := cache.GetMinio().GetObject(s.Bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close() // nolint: errcheck
+
+	return ioutil.ReadAll(object)
+}
+
+// TranslationWatcher loads translation bundles from a TranslationSource, and reloads them when the files change
+type TranslationWatcher struct {
+	source   TranslationSource
+	versions map[string]string
+	messages map[string]i18n.Message // the messages of the current bundle, by language and message ID
+	reload   sync.Mutex              // held while reloading, Reload is called by the watch goroutine and by users
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// InitTranslatorFromSource initialises and caches a translation bundle from source
+// checks source for changes every interval, and swaps the cached bundle if the files changed
+// if the changed files can not be loaded, the previous bundle will be kept
+func InitTranslatorFromSource(source TranslationSource, interval time.Duration) (watcher *TranslationWatcher, err error) {
+	watcher = &TranslationWatcher{
+		source: source,
+		stop:   make(chan struct{}),
+	}
+
+	_, err = watcher.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	go watcher.watch(interval)
+
+	return watcher, nil
+}
+
+// Reload loads all translation files if they changed since the last load, and caches the new bundle
+// returns the changed message keys, in the format <language>:<message id>
+func (w *TranslationWatcher) Reload() (changedKeys []string, err error) {
+	w.reload.Lock()
+	defer w.reload.Unlock()
+
+	versions, err := w.source.Versions()
+	if err != nil {
+		return nil, err
+	}
+	if w.versions != nil && equalVersions(w.versions, versions) {
+		return nil, nil
+	}
+
+	bundle := &i18n.Bundle{DefaultLanguage: language.English}
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+
+	messages := make(map[string]i18n.Message)
+	for name := range versions {
+		var data []byte
+		data, err = w.source.Read(name)
+		if err != nil {
+			return nil, err
+		}
+
+		var messageFile *i18n.MessageFile
+		messageFile, err = bundle.ParseMessageFileBytes(data, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, message := range messageFile.Messages {
+			messages[messageFile.Tag.String()+":"+message.ID] = *message
+		}
+	}
+
+	changedKeys = changedMessageKeys(w.messages, messages)
+
+	cache.SetLocalizationBundle(bundle)
+	w.versions = versions
+	w.messages = messages
+
+	cache.GetLogger().WithField("module", "translation").Infof(
+		"loaded %d translation files, %d changed keys: %s",
+		len(versions), len(changedKeys), strings.Join(changedKeys, ", "),
+	)
+
+	return changedKeys, nil
+}
+
+// Stop stops checking for changes
+func (w *TranslationWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+func (w *TranslationWatcher) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			_, err := w.Reload()
+			if err != nil {
+				cache.GetLogger().WithField("module", "translation").Errorln(
+					"error reloading translations, keeping previous bundle:", err.Error(),
+				)
+			}
+		}
+	}
+}
+
+func equalVersions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, version := range a {
+		if b[name] != version {
+			return false
+		}
+	}
+	return true
+}
+
+func changedMessageKeys(previous, current map[string]i18n.Message) (changedKeys []string) {
+	for key, message := range current {
+		if previousMessage, ok := previous[key]; !ok || previousMessage != message {
+			changedKeys = append(changedKeys, key)
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changedKeys = append(changedKeys, key)
+		}
+	}
+	sort.Strings(changedKeys)
+	return changedKeys
+}
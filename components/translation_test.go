@@ -0,0 +1,123 @@
+package components
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+func init() {
+	// init logger
+	cache.SetLogger(logrus.NewEntry(logrus.New()))
+}
+
+func translate(t *testing.T, language, messageID string) string {
+	translation, err := i18n.NewLocalizer(cache.GetLocalizationBundle(), language).Localize(&i18n.LocalizeConfig{
+		MessageID: messageID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return translation
+}
+
+func TestTranslationWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "translations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	writeFile := func(name, content string) {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("active.en.toml", "Hello = \"Helo\"\nGoodbye = \"Goodbye\"\n")
+	writeFile("active.de.toml", "Hello = \"Hallo\"\n")
+
+	watcher := &TranslationWatcher{source: DirectoryTranslationSource{Directory: dir}}
+	changedKeys, err := watcher.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changedKeys) != 3 {
+		t.Error("Expected 3 changed keys, got ", changedKeys)
+	}
+	v := translate(t, "en", "Hello")
+	if v != "Helo" {
+		t.Error("Expected Helo, got ", v)
+	}
+
+	// fix typo
+	writeFile("active.en.toml", "Hello = \"Hello\"\nGoodbye = \"Goodbye\"\n")
+	watcher.versions["changed"] = "" // force reload, the modification time might not have changed
+	changedKeys, err = watcher.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changedKeys) != 1 || changedKeys[0] != "en:Hello" {
+		t.Error("Expected [en:Hello], got ", changedKeys)
+	}
+	v = translate(t, "en", "Hello")
+	if v != "Hello" {
+		t.Error("Expected Hello, got ", v)
+	}
+
+	// break file, previous bundle should be kept
+	writeFile("active.de.toml", "Hello = \"Hallo\n")
+	watcher.versions["changed"] = ""
+	_, err = watcher.Reload()
+	if err == nil {
+		t.Error("Expected error for invalid file")
+	}
+	v = translate(t, "de", "Hello")
+	if v != "Hallo" {
+		t.Error("Expected Hallo, got ", v)
+	}
+}
+
+// run with -race, Reload is called by the watch goroutine and by the test at the same time
+func TestTranslationWatcher_concurrentReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "translations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	err = ioutil.WriteFile(filepath.Join(dir, "active.en.toml"), []byte("Hello = \"Hello\"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher, err := InitTranslatorFromSource(DirectoryTranslationSource{Directory: dir}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	for i := 0; i < 50; i++ {
+		err = ioutil.WriteFile(filepath.Join(dir, "active.en.toml"), []byte("Hello = \"Hello "+strconv.Itoa(i)+"\"\n"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = watcher.Reload()
+		if err != nil {
+			t.Error("Expected no error, got ", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	v := translate(t, "en", "Hello")
+	if v != "Hello 49" {
+		t.Error("Expected Hello 49, got ", v)
+	}
+}
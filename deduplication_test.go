@@ -1,6 +1,7 @@
 package dhelpers
 
 import (
+	"context"
 	"testing"
 
 	"os"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/go-redis/redis"
+	"github.com/mongodb/mongo-go-driver/mongo"
 	"github.com/sirupsen/logrus"
 	"gitlab.com/Cacophony/dhelpers/cache"
 )
@@ -23,6 +25,26 @@ func init() {
 		Password: "",
 		DB:       0,
 	}))
+	// init mongodb, tests which require MongoDB are skipped if it is not configured
+	if os.Getenv("MONGODB_URL") == "" {
+		return
+	}
+	client, err := mongo.NewClient(os.Getenv("MONGODB_URL"))
+	if err != nil {
+		return
+	}
+	err = client.Connect(context.Background())
+	if err != nil {
+		return
+	}
+	cache.SetMongo(client.Database(os.Getenv("MONGODB_DATABASE")))
+}
+
+// skipWithoutMongo skips a test which requires MongoDB, if MONGODB_URL is not set
+func skipWithoutMongo(t *testing.T) {
+	if cache.GetMongo() == nil {
+		t.Skip("MongoDB is not configured, set MONGODB_URL to run this test")
+	}
 }
 
 func TestGetEventKey(t *testing.T) {
@@ -62,6 +62,7 @@ func DiscordTime(theTime time.Time) string {
 }
 
 // CleanURL makes a URL posted in discord ready to use for further usage
+// the URL is user supplied, fetch it using net.SafeGet or a client created by net.NewSafeClient
 func CleanURL(uncleanedURL string) (url string) {
 	if strings.HasPrefix(uncleanedURL, "<") {
 		uncleanedURL = strings.TrimLeft(uncleanedURL, "<")
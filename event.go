@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"gitlab.com/Cacophony/dhelpers/state"
 )
 
 // EventType is the Type used for the EventContainer
@@ -179,18 +180,150 @@ func CreateEventContainer(gatewayStartedAt, receivedAt time.Time, session *disco
 		dDEvent.Type = MessageDeleteEventType
 		dDEvent.MessageDelete = t
 	case *discordgo.ChannelPinsUpdate:
+		dDEvent.Type = ChannelPinsUpdateEventType
 		dDEvent.ChannelPinsUpdate = t
 	case *discordgo.GuildBanAdd:
+		dDEvent.Type = GuildBanAddEventType
 		dDEvent.GuildBanAdd = t
 	case *discordgo.GuildBanRemove:
+		dDEvent.Type = GuildBanRemoveEventType
 		dDEvent.GuildBanRemove = t
 	case *discordgo.MessageReactionAdd:
+		dDEvent.Type = MessageReactionAddEventType
 		dDEvent.MessageReactionAdd = t
 	case *discordgo.MessageReactionRemove:
+		dDEvent.Type = MessageReactionRemoveEventType
 		dDEvent.MessageReactionRemove = t
 	case *discordgo.MessageReactionRemoveAll:
+		dDEvent.Type = MessageReactionRemoveAllEventType
 		dDEvent.MessageReactionRemoveAll = t
 	}
 
 	return dDEvent
 }
+
+// GuildID returns the Guild ID of the event, returns an empty string if the event is not related to a guild
+func (event EventContainer) GuildID() (guildID string) {
+	switch event.Type {
+	case GuildCreateEventType:
+		return event.GuildCreate.ID
+	case GuildUpdateEventType:
+		return event.GuildUpdate.ID
+	case GuildDeleteEventType:
+		return event.GuildDelete.ID
+	case GuildMemberAddEventType:
+		return event.GuildMemberAdd.GuildID
+	case GuildMemberUpdateEventType:
+		return event.GuildMemberUpdate.GuildID
+	case GuildMemberRemoveEventType:
+		return event.GuildMemberRemove.GuildID
+	case GuildMembersChunkEventType:
+		return event.GuildMembersChunk.GuildID
+	case GuildRoleCreateEventType:
+		return event.GuildRoleCreate.GuildID
+	case GuildRoleUpdateEventType:
+		return event.GuildRoleUpdate.GuildID
+	case GuildRoleDeleteEventType:
+		return event.GuildRoleDelete.GuildID
+	case GuildEmojisUpdateEventType:
+		return event.GuildEmojisUpdate.GuildID
+	case GuildBanAddEventType:
+		return event.GuildBanAdd.GuildID
+	case GuildBanRemoveEventType:
+		return event.GuildBanRemove.GuildID
+	case ChannelCreateEventType:
+		return event.ChannelCreate.GuildID
+	case ChannelUpdateEventType:
+		return event.ChannelUpdate.GuildID
+	case ChannelDeleteEventType:
+		return event.ChannelDelete.GuildID
+	case MessageCreateEventType:
+		return event.MessageCreate.GuildID
+	case MessageUpdateEventType:
+		return event.MessageUpdate.GuildID
+	case MessageDeleteEventType:
+		return event.MessageDelete.GuildID
+	case PresenceUpdateEventType:
+		return event.PresenceUpdate.GuildID
+	case ChannelPinsUpdateEventType:
+		return guildIDForChannel(event.ChannelPinsUpdate.ChannelID)
+	case MessageReactionAddEventType:
+		return guildIDForChannel(event.MessageReactionAdd.ChannelID)
+	case MessageReactionRemoveEventType:
+		return guildIDForChannel(event.MessageReactionRemove.ChannelID)
+	case MessageReactionRemoveAllEventType:
+		return guildIDForChannel(event.MessageReactionRemoveAll.ChannelID)
+	}
+
+	return ""
+}
+
+// UserID returns the ID of the User who caused the event, returns an empty string if the event is not caused by an user
+func (event EventContainer) UserID() (userID string) {
+	var user *discordgo.User
+
+	switch event.Type {
+	case MessageCreateEventType:
+		user = event.MessageCreate.Author
+	case MessageUpdateEventType:
+		user = event.MessageUpdate.Author
+	case GuildMemberAddEventType:
+		user = event.GuildMemberAdd.User
+	case GuildMemberUpdateEventType:
+		user = event.GuildMemberUpdate.User
+	case GuildMemberRemoveEventType:
+		user = event.GuildMemberRemove.User
+	case GuildBanAddEventType:
+		user = event.GuildBanAdd.User
+	case GuildBanRemoveEventType:
+		user = event.GuildBanRemove.User
+	case PresenceUpdateEventType:
+		user = event.PresenceUpdate.User
+	case MessageReactionAddEventType:
+		return event.MessageReactionAdd.UserID
+	case MessageReactionRemoveEventType:
+		return event.MessageReactionRemove.UserID
+	}
+
+	if user == nil {
+		return ""
+	}
+	return user.ID
+}
+
+// ChannelID returns the Channel ID of the event, returns an empty string if the event is not related to a channel
+func (event EventContainer) ChannelID() (channelID string) {
+	switch event.Type {
+	case ChannelCreateEventType:
+		return event.ChannelCreate.ID
+	case ChannelUpdateEventType:
+		return event.ChannelUpdate.ID
+	case ChannelDeleteEventType:
+		return event.ChannelDelete.ID
+	case ChannelPinsUpdateEventType:
+		return event.ChannelPinsUpdate.ChannelID
+	case MessageCreateEventType:
+		return event.MessageCreate.ChannelID
+	case MessageUpdateEventType:
+		return event.MessageUpdate.ChannelID
+	case MessageDeleteEventType:
+		return event.MessageDelete.ChannelID
+	case MessageReactionAddEventType:
+		return event.MessageReactionAdd.ChannelID
+	case MessageReactionRemoveEventType:
+		return event.MessageReactionRemove.ChannelID
+	case MessageReactionRemoveAllEventType:
+		return event.MessageReactionRemoveAll.ChannelID
+	}
+
+	return ""
+}
+
+// guildIDForChannel returns the Guild ID of a channel using the shared state
+func guildIDForChannel(channelID string) (guildID string) {
+	channel, err := state.Channel(channelID)
+	if err != nil {
+		return ""
+	}
+	return channel.GuildID
+}
@@ -1,13 +1,6 @@
 package dhelpers
 
 import (
-	"runtime"
-
-	"fmt"
-
-	"math/rand"
-	"time"
-
 	"net"
 	"syscall"
 
@@ -16,142 +9,58 @@ import (
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/davecgh/go-spew/spew"
-	"github.com/getsentry/raven-go"
-	"gitlab.com/Cacophony/dhelpers/bucket"
+	"github.com/pkg/errors"
 	"gitlab.com/Cacophony/dhelpers/cache"
-	"gitlab.com/Cacophony/dhelpers/emoji"
-	"gitlab.com/Cacophony/dhelpers/state"
 )
 
 // ErrorHandlerType is the Error Handler Type used for the EventContainer
+// each type is the name of a registered ErrorReporter, see RegisterErrorReporter
 type ErrorHandlerType string
 
 // defines ErrorHandler types
 const (
 	SentryErrorHandler  ErrorHandlerType = "sentry"
-	DiscordErrorHandler                  = "discord"
-)
-
-// defines ratelimiters for the ErrorHandlers
-var (
-	sentryLimiter  = bucket.NewBucket(5)
-	discordLimiter = bucket.NewKeyBucket(3)
+	DiscordErrorHandler ErrorHandlerType = "discord"
+	LogErrorHandler     ErrorHandlerType = "log"
+	// GuildErrorHandler posts errors to the error channel of the guild, see SetGuildErrorChannel
+	GuildErrorHandler ErrorHandlerType = "guild"
+	// WebhookErrorHandler is not registered by default, as it requires an URL, see NewWebhookErrorReporter
+	WebhookErrorHandler ErrorHandlerType = "webhook"
 )
 
 // HandleErrWith handles an error with the given error handles
 // event can be nil
-// currently supported ErrorHandlerTypes: SentryErrorHandler, and DiscordErrorHandler
+// errors will always be logged, see LogErrorHandler, and posted to the error channel of the guild of the event, see GuildErrorHandler
 func HandleErrWith(service string, err error, event *EventContainer, errorHandlers ...ErrorHandlerType) {
-	var msg *discordgo.Message
+	errorContext := ErrorContext{
+		Service:     service,
+		Event:       event,
+		ReferenceID: newReferenceID(),
+		Expected:    isExpectedErr(err),
+	}
 	if event != nil {
+		errorContext.GuildID = event.GuildID()
+		errorContext.UserID = event.UserID()
+
+		var msg *discordgo.Message
 		if event.MessageCreate != nil {
 			msg = event.MessageCreate.Message
 		}
 		if event.MessageUpdate != nil {
 			msg = event.MessageUpdate.Message
 		}
-	}
-
-	var dontLog bool
-	// don't log discord permission errors
-	if errD, ok := err.(*discordgo.RESTError); ok && errD.Message != nil {
-		if errD.Message.Code == discordgo.ErrCodeMissingPermissions ||
-			errD.Message.Code == discordgo.ErrCodeMissingAccess ||
-			errD.Message.Code == discordgo.ErrCodeCannotSendMessagesToThisUser {
-			dontLog = true
+		if msg != nil {
+			errorContext.ChannelID = msg.ChannelID
+			errorContext.MessageID = msg.ID
 		}
 	}
-	// don't log state errors
-	if err == state.ErrStateNotFound ||
-		err == state.ErrTargetWrongServer ||
-		err == state.ErrTargetWrongType {
-		dontLog = true
-	}
-
-	for _, errorHandlerType := range errorHandlers {
-		switch errorHandlerType {
-		case SentryErrorHandler:
-			if dontLog {
-				continue
-			}
 
-			if raven.ProjectID() == "" {
-				continue
-			}
-
-			if !sentryLimiter.Allow() {
-				continue
-			}
-			// send error to sentry
-			data := map[string]string{"service": service}
-			if msg != nil {
-				data["MessageID"] = msg.ID
-				data["AuthorID"] = msg.Author.ID
-				data["ChannelID"] = msg.ChannelID
-				data["Content"] = msg.Content
-				data["Timestamp"] = string(msg.Timestamp)
-			}
-
-			raven.CaptureError(fmt.Errorf(spew.Sdump(err)), data)
-
-		case DiscordErrorHandler:
-			if event == nil || msg == nil || cache.GetEDiscord(event.BotUserID) == nil {
-				continue
-			}
-
-			if !discordLimiter.Allow(msg.ChannelID) {
-				continue
-			}
-
-			// send message to discord, or add reaction if no message permission
-			channelPermissions, chErr := cache.GetEDiscord(event.BotUserID).UserChannelPermissions(event.BotUserID, msg.ChannelID)
-			if chErr == nil {
-				continue
-			}
-
-			if channelPermissions&discordgo.PermissionSendMessages == discordgo.PermissionSendMessages {
-				// send message if possible
-
-				errorMessage := err.Error()
-				if errD, ok := err.(*discordgo.RESTError); ok && errD.Message != nil {
-					errorMessage = errD.Message.Message
-				}
-
-				message := "**Something went wrong.** " + emoji.GetWithout("sad") + "\n```\nError: " + errorMessage + "\n```"
-				if !dontLog {
-					message += "I sent our top people to fix the issue as soon as possible. " + emoji.GetWithout("reach")
-				}
-				event.SendMessage( // nolint: errcheck
-					msg.ChannelID,
-					message,
-				)
-			} else if channelPermissions&discordgo.PermissionAddReactions == discordgo.PermissionAddReactions {
-				// try falling back to reaction if not possible
-
-				reactions := []string{
-					emoji.GetWithout("stop"),
-					emoji.GetWithout("weary"),
-					emoji.GetWithout("speaknoevil"),
-					emoji.GetWithout("notlikethis"),
-					emoji.GetWithout("cry"),
-					emoji.GetWithout("frown"),
-					emoji.GetWithout("unamused"),
-				}
-				rand.Seed(time.Now().Unix())
-				cache.GetEDiscord(event.BotUserID).MessageReactionAdd(msg.ChannelID, msg.ID, reactions[rand.Intn(len(reactions))]) // nolint: errcheck
-			}
-
-		}
+	errorHandlers = withLogErrorHandler(errorHandlers)
+	if errorContext.GuildID != "" {
+		errorHandlers = withErrorHandler(errorHandlers, GuildErrorHandler)
 	}
 
-	if !dontLog && cache.GetLogger() != nil {
-		// log stacktrace
-		buf := make([]byte, 1<<16)
-		stackSize := runtime.Stack(buf, false)
-
-		cache.GetLogger().Errorln(err.Error() + "\n\n" + string(buf[0:stackSize]))
-	}
+	ReportError(err, errorContext, errorHandlers...)
 }
 
 // RecoverLog can be recovered to, all errors will be logged
@@ -165,96 +74,62 @@ func RecoverLog() {
 
 // LogError sends an error to sentry and logs it, can be nil
 func LogError(err error) {
-	if err == nil {
-		return
-	}
-
-	if cache.GetLogger() != nil {
-		// log stacktrace
-		buf := make([]byte, 1<<16)
-		stackSize := runtime.Stack(buf, false)
-
-		cache.GetLogger().Errorln(err.Error() + "\n\n" + string(buf[0:stackSize]))
-	}
-
-	if raven.ProjectID() != "" {
-		// send error to sentry
-		raven.CaptureError(fmt.Errorf(spew.Sdump(err)), nil)
-	}
+	ReportError(err, ErrorContext{}, SentryErrorHandler, LogErrorHandler)
 }
 
 // HandleJobErrorWith handles a Job error, if errorHandlers is nil it will be sent to sentry
-// currently supported ErrorHandlerTypes: SentryErrorHandler
+// errors will always be logged, see LogErrorHandler
 func HandleJobErrorWith(service, job string, err error, errorHandlers ...ErrorHandlerType) {
 	if errorHandlers == nil {
 		errorHandlers = []ErrorHandlerType{SentryErrorHandler}
 	}
 
-	for _, errorHandlerType := range errorHandlers {
-		switch errorHandlerType {
-		case SentryErrorHandler:
-			if raven.ProjectID() != "" {
-				// send error to sentry
-				data := map[string]string{"service": service, "job": job}
-
-				raven.CaptureError(fmt.Errorf(spew.Sdump(err)), data)
-			}
-		}
-	}
-
-	if cache.GetLogger() != nil {
-		// log stacktrace
-		buf := make([]byte, 1<<16)
-		stackSize := runtime.Stack(buf, false)
-
-		cache.GetLogger().WithField("job", job).Errorln(err.Error() + "\n\n" + string(buf[0:stackSize]))
-	}
+	ReportError(err, ErrorContext{Service: service, Job: job}, withLogErrorHandler(errorHandlers)...)
 }
 
 // HandleHTTPErrorWith handles a HTTP error, if errorHandlers is nil it will be sent to sentry
-// currently supported ErrorHandlerTypes: SentryErrorHandler
+// errors will always be logged, see LogErrorHandler
 func HandleHTTPErrorWith(service string, request *http.Request, err error, errorHandlers ...ErrorHandlerType) {
 	if errorHandlers == nil {
 		errorHandlers = []ErrorHandlerType{SentryErrorHandler}
 	}
 
-	for _, errorHandlerType := range errorHandlers {
-		switch errorHandlerType {
-		case SentryErrorHandler:
-			if raven.ProjectID() != "" {
-				// send error to sentry
-				raven.Capture(
-					raven.NewPacket(
-						err.Error(),
-						raven.NewException(
-							err,
-							raven.NewStacktrace(4, 3, raven.IncludePaths()),
-						),
-						raven.NewHttp(request),
-					),
-					map[string]string{"service": service},
-				)
-			}
-		}
+	ReportError(err, ErrorContext{Service: service, Request: request}, withLogErrorHandler(errorHandlers)...)
+}
+
+// isExpectedErr returns true for errors which should not be reported to developers
+// UserErrors are expected unless they are marked to be reported, permission and state errors are always expected
+func isExpectedErr(err error) bool {
+	if userError, ok := AsUserError(err); ok {
+		return !userError.Report
 	}
+	return false
+}
 
-	if cache.GetLogger() != nil {
-		// log stacktrace
-		buf := make([]byte, 1<<16)
-		stackSize := runtime.Stack(buf, false)
+// withLogErrorHandler adds the LogErrorHandler to errorHandlers, if missing
+func withLogErrorHandler(errorHandlers []ErrorHandlerType) []ErrorHandlerType {
+	return withErrorHandler(errorHandlers, LogErrorHandler)
+}
 
-		cache.GetLogger().WithField("module", "http").Errorln(err.Error() + "\n\n" + string(buf[4:stackSize]))
+// withErrorHandler adds an error handler to errorHandlers, if missing
+func withErrorHandler(errorHandlers []ErrorHandlerType, errorHandler ErrorHandlerType) []ErrorHandlerType {
+	for _, existingErrorHandler := range errorHandlers {
+		if existingErrorHandler == errorHandler {
+			return errorHandlers
+		}
 	}
+	return append(errorHandlers, errorHandler)
 }
 
-// CheckErr panics if err is not nil
+// CheckErr panics with the error wrapped with a stacktrace if err is not nil
 func CheckErr(err error, message ...string) {
 	if err != nil {
 		if cache.HasLogger() && len(message) > 0 {
 			cache.GetLogger().WithError(err).Panicln(strings.Join(message, " "))
 		}
 
-		panic(err)
+		// wrap the error, so the stacktrace points at the caller, use errors.Cause to receive the original error
+		panic(errors.WithStack(err))
 	}
 }
 
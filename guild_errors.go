@@ -0,0 +1,186 @@
+package dhelpers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/go-redis/redis"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"gitlab.com/Cacophony/dhelpers/models"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+)
+
+const (
+	// guildErrorChannelCacheExpiry is the duration error channel configurations are cached in redis
+	guildErrorChannelCacheExpiry = 1 * time.Hour
+	// guildErrorAggregationWindow is the duration identical errors are aggregated into one message
+	guildErrorAggregationWindow = 1 * time.Hour
+)
+
+// guildErrorCountScript increments the count of an aggregation, and sets the expiry for the first occurrence
+// in one step, so the aggregation can not be left without expiry
+// KEYS[1]: the aggregation key
+// ARGV[1]: the aggregation window in milliseconds
+// returns the count
+var guildErrorCountScript = redis.NewScript(`
+local count = redis.call('HINCRBY', KEYS[1], 'count', 1)
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func guildErrorChannelKey(guildID string) (key string) {
+	return "project-d:guild-errors:channel:" + guildID
+}
+
+func guildErrorAggregationKey(guildID, fingerprint string) (key string) {
+	return "project-d:guild-errors:aggregation:" + guildID + ":" + fingerprint
+}
+
+// SetGuildErrorChannel configures the channel errors of a guild are posted to
+func SetGuildErrorChannel(ctx context.Context, guildID, channelID string) (err error) {
+	err = models.GuildErrorChannelRepository.Upsert(
+		ctx,
+		map[string]string{"guildid": guildID},
+		map[string]interface{}{"$set": models.GuildErrorChannel{
+			GuildID:   guildID,
+			ChannelID: channelID,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	return cache.GetRedisClient().Set(guildErrorChannelKey(guildID), channelID, guildErrorChannelCacheExpiry).Err()
+}
+
+// RemoveGuildErrorChannel removes the error channel of a guild
+func RemoveGuildErrorChannel(ctx context.Context, guildID string) (err error) {
+	err = models.GuildErrorChannelRepository.Delete(ctx, map[string]string{"guildid": guildID})
+	if err != nil && err != mongo.ErrNotFound {
+		return err
+	}
+
+	return cache.GetRedisClient().Set(guildErrorChannelKey(guildID), "", guildErrorChannelCacheExpiry).Err()
+}
+
+// GetGuildErrorChannel returns the error channel of a guild, returns an empty string if no channel has been set
+func GetGuildErrorChannel(ctx context.Context, guildID string) (channelID string, err error) {
+	// try cache, empty values are cached as well
+	channelID, err = cache.GetRedisClient().Get(guildErrorChannelKey(guildID)).Result()
+	if err == nil {
+		return channelID, nil
+	}
+	if err != redis.Nil {
+		return "", err
+	}
+
+	var entry models.GuildErrorChannel
+	err = models.GuildErrorChannelRepository.FindOne(ctx, map[string]string{"guildid": guildID}, &entry)
+	if err != nil && err != mongo.ErrNotFound {
+		return "", err
+	}
+
+	err = cache.GetRedisClient().Set(guildErrorChannelKey(guildID), entry.ChannelID, guildErrorChannelCacheExpiry).Err()
+	return entry.ChannelID, err
+}
+
+// reportToGuildErrorChannel posts errors to the error channel of the guild
+// identical errors within the aggregation window are summarised in a single message
+func reportToGuildErrorChannel(err error, errorContext ErrorContext) {
+	event := errorContext.Event
+	if event == nil || errorContext.GuildID == "" || cache.GetEDiscord(event.BotUserID) == nil {
+		return
+	}
+
+	channelID, lookupErr := GetGuildErrorChannel(context.Background(), errorContext.GuildID)
+	if lookupErr != nil || channelID == "" {
+		return
+	}
+
+	// identical errors have the same fingerprint
+	errorCode := err.Error()
+	if userError, ok := AsUserError(err); ok {
+		errorCode = userError.Code
+	}
+	key := guildErrorAggregationKey(
+		errorContext.GuildID,
+		GetMD5Hash(errorContext.Service+":"+string(event.Type)+":"+errorCode),
+	)
+
+	redisClient := cache.GetRedisClient()
+	count, redisErr := guildErrorCountScript.Run(
+		redisClient, []string{key}, int64(guildErrorAggregationWindow/time.Millisecond),
+	).Int64()
+	if redisErr != nil {
+		return
+	}
+
+	session := cache.GetEDiscord(event.BotUserID)
+
+	if count == 1 {
+		// first occurrence, send new message
+		message, sendErr := session.ChannelMessageSendEmbed(channelID, guildErrorEmbed(err, errorContext, 1, time.Now()))
+		if sendErr != nil {
+			// remove the aggregation, so the next occurrence tries to send the message again
+			redisClient.Del(key) // nolint: errcheck
+			return
+		}
+		redisClient.HMSet(key, map[string]interface{}{ // nolint: errcheck
+			"messageid": message.ID,
+			"firstat":   time.Now().Unix(),
+		})
+		return
+	}
+
+	// repeated occurrence, update the summary
+	if !discordLimiter.Allow(channelID) {
+		return
+	}
+
+	values, redisErr := redisClient.HMGet(key, "messageid", "firstat").Result()
+	if redisErr != nil || len(values) < 2 {
+		return
+	}
+	messageID, _ := values[0].(string)
+	if messageID == "" {
+		// first message is still being sent
+		return
+	}
+	firstAt := time.Now()
+	if firstAtText, ok := values[1].(string); ok {
+		if firstAtUnix, parseErr := strconv.ParseInt(firstAtText, 10, 64); parseErr == nil {
+			firstAt = time.Unix(firstAtUnix, 0)
+		}
+	}
+
+	session.ChannelMessageEditEmbed( // nolint: errcheck
+		channelID, messageID, guildErrorEmbed(err, errorContext, count, firstAt),
+	)
+}
+
+// guildErrorEmbed creates the summary embed of an error
+func guildErrorEmbed(err error, errorContext ErrorContext, count int64, firstAt time.Time) *discordgo.MessageEmbed {
+	event := errorContext.Event
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Error in " + errorContext.Service,
+		Description: event.UserErrorMessage(err, errorContext.ReferenceID),
+		Color:       HexToDecimal("#E74C3C"),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Event", Value: string(event.Type), Inline: true},
+			{Name: "Occurrences", Value: strconv.FormatInt(count, 10), Inline: true},
+		},
+		Footer:    &discordgo.MessageEmbedFooter{Text: "First occurrence"},
+		Timestamp: DiscordTime(firstAt),
+	}
+	if errorContext.ChannelID != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Channel", Value: "<#" + errorContext.ChannelID + ">", Inline: true,
+		})
+	}
+	return embed
+}
@@ -0,0 +1,121 @@
+package dhelpers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+func TestGetGuildErrorChannel(t *testing.T) {
+	err := cache.GetRedisClient().Set(guildErrorChannelKey("test-guild"), "test-channel", 0).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.GetRedisClient().Del(guildErrorChannelKey("test-guild")) // nolint: errcheck
+
+	v, err := GetGuildErrorChannel(context.Background(), "test-guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "test-channel" {
+		t.Error("Expected test-channel, got ", v)
+	}
+}
+
+func TestGuildErrorEmbed(t *testing.T) {
+	event := &EventContainer{
+		Type: GuildMemberAddEventType,
+		GuildMemberAdd: &discordgo.GuildMemberAdd{Member: &discordgo.Member{
+			GuildID: "test-guild",
+			User:    &discordgo.User{ID: "test-user"},
+		}},
+	}
+	firstAt := time.Date(2018, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	v := guildErrorEmbed(
+		NewUserError("autorole-missing-permissions", "autorole.missing-permissions"),
+		ErrorContext{Service: "AutoRole", Event: event, GuildID: "test-guild"},
+		3, firstAt,
+	)
+	if v.Title != "Error in AutoRole" {
+		t.Error("Expected Error in AutoRole, got ", v.Title)
+	}
+	if len(v.Fields) != 2 || v.Fields[0].Value != string(GuildMemberAddEventType) || v.Fields[1].Value != "3" {
+		t.Errorf("Expected event type and 3 occurrences, got %+v", v.Fields)
+	}
+	if v.Timestamp != "2018-05-01T14:00:00Z" {
+		t.Error("Expected first occurrence timestamp, got ", v.Timestamp)
+	}
+
+	v = guildErrorEmbed(
+		errors.New("test error"),
+		ErrorContext{Service: "AutoRole", Event: event, GuildID: "test-guild", ChannelID: "test-channel"},
+		1, firstAt,
+	)
+	if len(v.Fields) != 3 || v.Fields[2].Value != "<#test-channel>" {
+		t.Errorf("Expected channel field, got %+v", v.Fields)
+	}
+}
+
+func TestGuildErrorCountScript(t *testing.T) {
+	key := guildErrorAggregationKey("test-guild", GetMD5Hash(time.Now().String()))
+	defer cache.GetRedisClient().Del(key) // nolint: errcheck
+
+	for i := int64(1); i <= 2; i++ {
+		count, err := guildErrorCountScript.Run(cache.GetRedisClient(), []string{key}, int64(time.Minute/time.Millisecond)).Int64()
+		if err != nil || count != i {
+			t.Error("Expected count ", i, ", got ", count, err)
+		}
+	}
+
+	ttl, err := cache.GetRedisClient().PTTL(key).Result()
+	if err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Error("Expected expiry within one minute, got ", ttl, err)
+	}
+}
+
+func TestReportToGuildErrorChannel_SendFailed(t *testing.T) {
+	botID := "bot" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	guildID := "guild" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"code":50013,"message":"Missing Permissions"}`)) // nolint: errcheck
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.GetEDiscord(botID).Client = &http.Client{Transport: stubTransport{target: target, next: http.DefaultTransport}}
+
+	err = cache.GetRedisClient().Set(guildErrorChannelKey(guildID), "test-channel", time.Minute).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.GetRedisClient().Del(guildErrorChannelKey(guildID)) // nolint: errcheck
+
+	testErr := errors.New("test error")
+	errorContext := ErrorContext{
+		Service: "Test",
+		Event:   &EventContainer{Type: MessageCreateEventType, BotUserID: botID},
+		GuildID: guildID,
+	}
+	reportToGuildErrorChannel(testErr, errorContext)
+
+	// the aggregation is removed, so the next occurrence sends a new message
+	key := guildErrorAggregationKey(guildID, GetMD5Hash("Test:"+string(MessageCreateEventType)+":test error"))
+	exists, err := cache.GetRedisClient().Exists(key).Result()
+	if err != nil || exists != 0 {
+		t.Error("Expected aggregation to be removed after failed send, got ", exists, err)
+	}
+}
@@ -0,0 +1,172 @@
+package dhelpers
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/json-iterator/go"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// JobControlAction is an action sent to all Schedulers using the job control channel
+type JobControlAction string
+
+// defines the possible job control actions
+const (
+	JobControlTrigger JobControlAction = "trigger"
+	JobControlPause   JobControlAction = "pause"
+	JobControlResume  JobControlAction = "resume"
+)
+
+// defines the redis keys used for job control and history
+const (
+	jobControlChannel = "project-d:job:control"
+	jobPausedKey      = "project-d:job:paused"
+)
+
+// jobHistoryLength is the number of runs kept in the history of each Job
+const jobHistoryLength = 50
+
+// JobRun is a single run of a Job, stored in the history of the Job
+type JobRun struct {
+	Job      string
+	Start    time.Time
+	End      time.Time
+	Status   JobOutcome
+	Error    string `json:",omitempty"`
+	Instance string // the instance which held the lock
+}
+
+// jobControlMessage is the message sent using the job control channel
+type jobControlMessage struct {
+	Action JobControlAction
+	Job    string
+}
+
+func jobHistoryKey(jobName string) (key string) {
+	return "project-d:job:" + jobName + ":history"
+}
+
+// jobInstanceName returns a name identifying this instance, used in the job history
+func jobInstanceName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return hostname + ":" + strconv.Itoa(os.Getpid())
+}
+
+// TriggerJob runs a Job now on one of the instances running a Scheduler with the Job, even if it is paused
+func TriggerJob(jobName string) (err error) {
+	return publishJobControl(JobControlTrigger, jobName)
+}
+
+// PauseJob pauses a Job on all instances, scheduled runs will be skipped until the Job is resumed
+func PauseJob(jobName string) (err error) {
+	err = cache.GetRedisClient().SAdd(jobPausedKey, jobName).Err()
+	if err != nil {
+		return err
+	}
+
+	return publishJobControl(JobControlPause, jobName)
+}
+
+// ResumeJob resumes a paused Job on all instances
+func ResumeJob(jobName string) (err error) {
+	err = cache.GetRedisClient().SRem(jobPausedKey, jobName).Err()
+	if err != nil {
+		return err
+	}
+
+	return publishJobControl(JobControlResume, jobName)
+}
+
+// IsJobPaused returns true if the Job is paused
+func IsJobPaused(jobName string) (paused bool, err error) {
+	return cache.GetRedisClient().SIsMember(jobPausedKey, jobName).Result()
+}
+
+// GetPausedJobs returns the names of all paused Jobs
+func GetPausedJobs() (jobNames []string, err error) {
+	return cache.GetRedisClient().SMembers(jobPausedKey).Result()
+}
+
+// GetJobHistory returns the last runs of a Job, the most recent run first
+// runs of legacy Job functions are not recorded, only runs of Run functions
+// limit	: the maximum number of runs to return, up to 50
+func GetJobHistory(jobName string, limit int64) (runs []JobRun, err error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	entries, err := cache.GetRedisClient().LRange(jobHistoryKey(jobName), 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		var run JobRun
+		err = jsoniter.UnmarshalFromString(entry, &run)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// addJobRun adds a run to the history of the Job, only the last runs are kept
+func addJobRun(run JobRun) (err error) {
+	data, err := jsoniter.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	pipeline := cache.GetRedisClient().TxPipeline()
+	pipeline.LPush(jobHistoryKey(run.Job), data)
+	pipeline.LTrim(jobHistoryKey(run.Job), 0, jobHistoryLength-1)
+	_, err = pipeline.Exec()
+	return err
+}
+
+func publishJobControl(action JobControlAction, jobName string) (err error) {
+	data, err := jsoniter.Marshal(jobControlMessage{
+		Action: action,
+		Job:    jobName,
+	})
+	if err != nil {
+		return err
+	}
+
+	return cache.GetRedisClient().Publish(jobControlChannel, data).Err()
+}
+
+// listenJobControl handles job control messages until the pubsub is closed
+func (s *Scheduler) listenJobControl(pubsub *redis.PubSub) {
+	for redisMessage := range pubsub.Channel() {
+		var message jobControlMessage
+		err := jsoniter.UnmarshalFromString(redisMessage.Payload, &message)
+		if err != nil {
+			if cache.HasLogger() {
+				cache.GetLogger().WithField("module", "scheduler").Warnln("received invalid job control message:", err.Error())
+			}
+			continue
+		}
+
+		job := s.job(message.Job)
+		if job == nil {
+			continue
+		}
+
+		if cache.HasLogger() {
+			cache.GetLogger().WithField("module", "scheduler").Infoln("received job control", string(message.Action), "for", job.Name)
+		}
+
+		if message.Action == JobControlTrigger {
+			go s.run(job)
+		}
+	}
+}
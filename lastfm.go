@@ -24,6 +24,16 @@ const (
 	LastFmPeriod12month              = "12month"
 )
 
+// LastFmPeriods contains all possible LastFM periods
+var LastFmPeriods = []LastFmPeriod{
+	LastFmPeriodOverall,
+	LastFmPeriod7day,
+	LastFmPeriod1month,
+	LastFmPeriod3month,
+	LastFmPeriod6month,
+	LastFmPeriod12month,
+}
+
 const (
 	lastFmTargetImageSize = "extralarge"
 )
@@ -52,7 +62,8 @@ type LastfmTrackData struct {
 	NowPlaying     bool
 	Scrobbles      int
 	// used for guild stats
-	Users int
+	Users         int
+	UserScrobbles map[string]int
 }
 
 // LastfmArtistData contains information about an Artist on LastFM
@@ -61,6 +72,9 @@ type LastfmArtistData struct {
 	URL       string
 	ImageURL  string
 	Scrobbles int
+	// used for guild stats
+	Users         int
+	UserScrobbles map[string]int
 }
 
 // LastfmAlbumData contains information about an Album on LastFM
@@ -71,6 +85,9 @@ type LastfmAlbumData struct {
 	Artist    string
 	ArtistURL string
 	Scrobbles int
+	// used for guild stats
+	Users         int
+	UserScrobbles map[string]int
 }
 
 // LastFmGuildTopTracks contains the top tracks for a guild, it is built by the Worker and stored in redis
@@ -84,112 +101,210 @@ type LastFmGuildTopTracks struct {
 
 // LastFmGuildTopTracksKey returns the redis key for LastFmGuildTopTracks
 func LastFmGuildTopTracksKey(guildID string, period LastFmPeriod) (key string) {
-	return "project-d:lastfm:guild-top-tracks:" + guildID + ":" + string(period)
+	return lastFmGuildStatsKey("guild-top-tracks", guildID, period)
+}
+
+// LastFmGuildTopArtists contains the top artists for a guild, it is built by the Worker and stored in redis
+type LastFmGuildTopArtists struct {
+	GuildID       string
+	NumberOfUsers int
+	Period        LastFmPeriod
+	Artists       []LastfmArtistData
+	CachedAt      time.Time
+}
+
+// LastFmGuildTopArtistsKey returns the redis key for LastFmGuildTopArtists
+func LastFmGuildTopArtistsKey(guildID string, period LastFmPeriod) (key string) {
+	return lastFmGuildStatsKey("guild-top-artists", guildID, period)
+}
+
+// LastFmGuildTopAlbums contains the top albums for a guild, it is built by the Worker and stored in redis
+type LastFmGuildTopAlbums struct {
+	GuildID       string
+	NumberOfUsers int
+	Period        LastFmPeriod
+	Albums        []LastfmAlbumData
+	CachedAt      time.Time
+}
+
+// LastFmGuildTopAlbumsKey returns the redis key for LastFmGuildTopAlbums
+func LastFmGuildTopAlbumsKey(guildID string, period LastFmPeriod) (key string) {
+	return lastFmGuildStatsKey("guild-top-albums", guildID, period)
 }
 
 // LastFmGetUserinfo returns information about a LastFM user
+// returns ErrLastFmUserNotFound if the user does not exist
 func LastFmGetUserinfo(ctx context.Context, lastfmUsername string) (userData LastfmUserData, err error) {
 	// start tracing span
 	var span opentracing.Span
 	span, _ = opentracing.StartSpanFromContext(ctx, "dhelpers.LastFmGetUserinfo")
 	defer span.Finish()
 
-	// request data
-	var lastfmUser lastfm.UserGetInfo
-	lastfmUser, err = cache.GetLastFm().User.GetInfo(lastfm.P{"user": lastfmUsername})
-	if err != nil {
-		return userData, err
-	}
-	// parse fields into lastfmUserData
-	userData.Username = lastfmUser.Name
-	userData.Name = lastfmUser.RealName
-	userData.Country = lastfmUser.Country
-	if lastfmUser.PlayCount != "" {
-		userData.Scrobbles, _ = strconv.Atoi(lastfmUser.PlayCount) // nolint: errcheck, gas
-	}
+	err = lastFmRequest(ctx, lastFmCacheKey("user.getInfo", lastfmUsername), lastFmUserInfoCacheTTL, &userData, func() error {
+		// request data
+		lastfmUser, err := cache.GetLastFm().User.GetInfo(lastfm.P{"user": lastfmUsername})
+		if err != nil {
+			return err
+		}
+		// parse fields into lastfmUserData
+		userData.Username = lastfmUser.Name
+		userData.Name = lastfmUser.RealName
+		userData.Country = lastfmUser.Country
+		if lastfmUser.PlayCount != "" {
+			userData.Scrobbles, _ = strconv.Atoi(lastfmUser.PlayCount) // nolint: errcheck, gas
+		}
 
-	if len(lastfmUser.Images) > 0 {
-		for _, image := range lastfmUser.Images {
-			if image.Size == lastFmTargetImageSize {
-				userData.Icon = image.Url
+		if len(lastfmUser.Images) > 0 {
+			for _, image := range lastfmUser.Images {
+				if image.Size == lastFmTargetImageSize {
+					userData.Icon = image.Url
+				}
 			}
 		}
-	}
 
-	if lastfmUser.Registered.Unixtime != "" {
-		timeI, err := strconv.ParseInt(lastfmUser.Registered.Unixtime, 10, 64)
-		if err == nil {
-			userData.AccountCreation = time.Unix(timeI, 0)
+		if lastfmUser.Registered.Unixtime != "" {
+			timeI, err := strconv.ParseInt(lastfmUser.Registered.Unixtime, 10, 64)
+			if err == nil {
+				userData.AccountCreation = time.Unix(timeI, 0)
+			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return LastfmUserData{}, err
 	}
 
 	return userData, nil
 }
 
 // LastFmGetRecentTracks returns recent tracks listened to by an user
+// returns ErrLastFmPrivateProfile if the user hides their recent tracks
 func LastFmGetRecentTracks(ctx context.Context, lastfmUsername string, limit int) (tracksData []LastfmTrackData, err error) {
 	// start tracing span
 	var span opentracing.Span
 	span, _ = opentracing.StartSpanFromContext(ctx, "dhelpers.LastFmGetRecentTracks")
 	defer span.Finish()
 
-	// request data
-	var lastfmRecentTracks lastfm.UserGetRecentTracksExtended
-	lastfmRecentTracks, err = cache.GetLastFm().User.GetRecentTracksExtended(lastfm.P{
-		"limit": limit + 1, // in case nowplaying + already scrobbled
-		"user":  lastfmUsername,
-	})
-	if err != nil {
-		return nil, err
-	}
+	err = lastFmRequest(ctx, lastFmCacheKey("user.getRecentTracks", lastfmUsername, strconv.Itoa(limit)), lastFmRecentTracksCacheTTL, &tracksData, func() error {
+		// request data
+		lastfmRecentTracks, err := cache.GetLastFm().User.GetRecentTracksExtended(lastfm.P{
+			"limit": limit + 1, // in case nowplaying + already scrobbled
+			"user":  lastfmUsername,
+		})
+		if err != nil {
+			return err
+		}
 
-	// parse fields
-	if lastfmRecentTracks.Total > 0 {
-		for i, track := range lastfmRecentTracks.Tracks {
-			if i == 1 {
-				// prevent nowplaying + already scrobbled
-				if lastfmRecentTracks.Tracks[0].Url == track.Url {
-					continue
+		// parse fields
+		if lastfmRecentTracks.Total > 0 {
+			for i, track := range lastfmRecentTracks.Tracks {
+				if i == 1 {
+					// prevent nowplaying + already scrobbled
+					if lastfmRecentTracks.Tracks[0].Url == track.Url {
+						continue
+					}
 				}
-			}
-			lastTrack := LastfmTrackData{
-				Name:      track.Name,
-				URL:       track.Url,
-				Artist:    track.Artist.Name,
-				ArtistURL: track.Artist.Url,
-				Album:     track.Album.Name,
-				Loved:     false,
-			}
-			for _, image := range track.Images {
-				if image.Size == lastFmTargetImageSize {
-					lastTrack.ImageURL = image.Url
+				lastTrack := LastfmTrackData{
+					Name:      track.Name,
+					URL:       track.Url,
+					Artist:    track.Artist.Name,
+					ArtistURL: track.Artist.Url,
+					Album:     track.Album.Name,
+					Loved:     false,
 				}
-			}
-			for _, image := range track.Artist.Image {
-				if image.Size == lastFmTargetImageSize {
-					lastTrack.ArtistImageURL = image.Url
+				for _, image := range track.Images {
+					if image.Size == lastFmTargetImageSize {
+						lastTrack.ImageURL = image.Url
+					}
+				}
+				for _, image := range track.Artist.Image {
+					if image.Size == lastFmTargetImageSize {
+						lastTrack.ArtistImageURL = image.Url
+					}
+				}
+				if track.Loved == "1" || track.Loved == "true" {
+					lastTrack.Loved = true
+				}
+				if track.NowPlaying == "1" || track.NowPlaying == "true" {
+					lastTrack.NowPlaying = true
+				}
+
+				timestamp, err := strconv.Atoi(track.Date.Uts)
+				if err == nil {
+					lastTrack.Time = time.Unix(int64(timestamp), 0)
+				}
+
+				tracksData = append(tracksData, lastTrack)
+				if len(tracksData) >= limit {
+					break
 				}
 			}
-			if track.Loved == "1" || track.Loved == "true" {
-				lastTrack.Loved = true
-			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tracksData, nil
+}
+
+// LastFmGetRecentTracksSince returns a page of the tracks scrobbled by an user after since, newest first
+// tracks which are currently playing are skipped, up to 200 tracks are returned per page, the first page is 1
+func LastFmGetRecentTracksSince(ctx context.Context, lastfmUsername string, since time.Time, page int) (tracksData []LastfmTrackData, totalPages int, err error) {
+	// start tracing span
+	var span opentracing.Span
+	span, _ = opentracing.StartSpanFromContext(ctx, "dhelpers.LastFmGetRecentTracksSince")
+	defer span.Finish()
+
+	var result struct {
+		Tracks     []LastfmTrackData
+		TotalPages int
+	}
+	err = lastFmRequest(ctx, lastFmCacheKey("user.getRecentTracks", lastfmUsername, strconv.FormatInt(since.Unix(), 10), strconv.Itoa(page)), lastFmRecentTracksCacheTTL, &result, func() error {
+		// request data
+		lastfmRecentTracks, err := cache.GetLastFm().User.GetRecentTracksExtended(lastfm.P{
+			"limit": 200,
+			"page":  page,
+			"from":  since.Unix() + 1,
+			"user":  lastfmUsername,
+		})
+		if err != nil {
+			return err
+		}
+
+		// parse fields
+		result.TotalPages = lastfmRecentTracks.TotalPages
+		for _, track := range lastfmRecentTracks.Tracks {
 			if track.NowPlaying == "1" || track.NowPlaying == "true" {
-				lastTrack.NowPlaying = true
+				continue
 			}
 
 			timestamp, err := strconv.Atoi(track.Date.Uts)
-			if err == nil {
-				lastTrack.Time = time.Unix(int64(timestamp), 0)
+			if err != nil {
+				continue
 			}
 
-			tracksData = append(tracksData, lastTrack)
-			if len(tracksData) >= limit {
-				break
-			}
+			result.Tracks = append(result.Tracks, LastfmTrackData{
+				Name:      track.Name,
+				URL:       track.Url,
+				Artist:    track.Artist.Name,
+				ArtistURL: track.Artist.Url,
+				Album:     track.Album.Name,
+				Loved:     track.Loved == "1" || track.Loved == "true",
+				Time:      time.Unix(int64(timestamp), 0),
+			})
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return tracksData, nil
+	return result.Tracks, result.TotalPages, nil
 }
 
 // LastFmGetTopArtists returns the top artists of an user
@@ -199,36 +314,42 @@ func LastFmGetTopArtists(ctx context.Context, lastfmUsername string, limit int,
 	span, _ = opentracing.StartSpanFromContext(ctx, "dhelpers.LastFmGetTopArtists")
 	defer span.Finish()
 
-	// request data
-	var lastfmTopArtists lastfm.UserGetTopArtists
-	lastfmTopArtists, err = cache.GetLastFm().User.GetTopArtists(lastfm.P{
-		"limit":  limit,
-		"user":   lastfmUsername,
-		"period": string(period),
-	})
-	if err != nil {
-		return nil, err
-	}
+	err = lastFmRequest(ctx, lastFmCacheKey("user.getTopArtists", lastfmUsername, strconv.Itoa(limit), string(period)), lastFmTopCacheTTL, &artistsData, func() error {
+		// request data
+		lastfmTopArtists, err := cache.GetLastFm().User.GetTopArtists(lastfm.P{
+			"limit":  limit,
+			"user":   lastfmUsername,
+			"period": string(period),
+		})
+		if err != nil {
+			return err
+		}
 
-	// parse fields
-	if lastfmTopArtists.Total > 0 {
-		for _, artist := range lastfmTopArtists.Artists {
-			lastArtist := LastfmArtistData{
-				Name: artist.Name,
-				URL:  artist.Url,
-			}
-			for _, image := range artist.Images {
-				if image.Size == lastFmTargetImageSize {
-					lastArtist.ImageURL = image.Url
+		// parse fields
+		if lastfmTopArtists.Total > 0 {
+			for _, artist := range lastfmTopArtists.Artists {
+				lastArtist := LastfmArtistData{
+					Name: artist.Name,
+					URL:  artist.Url,
 				}
-			}
-			lastArtist.Scrobbles, _ = strconv.Atoi(artist.PlayCount) // nolint: gas
+				for _, image := range artist.Images {
+					if image.Size == lastFmTargetImageSize {
+						lastArtist.ImageURL = image.Url
+					}
+				}
+				lastArtist.Scrobbles, _ = strconv.Atoi(artist.PlayCount) // nolint: gas
 
-			artistsData = append(artistsData, lastArtist)
-			if len(artistsData) >= limit {
-				break
+				artistsData = append(artistsData, lastArtist)
+				if len(artistsData) >= limit {
+					break
+				}
 			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return artistsData, nil
@@ -241,38 +362,44 @@ func LastFmGetTopTracks(ctx context.Context, lastfmUsername string, limit int, p
 	span, _ = opentracing.StartSpanFromContext(ctx, "dhelpers.LastFmGetTopTracks")
 	defer span.Finish()
 
-	// request data
-	var lastfmTopTracks lastfm.UserGetTopTracks
-	lastfmTopTracks, err = cache.GetLastFm().User.GetTopTracks(lastfm.P{
-		"limit":  limit,
-		"user":   lastfmUsername,
-		"period": string(period),
-	})
-	if err != nil {
-		return nil, err
-	}
+	err = lastFmRequest(ctx, lastFmCacheKey("user.getTopTracks", lastfmUsername, strconv.Itoa(limit), string(period)), lastFmTopCacheTTL, &tracksData, func() error {
+		// request data
+		lastfmTopTracks, err := cache.GetLastFm().User.GetTopTracks(lastfm.P{
+			"limit":  limit,
+			"user":   lastfmUsername,
+			"period": string(period),
+		})
+		if err != nil {
+			return err
+		}
 
-	// parse fields
-	if lastfmTopTracks.Total > 0 {
-		for _, track := range lastfmTopTracks.Tracks {
-			lastTrack := LastfmTrackData{
-				Name:      track.Name,
-				URL:       track.Url,
-				Artist:    track.Artist.Name,
-				ArtistURL: track.Artist.Url,
-			}
-			for _, image := range track.Images {
-				if image.Size == lastFmTargetImageSize {
-					lastTrack.ImageURL = image.Url
+		// parse fields
+		if lastfmTopTracks.Total > 0 {
+			for _, track := range lastfmTopTracks.Tracks {
+				lastTrack := LastfmTrackData{
+					Name:      track.Name,
+					URL:       track.Url,
+					Artist:    track.Artist.Name,
+					ArtistURL: track.Artist.Url,
 				}
-			}
-			lastTrack.Scrobbles, _ = strconv.Atoi(track.PlayCount) // nolint: gas
+				for _, image := range track.Images {
+					if image.Size == lastFmTargetImageSize {
+						lastTrack.ImageURL = image.Url
+					}
+				}
+				lastTrack.Scrobbles, _ = strconv.Atoi(track.PlayCount) // nolint: gas
 
-			tracksData = append(tracksData, lastTrack)
-			if len(tracksData) >= limit {
-				break
+				tracksData = append(tracksData, lastTrack)
+				if len(tracksData) >= limit {
+					break
+				}
 			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return tracksData, nil
@@ -285,38 +412,44 @@ func LastFmGetTopAlbums(ctx context.Context, lastfmUsername string, limit int, p
 	span, _ = opentracing.StartSpanFromContext(ctx, "dhelpers.LastFmGetTopAlbums")
 	defer span.Finish()
 
-	// request data
-	var lastfmTopAlbums lastfm.UserGetTopAlbums
-	lastfmTopAlbums, err = cache.GetLastFm().User.GetTopAlbums(lastfm.P{
-		"limit":  limit,
-		"user":   lastfmUsername,
-		"period": string(period),
-	})
-	if err != nil {
-		return nil, err
-	}
+	err = lastFmRequest(ctx, lastFmCacheKey("user.getTopAlbums", lastfmUsername, strconv.Itoa(limit), string(period)), lastFmTopCacheTTL, &albumsData, func() error {
+		// request data
+		lastfmTopAlbums, err := cache.GetLastFm().User.GetTopAlbums(lastfm.P{
+			"limit":  limit,
+			"user":   lastfmUsername,
+			"period": string(period),
+		})
+		if err != nil {
+			return err
+		}
 
-	// parse fields
-	if lastfmTopAlbums.Total > 0 {
-		for _, album := range lastfmTopAlbums.Albums {
-			lastAlbum := LastfmAlbumData{
-				Name:      album.Name,
-				URL:       album.Url,
-				Artist:    album.Artist.Name,
-				ArtistURL: album.Artist.Url,
-			}
-			for _, image := range album.Images {
-				if image.Size == lastFmTargetImageSize {
-					lastAlbum.ImageURL = image.Url
+		// parse fields
+		if lastfmTopAlbums.Total > 0 {
+			for _, album := range lastfmTopAlbums.Albums {
+				lastAlbum := LastfmAlbumData{
+					Name:      album.Name,
+					URL:       album.Url,
+					Artist:    album.Artist.Name,
+					ArtistURL: album.Artist.Url,
 				}
-			}
-			lastAlbum.Scrobbles, _ = strconv.Atoi(album.PlayCount) // nolint: gas
+				for _, image := range album.Images {
+					if image.Size == lastFmTargetImageSize {
+						lastAlbum.ImageURL = image.Url
+					}
+				}
+				lastAlbum.Scrobbles, _ = strconv.Atoi(album.PlayCount) // nolint: gas
 
-			albumsData = append(albumsData, lastAlbum)
-			if len(albumsData) >= limit {
-				break
+				albumsData = append(albumsData, lastAlbum)
+				if len(albumsData) >= limit {
+					break
+				}
 			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return albumsData, nil
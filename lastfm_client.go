@@ -0,0 +1,151 @@
+package dhelpers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Seklfreak/lastfm-go/lastfm"
+	"github.com/go-redis/redis"
+	"github.com/json-iterator/go"
+	"gitlab.com/Cacophony/dhelpers/bucket"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// defines typed errors returned by the LastFm helpers
+var (
+	// ErrLastFmUserNotFound is returned if the requested Last.FM user does not exist
+	ErrLastFmUserNotFound = errors.New("last.fm user not found")
+	// ErrLastFmPrivateProfile is returned if the requested Last.FM user has hidden their recent listening information
+	ErrLastFmPrivateProfile = errors.New("last.fm profile is private")
+	// ErrLastFmRateLimited is returned if Last.FM rejected the request because of too many requests
+	ErrLastFmRateLimited = errors.New("last.fm rate limit exceeded")
+	// ErrLastFmUnavailable is returned if Last.FM is temporarily unavailable, the request can be retried later
+	ErrLastFmUnavailable = errors.New("last.fm is temporarily unavailable")
+)
+
+// Last.FM API error codes, see https://www.last.fm/api/errorcodes
+const (
+	lastFmErrorCodeInvalidParameters    = 6
+	lastFmErrorCodeOperationFailed      = 8
+	lastFmErrorCodeServiceOffline       = 11
+	lastFmErrorCodeTemporaryUnavailable = 16
+	lastFmErrorCodeLoginRequired        = 17
+	lastFmErrorCodeRateLimitExceeded    = 29
+)
+
+// defines how long responses for the different LastFm endpoints are cached
+const (
+	lastFmUserInfoCacheTTL     = 1 * time.Hour
+	lastFmRecentTracksCacheTTL = 30 * time.Second
+	lastFmTopCacheTTL          = 6 * time.Hour
+)
+
+// Last.FM allows up to five requests per second, see https://www.last.fm/api/tos
+// the limit is shared between all instances using redis, if a redis client is available
+var (
+	lastFmLimiter     bucket.Limiter
+	lastFmLimiterOnce sync.Once
+)
+
+func getLastFmLimiter() bucket.Limiter {
+	lastFmLimiterOnce.Do(func() {
+		if client := cache.GetRedisClient(); client != nil {
+			lastFmLimiter = bucket.NewRedisBucket(client, "lastfm", 5)
+			return
+		}
+		lastFmLimiter = bucket.NewBucket(5)
+	})
+	return lastFmLimiter
+}
+
+// IsLastFmTransientErr returns true if a LastFm helper failed because of a temporary issue, the request can be retried later
+func IsLastFmTransientErr(err error) bool {
+	return err == ErrLastFmRateLimited || err == ErrLastFmUnavailable
+}
+
+// lastFmError translates errors received by the Last.FM client into typed errors
+func lastFmError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errL, ok := err.(*lastfm.LastfmError); ok {
+		switch errL.Code {
+		case lastFmErrorCodeInvalidParameters:
+			if strings.Contains(strings.ToLower(errL.Message), "user") {
+				return ErrLastFmUserNotFound
+			}
+		case lastFmErrorCodeLoginRequired:
+			return ErrLastFmPrivateProfile
+		case lastFmErrorCodeRateLimitExceeded:
+			return ErrLastFmRateLimited
+		case lastFmErrorCodeOperationFailed,
+			lastFmErrorCodeServiceOffline,
+			lastFmErrorCodeTemporaryUnavailable:
+			return ErrLastFmUnavailable
+		}
+		return err
+	}
+
+	if IsNetworkErr(err) {
+		return ErrLastFmUnavailable
+	}
+
+	return err
+}
+
+// lastFmCacheKey returns the redis key for a cached Last.FM response
+func lastFmCacheKey(method string, params ...string) (key string) {
+	return "project-d:lastfm:cache:" + method + ":" + GetMD5Hash(strings.Join(params, "\x00"))
+}
+
+// lastFmRequest serves result from the cache if possible
+// if not it waits for the shared ratelimiter, calls request to fill result, and caches result for ttl
+func lastFmRequest(ctx context.Context, key string, ttl time.Duration, result interface{}, request func() error) (err error) {
+	// try to read from cache
+	redisClient := cache.GetRedisClient()
+	if redisClient != nil {
+		var data []byte
+		data, err = redisClient.Get(key).Bytes()
+		if err == nil {
+			err = jsoniter.Unmarshal(data, result)
+			if err == nil {
+				return nil
+			}
+		}
+		if err != redis.Nil {
+			cache.GetLogger().WithField("module", "lastfm").Warnln("error reading cache for", key+":", err.Error())
+		}
+	}
+
+	// wait for ratelimiter
+	if !getLastFmLimiter().Wait(ctx) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrLastFmRateLimited
+	}
+
+	// request data
+	err = request()
+	if err != nil {
+		return lastFmError(err)
+	}
+
+	// cache result
+	if redisClient != nil {
+		var data []byte
+		data, err = jsoniter.Marshal(result)
+		if err == nil {
+			err = redisClient.Set(key, data, ttl).Err()
+		}
+		if err != nil {
+			cache.GetLogger().WithField("module", "lastfm").Warnln("error caching", key+":", err.Error())
+		}
+	}
+
+	return nil
+}
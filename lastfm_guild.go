@@ -0,0 +1,336 @@
+package dhelpers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/json-iterator/go"
+	"github.com/opentracing/opentracing-go"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// lastFmGuildStatsVersion has to be increased whenever the format of the guild stats changes
+const lastFmGuildStatsVersion = "v2"
+
+// lastFmGuildStatsKey returns a versioned redis key for guild stats
+func lastFmGuildStatsKey(kind, guildID string, period LastFmPeriod) (key string) {
+	return "project-d:lastfm:" + lastFmGuildStatsVersion + ":" + kind + ":" + guildID + ":" + string(period)
+}
+
+// lastFmUserTopKey returns the versioned redis key for the top items of a single user
+func lastFmUserTopKey(lastfmUsername string, period LastFmPeriod) (key string) {
+	return "project-d:lastfm:" + lastFmGuildStatsVersion + ":user-top:" + strings.ToLower(lastfmUsername) + ":" + string(period)
+}
+
+// lastFmUserTop contains the top items of a single user, used as the base for the guild stats
+type lastFmUserTop struct {
+	Username string
+	Period   LastFmPeriod
+	Artists  []LastfmArtistData
+	Albums   []LastfmAlbumData
+	Tracks   []LastfmTrackData
+	CachedAt time.Time
+}
+
+// LastFmGuildStatsAggregator computes the guild wide top artists, albums, and tracks for all LastFmPeriods
+// the top items of each user are stored separately, so only outdated users have to be requested on a refresh
+type LastFmGuildStatsAggregator struct {
+	// Limit is the number of top items requested per user, and stored per guild
+	Limit int
+	// MaxAge is the age after which the top items of an user will be requested again
+	MaxAge time.Duration
+}
+
+// NewLastFmGuildStatsAggregator creates a LastFmGuildStatsAggregator with the default settings
+func NewLastFmGuildStatsAggregator() *LastFmGuildStatsAggregator {
+	return &LastFmGuildStatsAggregator{
+		Limit:  100,
+		MaxAge: 24 * time.Hour,
+	}
+}
+
+// Refresh computes and stores the guild stats for all LastFmPeriods
+// guildID		: the guild to compute the stats for
+// usernames	: the linked Last.FM usernames of the guild members
+func (a *LastFmGuildStatsAggregator) Refresh(ctx context.Context, guildID string, usernames []string) (err error) {
+	// start tracing span
+	var span opentracing.Span
+	span, ctx = opentracing.StartSpanFromContext(ctx, "dhelpers.LastFmGuildStatsAggregator.Refresh")
+	defer span.Finish()
+
+	for _, period := range LastFmPeriods {
+		userTops := make([]lastFmUserTop, 0, len(usernames))
+		for _, username := range usernames {
+			var userTop *lastFmUserTop
+			userTop, err = a.userTop(ctx, username, period)
+			if err != nil {
+				return err
+			}
+			if userTop == nil {
+				continue
+			}
+			userTops = append(userTops, *userTop)
+		}
+
+		err = a.store(guildID, period, userTops)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// userTop returns the top items for an user, requests them from Last.FM if not cached or outdated
+// returns nil if the user has not been found, or has a private profile
+func (a *LastFmGuildStatsAggregator) userTop(ctx context.Context, username string, period LastFmPeriod) (userTop *lastFmUserTop, err error) {
+	key := lastFmUserTopKey(username, period)
+
+	// read previous result
+	data, err := cache.GetRedisClient().Get(key).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if err == nil {
+		err = jsoniter.Unmarshal(data, &userTop)
+		if err != nil {
+			return nil, err
+		}
+		if time.Since(userTop.CachedAt) < a.MaxAge {
+			return userTop, nil
+		}
+	}
+
+	// request new result
+	newUserTop := lastFmUserTop{
+		Username: username,
+		Period:   period,
+		CachedAt: time.Now(),
+	}
+	newUserTop.Artists, err = LastFmGetTopArtists(ctx, username, a.Limit, period)
+	if err == nil {
+		newUserTop.Albums, err = LastFmGetTopAlbums(ctx, username, a.Limit, period)
+	}
+	if err == nil {
+		newUserTop.Tracks, err = LastFmGetTopTracks(ctx, username, a.Limit, period)
+	}
+	if err != nil {
+		if err == ErrLastFmUserNotFound || err == ErrLastFmPrivateProfile {
+			return nil, nil
+		}
+		if IsLastFmTransientErr(err) && userTop != nil {
+			// keep outdated result, retry on the next refresh
+			return userTop, nil
+		}
+		return nil, err
+	}
+
+	// store new result, keep it for a while after it got outdated as a fallback
+	data, err = jsoniter.Marshal(newUserTop)
+	if err != nil {
+		return nil, err
+	}
+	err = cache.GetRedisClient().Set(key, data, a.MaxAge*7).Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return &newUserTop, nil
+}
+
+// store aggregates the top items of all users, and stores the guild stats
+func (a *LastFmGuildStatsAggregator) store(guildID string, period LastFmPeriod, userTops []lastFmUserTop) (err error) {
+	now := time.Now()
+
+	artists := make(map[string]*LastfmArtistData)
+	albums := make(map[string]*LastfmAlbumData)
+	tracks := make(map[string]*LastfmTrackData)
+
+	for _, userTop := range userTops {
+		for _, artist := range userTop.Artists {
+			key := strings.ToLower(artist.Name)
+			if _, ok := artists[key]; !ok {
+				newArtist := artist
+				newArtist.Scrobbles = 0
+				newArtist.UserScrobbles = make(map[string]int)
+				artists[key] = &newArtist
+			}
+			artists[key].add(userTop.Username, artist.Scrobbles)
+		}
+		for _, album := range userTop.Albums {
+			key := strings.ToLower(album.Artist + "\x00" + album.Name)
+			if _, ok := albums[key]; !ok {
+				newAlbum := album
+				newAlbum.Scrobbles = 0
+				newAlbum.UserScrobbles = make(map[string]int)
+				albums[key] = &newAlbum
+			}
+			albums[key].add(userTop.Username, album.Scrobbles)
+		}
+		for _, track := range userTop.Tracks {
+			key := strings.ToLower(track.Artist + "\x00" + track.Name)
+			if _, ok := tracks[key]; !ok {
+				newTrack := track
+				newTrack.Scrobbles = 0
+				newTrack.UserScrobbles = make(map[string]int)
+				tracks[key] = &newTrack
+			}
+			tracks[key].add(userTop.Username, track.Scrobbles)
+		}
+	}
+
+	topArtists := LastFmGuildTopArtists{
+		GuildID:       guildID,
+		NumberOfUsers: len(userTops),
+		Period:        period,
+		Artists:       make([]LastfmArtistData, 0, len(artists)),
+		CachedAt:      now,
+	}
+	for _, artist := range artists {
+		topArtists.Artists = append(topArtists.Artists, *artist)
+	}
+	sort.Slice(topArtists.Artists, func(i, j int) bool {
+		return lastFmGuildLess(topArtists.Artists[i].Scrobbles, topArtists.Artists[j].Scrobbles, topArtists.Artists[i].Users, topArtists.Artists[j].Users)
+	})
+	if len(topArtists.Artists) > a.Limit {
+		topArtists.Artists = topArtists.Artists[:a.Limit]
+	}
+
+	topAlbums := LastFmGuildTopAlbums{
+		GuildID:       guildID,
+		NumberOfUsers: len(userTops),
+		Period:        period,
+		Albums:        make([]LastfmAlbumData, 0, len(albums)),
+		CachedAt:      now,
+	}
+	for _, album := range albums {
+		topAlbums.Albums = append(topAlbums.Albums, *album)
+	}
+	sort.Slice(topAlbums.Albums, func(i, j int) bool {
+		return lastFmGuildLess(topAlbums.Albums[i].Scrobbles, topAlbums.Albums[j].Scrobbles, topAlbums.Albums[i].Users, topAlbums.Albums[j].Users)
+	})
+	if len(topAlbums.Albums) > a.Limit {
+		topAlbums.Albums = topAlbums.Albums[:a.Limit]
+	}
+
+	topTracks := LastFmGuildTopTracks{
+		GuildID:       guildID,
+		NumberOfUsers: len(userTops),
+		Period:        period,
+		Tracks:        make([]LastfmTrackData, 0, len(tracks)),
+		CachedAt:      now,
+	}
+	for _, track := range tracks {
+		topTracks.Tracks = append(topTracks.Tracks, *track)
+	}
+	sort.Slice(topTracks.Tracks, func(i, j int) bool {
+		return lastFmGuildLess(topTracks.Tracks[i].Scrobbles, topTracks.Tracks[j].Scrobbles, topTracks.Tracks[i].Users, topTracks.Tracks[j].Users)
+	})
+	if len(topTracks.Tracks) > a.Limit {
+		topTracks.Tracks = topTracks.Tracks[:a.Limit]
+	}
+
+	// store all results at once
+	pipe := cache.GetRedisClient().TxPipeline()
+	for key, value := range map[string]interface{}{
+		LastFmGuildTopArtistsKey(guildID, period): topArtists,
+		LastFmGuildTopAlbumsKey(guildID, period):  topAlbums,
+		LastFmGuildTopTracksKey(guildID, period):  topTracks,
+	} {
+		var data []byte
+		data, err = jsoniter.Marshal(value)
+		if err != nil {
+			return err
+		}
+		pipe.Set(key, data, 0)
+	}
+	_, err = pipe.Exec()
+	return err
+}
+
+func (d *LastfmArtistData) add(username string, scrobbles int) {
+	d.Scrobbles += scrobbles
+	d.UserScrobbles[username] += scrobbles
+	d.Users = len(d.UserScrobbles)
+}
+
+func (d *LastfmAlbumData) add(username string, scrobbles int) {
+	d.Scrobbles += scrobbles
+	d.UserScrobbles[username] += scrobbles
+	d.Users = len(d.UserScrobbles)
+}
+
+func (d *LastfmTrackData) add(username string, scrobbles int) {
+	d.Scrobbles += scrobbles
+	d.UserScrobbles[username] += scrobbles
+	d.Users = len(d.UserScrobbles)
+}
+
+// lastFmGuildLess sorts by scrobbles, and by number of users if the scrobbles are equal
+func lastFmGuildLess(scrobblesI, scrobblesJ, usersI, usersJ int) bool {
+	if scrobblesI != scrobblesJ {
+		return scrobblesI > scrobblesJ
+	}
+	return usersI > usersJ
+}
+
+// LastFmGetGuildTopArtists returns the cached top artists for a guild, returns redis.Nil if they have not been computed yet
+func LastFmGetGuildTopArtists(guildID string, period LastFmPeriod) (topArtists LastFmGuildTopArtists, err error) {
+	err = readLastFmGuildStats(LastFmGuildTopArtistsKey(guildID, period), &topArtists)
+	return topArtists, err
+}
+
+// LastFmGetGuildTopAlbums returns the cached top albums for a guild, returns redis.Nil if they have not been computed yet
+func LastFmGetGuildTopAlbums(guildID string, period LastFmPeriod) (topAlbums LastFmGuildTopAlbums, err error) {
+	err = readLastFmGuildStats(LastFmGuildTopAlbumsKey(guildID, period), &topAlbums)
+	return topAlbums, err
+}
+
+// LastFmGetGuildTopTracks returns the cached top tracks for a guild, returns redis.Nil if they have not been computed yet
+func LastFmGetGuildTopTracks(guildID string, period LastFmPeriod) (topTracks LastFmGuildTopTracks, err error) {
+	err = readLastFmGuildStats(LastFmGuildTopTracksKey(guildID, period), &topTracks)
+	return topTracks, err
+}
+
+func readLastFmGuildStats(key string, result interface{}) (err error) {
+	data, err := cache.GetRedisClient().Get(key).Bytes()
+	if err != nil {
+		return err
+	}
+
+	return jsoniter.Unmarshal(data, result)
+}
+
+// LastFmGuildStatsJob returns a Job which refreshes the guild stats for all guilds returned by guilds
+// guilds has to return the linked Last.FM usernames of the members of each guild, by guild ID
+// the Scheduler holds the Job lock while it runs, errors of single guilds are reported without stopping the Job
+func LastFmGuildStatsJob(name, cron string, aggregator *LastFmGuildStatsAggregator, guilds func(ctx context.Context) (map[string][]string, error)) Job {
+	return Job{
+		Name:        name,
+		Cron:        cron,
+		LockTimeout: 15 * time.Minute,
+		Run: func(ctx context.Context) (err error) {
+			usernamesByGuild, err := guilds(ctx)
+			if err != nil {
+				return err
+			}
+
+			for guildID, usernames := range usernamesByGuild {
+				// stop if the Job lost its lock, or the Scheduler stopped
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				err = aggregator.Refresh(ctx, guildID, usernames)
+				if err != nil {
+					HandleJobErrorWith("Worker", name, err)
+				}
+			}
+
+			return nil
+		},
+	}
+}
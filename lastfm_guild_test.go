@@ -0,0 +1,160 @@
+package dhelpers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/json-iterator/go"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// seedLastFmUserTops caches the top items of an user for all periods, so Refresh does not request Last.FM
+// tops contains the top items by period, periods without an entry are cached empty
+func seedLastFmUserTops(t *testing.T, username string, tops map[LastFmPeriod]lastFmUserTop) {
+	for _, period := range LastFmPeriods {
+		userTop := tops[period]
+		userTop.Username = username
+		userTop.Period = period
+		userTop.CachedAt = time.Now()
+
+		data, err := jsoniter.Marshal(userTop)
+		if err != nil {
+			t.Fatal("Expected no error, got ", err)
+		}
+		err = cache.GetRedisClient().Set(lastFmUserTopKey(username, period), data, time.Hour).Err()
+		if err != nil {
+			t.Fatal("Expected no error, got ", err)
+		}
+	}
+}
+
+func TestLastFmGuildStatsAggregator_Refresh(t *testing.T) {
+	prefix := "test" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	guildID := prefix + "guild"
+	userA, userB, userC := prefix+"a", prefix+"b", prefix+"c"
+
+	seedLastFmUserTops(t, userA, map[LastFmPeriod]lastFmUserTop{
+		LastFmPeriodOverall: {
+			Artists: []LastfmArtistData{{Name: "Artist 1", Scrobbles: 10}, {Name: "Artist 2", Scrobbles: 5}},
+			Albums:  []LastfmAlbumData{{Name: "Album", Artist: "Artist 1", Scrobbles: 8}},
+			Tracks:  []LastfmTrackData{{Name: "Track", Artist: "Artist 1", Scrobbles: 3}},
+		},
+		LastFmPeriod7day: {
+			Artists: []LastfmArtistData{{Name: "Artist 3", Scrobbles: 2}},
+		},
+	})
+	seedLastFmUserTops(t, userB, map[LastFmPeriod]lastFmUserTop{
+		LastFmPeriodOverall: {
+			// names are matched case insensitive
+			Artists: []LastfmArtistData{{Name: "artist 2", Scrobbles: 5}, {Name: "Artist 4", Scrobbles: 1}},
+			Albums:  []LastfmAlbumData{{Name: "Album", Artist: "Artist 2", Scrobbles: 9}},
+			Tracks:  []LastfmTrackData{{Name: "TRACK", Artist: "artist 1", Scrobbles: 4}},
+		},
+	})
+	seedLastFmUserTops(t, userC, map[LastFmPeriod]lastFmUserTop{
+		LastFmPeriodOverall: {
+			Artists: []LastfmArtistData{{Name: "Artist 5", Scrobbles: 10}},
+		},
+	})
+
+	aggregator := NewLastFmGuildStatsAggregator()
+	aggregator.Limit = 3
+	err := aggregator.Refresh(context.Background(), guildID, []string{userA, userB, userC})
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	// ranking: by scrobbles, equal scrobbles are ranked by number of users, limited to the top 3
+	topArtists, err := LastFmGetGuildTopArtists(guildID, LastFmPeriodOverall)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	if topArtists.NumberOfUsers != 3 || len(topArtists.Artists) != 3 {
+		t.Fatal("Expected 3 users and 3 artists, got ", topArtists.NumberOfUsers, topArtists.Artists)
+	}
+	artist := topArtists.Artists[0]
+	if artist.Name != "Artist 2" || artist.Scrobbles != 10 || artist.Users != 2 || artist.UserScrobbles[userB] != 5 {
+		t.Error("Expected Artist 2 with 10 scrobbles by 2 users first, got ", artist)
+	}
+	for _, artist := range topArtists.Artists[1:] {
+		if artist.Scrobbles != 10 || artist.Users != 1 {
+			t.Error("Expected Artist 1 and Artist 5 with 10 scrobbles by 1 user, got ", artist)
+		}
+		if artist.Name == "Artist 4" {
+			t.Error("Expected Artist 4 to be cut off by the limit")
+		}
+	}
+
+	// albums of different artists with the same name are different albums
+	topAlbums, err := LastFmGetGuildTopAlbums(guildID, LastFmPeriodOverall)
+	if err != nil || len(topAlbums.Albums) != 2 || topAlbums.Albums[0].Artist != "Artist 2" {
+		t.Error("Expected 2 albums with the album of Artist 2 first, got ", topAlbums.Albums, err)
+	}
+
+	topTracks, err := LastFmGetGuildTopTracks(guildID, LastFmPeriodOverall)
+	if err != nil || len(topTracks.Tracks) != 1 || topTracks.Tracks[0].Scrobbles != 7 || topTracks.Tracks[0].Users != 2 {
+		t.Error("Expected 1 track with 7 scrobbles by 2 users, got ", topTracks.Tracks, err)
+	}
+
+	// periods are aggregated separately
+	topArtists, err = LastFmGetGuildTopArtists(guildID, LastFmPeriod7day)
+	if err != nil || len(topArtists.Artists) != 1 || topArtists.Artists[0].Name != "Artist 3" {
+		t.Error("Expected only Artist 3 for 7day, got ", topArtists.Artists, err)
+	}
+	topArtists, err = LastFmGetGuildTopArtists(guildID, LastFmPeriod1month)
+	if err != nil || len(topArtists.Artists) != 0 || topArtists.NumberOfUsers != 3 {
+		t.Error("Expected no artists of 3 users for 1month, got ", topArtists, err)
+	}
+}
+
+func TestLastFmGuildStatsAggregator_RefreshEmptyGuild(t *testing.T) {
+	guildID := "test" + strconv.FormatInt(time.Now().UnixNano(), 10) + "guild"
+
+	err := NewLastFmGuildStatsAggregator().Refresh(context.Background(), guildID, nil)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	for _, period := range LastFmPeriods {
+		topArtists, err := LastFmGetGuildTopArtists(guildID, period)
+		if err != nil || topArtists.NumberOfUsers != 0 || len(topArtists.Artists) != 0 {
+			t.Error("Expected empty stats for ", period, ", got ", topArtists, err)
+		}
+		topTracks, err := LastFmGetGuildTopTracks(guildID, period)
+		if err != nil || len(topTracks.Tracks) != 0 {
+			t.Error("Expected no tracks for ", period, ", got ", topTracks, err)
+		}
+	}
+}
+
+func TestLastFmGuildStatsJob(t *testing.T) {
+	prefix := "test" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	guildID := prefix + "guild"
+	seedLastFmUserTops(t, prefix+"a", map[LastFmPeriod]lastFmUserTop{
+		LastFmPeriodOverall: {Artists: []LastfmArtistData{{Name: "Artist", Scrobbles: 1}}},
+	})
+
+	scheduler, err := NewScheduler([]Job{LastFmGuildStatsJob(
+		prefix+":guild-stats", "",
+		NewLastFmGuildStatsAggregator(),
+		func(ctx context.Context) (map[string][]string, error) {
+			return map[string][]string{guildID: {prefix + "a"}}, nil
+		},
+	)})
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	scheduler.ErrorHandlers = []ErrorHandlerType{LogErrorHandler}
+
+	scheduler.run(scheduler.jobs[0])
+
+	if scheduler.Status()[0].LastOutcome != JobOutcomeSuccess {
+		t.Error("Expected successful run, got ", scheduler.Status()[0])
+	}
+	topArtists, err := LastFmGetGuildTopArtists(guildID, LastFmPeriodOverall)
+	if err != nil || len(topArtists.Artists) != 1 {
+		t.Error("Expected the job to compute the guild stats, got ", topArtists, err)
+	}
+}
@@ -0,0 +1,276 @@
+package dhelpers
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"gitlab.com/Cacophony/dhelpers/models"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+	"gitlab.com/Cacophony/dhelpers/state"
+)
+
+// LastFmLinkUser links a Discord User to a Last.FM User, replaces previous links
+// returns ErrLastFmUserNotFound if the Last.FM User does not exist
+func LastFmLinkUser(ctx context.Context, userID, lastfmUsername string) (link models.LastFmLink, err error) {
+	// make sure user exists, and gather correct spelling
+	userInfo, err := LastFmGetUserinfo(ctx, lastfmUsername)
+	if err != nil {
+		return link, err
+	}
+
+	// gather previous link, scrobbles of a different previous account will be removed
+	previousLink, err := LastFmGetLink(ctx, userID)
+	if err != nil && err != mongo.ErrNotFound {
+		return link, err
+	}
+	link = models.LastFmLink{
+		UserID:   userID,
+		Username: userInfo.Username,
+		LinkedAt: time.Now(),
+	}
+	if err == nil {
+		// keep privacy settings
+		link.Privacy = previousLink.Privacy
+
+		if previousLink.Username == userInfo.Username {
+			// continue import
+			link.LastScrobbleAt = previousLink.LastScrobbleAt
+			link.SyncedAt = previousLink.SyncedAt
+		} else {
+			err = lastFmDeleteScrobbles(ctx, userID)
+			if err != nil {
+				return link, err
+			}
+		}
+	}
+
+	err = models.LastFmLinkRepository.Upsert(
+		ctx,
+		map[string]string{"userid": userID},
+		map[string]interface{}{"$set": link},
+	)
+	return link, err
+}
+
+// LastFmUnlinkUser removes the Last.FM link of a Discord User, and all imported scrobbles
+// returns mongo.ErrNotFound if the user has not been linked
+func LastFmUnlinkUser(ctx context.Context, userID string) (err error) {
+	err = models.LastFmLinkRepository.Delete(ctx, map[string]string{"userid": userID})
+	if err != nil {
+		return err
+	}
+
+	return lastFmDeleteScrobbles(ctx, userID)
+}
+
+// LastFmGetLink returns the Last.FM link of a Discord User
+// returns mongo.ErrNotFound if the user has not been linked
+func LastFmGetLink(ctx context.Context, userID string) (link models.LastFmLink, err error) {
+	err = models.LastFmLinkRepository.FindOne(ctx, map[string]string{"userid": userID}, &link)
+	return link, err
+}
+
+// LastFmSetPrivacy updates the privacy settings of a Last.FM link
+// if the history gets disabled all imported scrobbles will be removed
+// returns mongo.ErrNotFound if the user has not been linked
+func LastFmSetPrivacy(ctx context.Context, userID string, privacy models.LastFmPrivacy) (err error) {
+	err = models.LastFmLinkRepository.Update(
+		ctx,
+		map[string]string{"userid": userID},
+		map[string]map[string]interface{}{"$set": {"privacy": privacy}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if privacy.DisableHistory {
+		return lastFmDeleteScrobbles(ctx, userID)
+	}
+	return nil
+}
+
+// LastFmGuildUsernames returns the linked Last.FM usernames of all members of a guild, by Discord User ID
+// users who hide themselves from guild stats are skipped
+func LastFmGuildUsernames(ctx context.Context, guildID string) (usernames map[string]string, err error) {
+	userIDs, err := state.GuildUserIDs(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []models.LastFmLink
+	err = models.LastFmLinkRepository.Find(
+		ctx,
+		map[string]interface{}{
+			"userid":                     map[string][]string{"$in": userIDs},
+			"privacy.hidefromguildstats": false,
+		},
+		&links,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	usernames = make(map[string]string)
+	for _, link := range links {
+		usernames[link.UserID] = link.Username
+	}
+	return usernames, nil
+}
+
+// LastFmSyncScrobbles imports all scrobbles of a linked user since the last import
+// the oldest scrobbles are imported first, so an interrupted import can be continued
+func LastFmSyncScrobbles(ctx context.Context, link models.LastFmLink) (imported int, err error) {
+	// start tracing span
+	var span opentracing.Span
+	span, ctx = opentracing.StartSpanFromContext(ctx, "dhelpers.LastFmSyncScrobbles")
+	defer span.Finish()
+
+	if link.Privacy.DisableHistory {
+		return 0, nil
+	}
+
+	since := link.LastScrobbleAt
+
+	// gather number of pages
+	_, totalPages, err := LastFmGetRecentTracksSince(ctx, link.Username, since, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	// import pages, oldest first
+	for page := totalPages; page >= 1; page-- {
+		var tracks []LastfmTrackData
+		tracks, _, err = LastFmGetRecentTracksSince(ctx, link.Username, since, page)
+		if err != nil {
+			return imported, err
+		}
+
+		for i := len(tracks) - 1; i >= 0; i-- {
+			scrobble := models.LastFmScrobble{
+				UserID:    link.UserID,
+				Username:  link.Username,
+				Track:     tracks[i].Name,
+				TrackURL:  tracks[i].URL,
+				Artist:    tracks[i].Artist,
+				ArtistURL: tracks[i].ArtistURL,
+				Album:     tracks[i].Album,
+				Time:      tracks[i].Time,
+			}
+
+			// upsert to prevent duplicates if pages shifted during the import
+			err = models.LastFmScrobbleRepository.Upsert(
+				ctx,
+				map[string]interface{}{
+					"userid": scrobble.UserID,
+					"time":   scrobble.Time,
+					"artist": scrobble.Artist,
+					"track":  scrobble.Track,
+				},
+				map[string]interface{}{"$set": scrobble},
+			)
+			if err != nil {
+				return imported, err
+			}
+			imported++
+
+			if scrobble.Time.After(link.LastScrobbleAt) {
+				link.LastScrobbleAt = scrobble.Time
+			}
+		}
+
+		// store progress
+		err = models.LastFmLinkRepository.Update(
+			ctx,
+			map[string]string{"userid": link.UserID},
+			map[string]map[string]interface{}{"$set": {
+				"lastscrobbleat": link.LastScrobbleAt,
+				"syncedat":       time.Now(),
+			}},
+		)
+		if err != nil && err != mongo.ErrNotFound {
+			return imported, err
+		}
+	}
+
+	return imported, nil
+}
+
+// LastFmScrobbles returns the imported scrobbles of an user between from and to
+func LastFmScrobbles(ctx context.Context, userID string, from, to time.Time) (scrobbles []models.LastFmScrobble, err error) {
+	err = models.LastFmScrobbleRepository.Find(
+		ctx,
+		map[string]interface{}{
+			"userid": userID,
+			"time":   map[string]time.Time{"$gte": from, "$lt": to},
+		},
+		&scrobbles,
+	)
+	return scrobbles, err
+}
+
+// LastFmFirstScrobble returns the first imported scrobble of an artist, or of a track if track is set
+// returns mongo.ErrNotFound if the user never played the artist or track
+func LastFmFirstScrobble(ctx context.Context, userID, artist, track string) (first models.LastFmScrobble, err error) {
+	filter := map[string]string{
+		"userid": userID,
+		"artist": artist,
+	}
+	if track != "" {
+		filter["track"] = track
+	}
+
+	var scrobbles []models.LastFmScrobble
+	err = models.LastFmScrobbleRepository.FindWithOptions(
+		ctx,
+		filter,
+		mongo.FindOptions{Sort: []mongo.SortField{{Field: "time"}}, Limit: 1},
+		&scrobbles,
+	)
+	if err != nil {
+		return first, err
+	}
+	if len(scrobbles) <= 0 {
+		return first, mongo.ErrNotFound
+	}
+
+	return scrobbles[0], nil
+}
+
+func lastFmDeleteScrobbles(ctx context.Context, userID string) (err error) {
+	_, err = models.LastFmScrobbleRepository.DeleteMany(ctx, map[string]string{"userid": userID})
+	return err
+}
+
+// LastFmScrobbleSyncJob returns a Job which imports the scrobble history of all linked users
+// the Job runs under the Scheduler lock, which is renewed while the import is running
+func LastFmScrobbleSyncJob(name, cron string) Job {
+	return Job{
+		Name:        name,
+		Cron:        cron,
+		LockTimeout: 15 * time.Minute,
+		Run: func(ctx context.Context) (err error) {
+			var links []models.LastFmLink
+			err = models.LastFmLinkRepository.Find(ctx, map[string]bool{"privacy.disablehistory": false}, &links)
+			if err != nil {
+				return err
+			}
+
+			for _, link := range links {
+				// stop if the Job lost its lock, or the Scheduler stopped
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				_, err = LastFmSyncScrobbles(ctx, link)
+				if err != nil &&
+					err != ErrLastFmUserNotFound &&
+					err != ErrLastFmPrivateProfile {
+					HandleJobErrorWith("Worker", name, err)
+				}
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,255 @@
+package dhelpers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/lastfm-go/lastfm"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"gitlab.com/Cacophony/dhelpers/models"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+)
+
+// lastFmHistoryStub serves user.getInfo and user.getRecentTracks for users with a scrobble history
+type lastFmHistoryStub struct {
+	scrobbles map[string][]int64 // unix timestamps by username
+	pageSize  int
+	sync.Mutex
+}
+
+func (s *lastFmHistoryStub) add(username string, timestamps ...int64) {
+	s.Lock()
+	defer s.Unlock()
+	s.scrobbles[username] = append(s.scrobbles[username], timestamps...)
+}
+
+func (s *lastFmHistoryStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	query := r.URL.Query()
+	username := query.Get("user")
+	timestamps, ok := s.scrobbles[username]
+	w.Header().Set("Content-Type", "text/xml")
+	if !ok {
+		w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<lfm status="failed"><error code="6">User not found</error></lfm>`)) // nolint: errcheck
+		return
+	}
+
+	if strings.ToLower(query.Get("method")) == "user.getinfo" {
+		w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<lfm status="ok"><user><name>` + username + `</name><playcount>` + strconv.Itoa(len(timestamps)) + `</playcount></user></lfm>`)) // nolint: errcheck
+		return
+	}
+
+	// recent tracks since from, newest first
+	from, _ := strconv.ParseInt(query.Get("from"), 10, 64)
+	var matching []int64
+	for _, timestamp := range timestamps {
+		if timestamp >= from {
+			matching = append(matching, timestamp)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i] > matching[j] })
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	totalPages := (len(matching) + s.pageSize - 1) / s.pageSize
+	var tracks string
+	for i := (page - 1) * s.pageSize; i < page*s.pageSize && i < len(matching); i++ {
+		uts := strconv.FormatInt(matching[i], 10)
+		tracks += `<track><artist><name>Artist</name><url>https://www.last.fm/music/Artist</url></artist>` +
+			`<name>Track ` + uts + `</name><album mbid="">Album</album><url>https://www.last.fm/music/Artist/_/Track</url>` +
+			`<date uts="` + uts + `">` + uts + `</date></track>`
+	}
+	w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<lfm status="ok"><recenttracks user="` + username + `" page="` + strconv.Itoa(page) + `" perPage="` + strconv.Itoa(s.pageSize) +
+		`" totalPages="` + strconv.Itoa(totalPages) + `" total="` + strconv.Itoa(len(matching)) + `">` + tracks + `</recenttracks></lfm>`)) // nolint: errcheck
+}
+
+func startLastFmHistoryStub(t *testing.T) (stub *lastFmHistoryStub, stop func()) {
+	stub = &lastFmHistoryStub{scrobbles: make(map[string][]int64), pageSize: 2}
+	server := httptest.NewServer(stub)
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousTransport := http.DefaultTransport
+	http.DefaultTransport = stubTransport{target: target, next: previousTransport}
+	cache.SetLastfFm(lastfm.New("stubkey", "stubsecret"))
+
+	return stub, func() {
+		http.DefaultTransport = previousTransport
+		server.Close()
+	}
+}
+
+func countLastFmScrobbles(t *testing.T, userID string) int64 {
+	count, err := models.LastFmScrobbleRepository.Count(context.Background(), map[string]string{"userid": userID})
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	return count
+}
+
+func TestLastFmLinkUser(t *testing.T) {
+	skipWithoutMongo(t)
+
+	stub, stop := startLastFmHistoryStub(t)
+	defer stop()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	userID := "user" + suffix
+	usernameA, usernameB := "linka"+suffix, "linkb"+suffix
+	stub.add(usernameA, 100, 200)
+	stub.add(usernameB, 300)
+	defer LastFmUnlinkUser(context.Background(), userID) // nolint: errcheck
+
+	_, err := LastFmLinkUser(context.Background(), userID, "missing"+suffix)
+	if err != ErrLastFmUserNotFound {
+		t.Error("Expected ErrLastFmUserNotFound, got ", err)
+	}
+
+	link, err := LastFmLinkUser(context.Background(), userID, usernameA)
+	if err != nil || link.Username != usernameA {
+		t.Fatal("Expected link to ", usernameA, ", got ", link, err)
+	}
+	_, err = LastFmSyncScrobbles(context.Background(), link)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	// linking the same account again keeps the import progress and the scrobbles
+	link, err = LastFmLinkUser(context.Background(), userID, usernameA)
+	if err != nil || link.LastScrobbleAt.Unix() != 200 {
+		t.Error("Expected import progress to be kept, got ", link.LastScrobbleAt, err)
+	}
+	if count := countLastFmScrobbles(t, userID); count != 2 {
+		t.Error("Expected 2 scrobbles, got ", count)
+	}
+
+	// linking another account removes the scrobbles of the previous account
+	link, err = LastFmLinkUser(context.Background(), userID, usernameB)
+	if err != nil || link.Username != usernameB || !link.LastScrobbleAt.IsZero() {
+		t.Error("Expected new link without import progress, got ", link, err)
+	}
+	if count := countLastFmScrobbles(t, userID); count != 0 {
+		t.Error("Expected scrobbles to be removed, got ", count)
+	}
+
+	err = LastFmUnlinkUser(context.Background(), userID)
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	_, err = LastFmGetLink(context.Background(), userID)
+	if err != mongo.ErrNotFound {
+		t.Error("Expected link to be removed, got ", err)
+	}
+	err = LastFmUnlinkUser(context.Background(), userID)
+	if err != mongo.ErrNotFound {
+		t.Error("Expected ErrNotFound for unlinked user, got ", err)
+	}
+}
+
+func TestLastFmSyncScrobbles(t *testing.T) {
+	skipWithoutMongo(t)
+
+	stub, stop := startLastFmHistoryStub(t)
+	defer stop()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	userID := "user" + suffix
+	username := "sync" + suffix
+	stub.add(username, 100, 200, 300)
+	defer LastFmUnlinkUser(context.Background(), userID) // nolint: errcheck
+
+	link, err := LastFmLinkUser(context.Background(), userID, username)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	// the history has two pages, the oldest scrobbles are imported first
+	imported, err := LastFmSyncScrobbles(context.Background(), link)
+	if err != nil || imported != 3 {
+		t.Error("Expected 3 imported scrobbles, got ", imported, err)
+	}
+	link, err = LastFmGetLink(context.Background(), userID)
+	if err != nil || link.LastScrobbleAt.Unix() != 300 || link.SyncedAt.IsZero() {
+		t.Error("Expected progress at 300, got ", link.LastScrobbleAt, link.SyncedAt, err)
+	}
+
+	// resume from the last stored scrobble
+	stub.add(username, 400, 500)
+	imported, err = LastFmSyncScrobbles(context.Background(), link)
+	if err != nil || imported != 2 {
+		t.Error("Expected 2 new imported scrobbles, got ", imported, err)
+	}
+
+	// importing scrobbles again, for example after an interrupted import, does not create duplicates
+	link.LastScrobbleAt = time.Time{}
+	_, err = LastFmSyncScrobbles(context.Background(), link)
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	if count := countLastFmScrobbles(t, userID); count != 5 {
+		t.Error("Expected 5 scrobbles without duplicates, got ", count)
+	}
+
+	scrobbles, err := LastFmScrobbles(context.Background(), userID, time.Unix(200, 0), time.Unix(400, 0))
+	if err != nil || len(scrobbles) != 2 || scrobbles[0].Artist != "Artist" {
+		t.Error("Expected scrobbles at 200 and 300, got ", scrobbles, err)
+	}
+
+	// disabled history is not imported
+	link.Privacy.DisableHistory = true
+	imported, err = LastFmSyncScrobbles(context.Background(), link)
+	if err != nil || imported != 0 {
+		t.Error("Expected no import for disabled history, got ", imported, err)
+	}
+}
+
+func TestLastFmScrobbleSyncJob(t *testing.T) {
+	skipWithoutMongo(t)
+
+	stub, stop := startLastFmHistoryStub(t)
+	defer stop()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	userID := "user" + suffix
+	username := "job" + suffix
+	stub.add(username, 100)
+	defer LastFmUnlinkUser(context.Background(), userID) // nolint: errcheck
+
+	_, err := LastFmLinkUser(context.Background(), userID, username)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	scheduler, err := NewScheduler([]Job{LastFmScrobbleSyncJob("test:scrobble-sync:"+suffix, "")})
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	scheduler.ErrorHandlers = []ErrorHandlerType{LogErrorHandler}
+
+	scheduler.run(scheduler.jobs[0])
+
+	if scheduler.Status()[0].LastOutcome != JobOutcomeSuccess {
+		t.Error("Expected successful run, got ", scheduler.Status()[0])
+	}
+	if count := countLastFmScrobbles(t, userID); count != 1 {
+		t.Error("Expected the job to import 1 scrobble, got ", count)
+	}
+}
@@ -0,0 +1,125 @@
+package dhelpers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Seklfreak/lastfm-go/lastfm"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// stubTransport redirects all requests to a local stub server
+type stubTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t stubTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request.URL.Scheme = t.target.Scheme
+	request.URL.Host = t.target.Host
+	return t.next.RoundTrip(request)
+}
+
+func startLastFmStub(t *testing.T) (requests *int64, stop func()) {
+	requests = new(int64)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(requests, 1)
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch r.URL.Query().Get("user") {
+		case "stubuser":
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<lfm status="ok"><user><name>stubuser</name><realname>Stub User</realname><country>Germany</country>` +
+				`<playcount>1337</playcount><registered unixtime="1262304000">2010-01-01 00:00</registered></user></lfm>`)) // nolint: errcheck
+		case "stubprivate":
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<lfm status="failed"><error code="17">Login: User required to be logged in</error></lfm>`)) // nolint: errcheck
+		case "stubratelimited":
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<lfm status="failed"><error code="29">Rate Limit Exceeded</error></lfm>`)) // nolint: errcheck
+		case "stuboffline":
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<lfm status="failed"><error code="16">There was a temporary error processing your request</error></lfm>`)) // nolint: errcheck
+		default:
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<lfm status="failed"><error code="6">User not found</error></lfm>`)) // nolint: errcheck
+		}
+	}))
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousTransport := http.DefaultTransport
+	http.DefaultTransport = stubTransport{target: target, next: previousTransport}
+	cache.SetLastfFm(lastfm.New("stubkey", "stubsecret"))
+
+	return requests, func() {
+		http.DefaultTransport = previousTransport
+		server.Close()
+	}
+}
+
+func TestLastFmGetUserinfo(t *testing.T) {
+	requests, stop := startLastFmStub(t)
+	defer stop()
+
+	cache.GetRedisClient().Del(lastFmCacheKey("user.getInfo", "stubuser")) // nolint: errcheck
+
+	v, err := LastFmGetUserinfo(context.Background(), "stubuser")
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	if v.Name != "Stub User" {
+		t.Error("Expected Stub User, got ", v.Name)
+	}
+	if v.Scrobbles != 1337 {
+		t.Error("Expected 1337, got ", v.Scrobbles)
+	}
+	if v.AccountCreation.Unix() != 1262304000 {
+		t.Error("Expected 1262304000, got ", v.AccountCreation.Unix())
+	}
+
+	// second request should be served from the cache
+	v, err = LastFmGetUserinfo(context.Background(), "stubuser")
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	if v.Scrobbles != 1337 {
+		t.Error("Expected 1337, got ", v.Scrobbles)
+	}
+	if atomic.LoadInt64(requests) != 1 {
+		t.Error("Expected 1 request, got ", atomic.LoadInt64(requests))
+	}
+}
+
+func TestLastFmErrors(t *testing.T) {
+	_, stop := startLastFmStub(t)
+	defer stop()
+
+	_, err := LastFmGetUserinfo(context.Background(), "stubnotfound")
+	if err != ErrLastFmUserNotFound {
+		t.Error("Expected ErrLastFmUserNotFound, got ", err)
+	}
+	_, err = LastFmGetRecentTracks(context.Background(), "stubprivate", 10)
+	if err != ErrLastFmPrivateProfile {
+		t.Error("Expected ErrLastFmPrivateProfile, got ", err)
+	}
+	_, err = LastFmGetTopArtists(context.Background(), "stubratelimited", 10, LastFmPeriodOverall)
+	if err != ErrLastFmRateLimited {
+		t.Error("Expected ErrLastFmRateLimited, got ", err)
+	}
+	_, err = LastFmGetTopTracks(context.Background(), "stuboffline", 10, LastFmPeriodOverall)
+	if err != ErrLastFmUnavailable {
+		t.Error("Expected ErrLastFmUnavailable, got ", err)
+	}
+	if !IsLastFmTransientErr(err) {
+		t.Error("Expected ErrLastFmUnavailable to be transient")
+	}
+}
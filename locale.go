@@ -0,0 +1,208 @@
+package dhelpers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"gitlab.com/Cacophony/dhelpers/models"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is the locale used if neither the user nor the guild set a locale
+const DefaultLocale = "en"
+
+// localeCacheExpiry is the duration locales are cached in redis
+const localeCacheExpiry = 24 * time.Hour
+
+// eventLocalesExpiry is the duration the resolved locales of an event are cached in memory
+const eventLocalesExpiry = time.Minute
+
+// eventLocalesPruneSize is the number of cached event locales after which expired entries are removed
+const eventLocalesPruneSize = 1000
+
+// ErrInvalidLocale is used when a locale is not a valid BCP 47 language tag
+var ErrInvalidLocale = errors.New("invalid locale")
+
+func guildLocaleKey(guildID string) (key string) {
+	return "project-d:locale:guild:" + guildID
+}
+
+func userLocaleKey(userID string) (key string) {
+	return "project-d:locale:user:" + userID
+}
+
+// SetGuildLocale overrides the locale of a guild
+// locale	: a BCP 47 language tag, example: de
+func SetGuildLocale(ctx context.Context, guildID, locale string) (err error) {
+	return setLocale(ctx, map[string]string{"guildid": guildID, "userid": ""}, guildLocaleKey(guildID), locale)
+}
+
+// ResetGuildLocale removes the locale override of a guild, the guild will use the DefaultLocale
+func ResetGuildLocale(ctx context.Context, guildID string) (err error) {
+	return resetLocale(ctx, map[string]string{"guildid": guildID, "userid": ""}, guildLocaleKey(guildID))
+}
+
+// GetGuildLocale returns the locale of a guild, returns an empty string if no locale has been set
+func GetGuildLocale(ctx context.Context, guildID string) (locale string, err error) {
+	return getLocale(ctx, map[string]string{"guildid": guildID, "userid": ""}, guildLocaleKey(guildID))
+}
+
+// SetUserLocale sets the locale of an user, which will be preferred to the guild locale
+// locale	: a BCP 47 language tag, example: de
+func SetUserLocale(ctx context.Context, userID, locale string) (err error) {
+	return setLocale(ctx, map[string]string{"guildid": "", "userid": userID}, userLocaleKey(userID), locale)
+}
+
+// ResetUserLocale removes the locale of an user, the user will use the guild locale
+func ResetUserLocale(ctx context.Context, userID string) (err error) {
+	return resetLocale(ctx, map[string]string{"guildid": "", "userid": userID}, userLocaleKey(userID))
+}
+
+// GetUserLocale returns the locale of an user, returns an empty string if no locale has been set
+func GetUserLocale(ctx context.Context, userID string) (locale string, err error) {
+	return getLocale(ctx, map[string]string{"guildid": "", "userid": userID}, userLocaleKey(userID))
+}
+
+// Locales returns the locales to use for the event, by priority
+// the chain is: user locale → guild locale → DefaultLocale
+// the locales are resolved once per event, and cached by the event key
+// returns only the DefaultLocale if no redis client is available
+func (event EventContainer) Locales() (locales []string) {
+	if cache.GetRedisClient() == nil {
+		return []string{DefaultLocale}
+	}
+
+	if event.Key != "" {
+		if locales, ok := getEventLocales(event.Key); ok {
+			return locales
+		}
+	}
+
+	locales = event.resolveLocales()
+
+	if event.Key != "" {
+		setEventLocales(event.Key, locales)
+	}
+	return locales
+}
+
+func (event EventContainer) resolveLocales() (locales []string) {
+	ctx := context.Background()
+
+	if userID := event.UserID(); userID != "" {
+		locale, err := GetUserLocale(ctx, userID)
+		if err != nil && cache.HasLogger() {
+			cache.GetLogger().WithField("module", "locale").Errorln("error getting user locale", err.Error())
+		}
+		if locale != "" {
+			locales = append(locales, locale)
+		}
+	}
+
+	if guildID := event.GuildID(); guildID != "" {
+		locale, err := GetGuildLocale(ctx, guildID)
+		if err != nil && cache.HasLogger() {
+			cache.GetLogger().WithField("module", "locale").Errorln("error getting guild locale", err.Error())
+		}
+		if locale != "" {
+			locales = append(locales, locale)
+		}
+	}
+
+	return append(locales, DefaultLocale)
+}
+
+type eventLocalesEntry struct {
+	locales   []string
+	expiresAt time.Time
+}
+
+var (
+	eventLocales      = make(map[string]eventLocalesEntry)
+	eventLocalesMutex sync.Mutex
+)
+
+func getEventLocales(eventKey string) (locales []string, ok bool) {
+	eventLocalesMutex.Lock()
+	defer eventLocalesMutex.Unlock()
+
+	entry, ok := eventLocales[eventKey]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.locales, true
+}
+
+func setEventLocales(eventKey string, locales []string) {
+	eventLocalesMutex.Lock()
+	defer eventLocalesMutex.Unlock()
+
+	// remove locales of past events
+	now := time.Now()
+	if len(eventLocales) >= eventLocalesPruneSize {
+		for key, entry := range eventLocales {
+			if now.After(entry.expiresAt) {
+				delete(eventLocales, key)
+			}
+		}
+	}
+
+	eventLocales[eventKey] = eventLocalesEntry{locales: locales, expiresAt: now.Add(eventLocalesExpiry)}
+}
+
+func setLocale(ctx context.Context, filter map[string]string, key, locale string) (err error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return ErrInvalidLocale
+	}
+	locale = tag.String()
+
+	err = models.LocaleRepository.Upsert(
+		ctx,
+		filter,
+		map[string]interface{}{"$set": models.LocaleEntry{
+			GuildID: filter["guildid"],
+			UserID:  filter["userid"],
+			Locale:  locale,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	return cache.GetRedisClient().Set(key, locale, localeCacheExpiry).Err()
+}
+
+func resetLocale(ctx context.Context, filter map[string]string, key string) (err error) {
+	err = models.LocaleRepository.Delete(ctx, filter)
+	if err != nil && err != mongo.ErrNotFound {
+		return err
+	}
+
+	return cache.GetRedisClient().Set(key, "", localeCacheExpiry).Err()
+}
+
+func getLocale(ctx context.Context, filter map[string]string, key string) (locale string, err error) {
+	// try cache, empty values are cached as well
+	locale, err = cache.GetRedisClient().Get(key).Result()
+	if err == nil {
+		return locale, nil
+	}
+	if err != redis.Nil {
+		return "", err
+	}
+
+	var entry models.LocaleEntry
+	err = models.LocaleRepository.FindOne(ctx, filter, &entry)
+	if err != nil && err != mongo.ErrNotFound {
+		return "", err
+	}
+
+	err = cache.GetRedisClient().Set(key, entry.Locale, localeCacheExpiry).Err()
+	return entry.Locale, err
+}
@@ -0,0 +1,168 @@
+package dhelpers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/bwmarrin/discordgo"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"golang.org/x/text/language"
+)
+
+func initTestBundle() {
+	bundle := &i18n.Bundle{DefaultLanguage: language.English}
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+
+	bundle.MustParseMessageFileBytes([]byte(`
+Hello = "Hello"
+Goodbye = "Goodbye"
+
+[Apples]
+one = "{{.Count}} apple"
+other = "{{.Count}} apples"
+`), "active.en.toml")
+	bundle.MustParseMessageFileBytes([]byte(`
+Hello = "Hallo"
+
+[Apples]
+one = "{{.Count}} Apfel"
+other = "{{.Count}} Äpfel"
+`), "active.de.toml")
+	bundle.MustParseMessageFileBytes([]byte(`
+Hello = "안녕하세요"
+`), "active.ko.toml")
+
+	cache.SetLocalizationBundle(bundle)
+}
+
+func TestLocalize(t *testing.T) {
+	initTestBundle()
+
+	v := localize([]string{"de", DefaultLocale}, "Hello", nil)
+	if v != "Hallo" {
+		t.Error("Expected Hallo, got ", v)
+	}
+	v = localize([]string{"ko", "de", DefaultLocale}, "Hello", nil)
+	if v != "안녕하세요" {
+		t.Error("Expected 안녕하세요, got ", v)
+	}
+	// missing in german, fallback to english
+	v = localize([]string{"de", DefaultLocale}, "Goodbye", nil)
+	if v != "Goodbye" {
+		t.Error("Expected Goodbye, got ", v)
+	}
+	// missing in korean, fallback to guild locale
+	v = localize([]string{"ko", "de", DefaultLocale}, "Apples", 2, "Count", 2)
+	if v != "2 Äpfel" {
+		t.Error("Expected 2 Äpfel, got ", v)
+	}
+	v = localize([]string{"de", DefaultLocale}, "Apples", 1, "Count", 1)
+	if v != "1 Apfel" {
+		t.Error("Expected 1 Apfel, got ", v)
+	}
+	v = localize([]string{DefaultLocale}, "Unknown", nil)
+	if v != "Unknown" {
+		t.Error("Expected Unknown, got ", v)
+	}
+}
+
+func TestEventContainerLocales(t *testing.T) {
+	initTestBundle()
+
+	// set locales in cache
+	err := cache.GetRedisClient().Set(guildLocaleKey("test-guild"), "de", 0).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.GetRedisClient().Del(guildLocaleKey("test-guild")) // nolint: errcheck
+	err = cache.GetRedisClient().Set(userLocaleKey("test-user"), "ko", 0).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.GetRedisClient().Del(userLocaleKey("test-user")) // nolint: errcheck
+	err = cache.GetRedisClient().Set(userLocaleKey("test-user-without-locale"), "", 0).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.GetRedisClient().Del(userLocaleKey("test-user-without-locale")) // nolint: errcheck
+
+	event := EventContainer{
+		Type: MessageCreateEventType,
+		MessageCreate: &discordgo.MessageCreate{Message: &discordgo.Message{
+			GuildID: "test-guild",
+			Author:  &discordgo.User{ID: "test-user"},
+		}},
+	}
+	v := event.Locales()
+	if len(v) != 3 || v[0] != "ko" || v[1] != "de" || v[2] != DefaultLocale {
+		t.Error("Expected [ko de en], got ", v)
+	}
+	text := event.T("Hello")
+	if text != "안녕하세요" {
+		t.Error("Expected 안녕하세요, got ", text)
+	}
+	text = event.Tfc("Apples", 3, "Count", 3)
+	if text != "3 Äpfel" {
+		t.Error("Expected 3 Äpfel, got ", text)
+	}
+
+	event.MessageCreate.Author.ID = "test-user-without-locale"
+	text = event.T("Hello")
+	if text != "Hallo" {
+		t.Error("Expected Hallo, got ", text)
+	}
+}
+
+func TestEventContainerLocales_ResolvedOnce(t *testing.T) {
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	userID := "test-user" + suffix
+
+	err := cache.GetRedisClient().Set(userLocaleKey(userID), "ko", 0).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.GetRedisClient().Del(userLocaleKey(userID)) // nolint: errcheck
+
+	event := EventContainer{
+		Type: MessageCreateEventType,
+		Key:  "test-event" + suffix,
+		MessageCreate: &discordgo.MessageCreate{Message: &discordgo.Message{
+			Author: &discordgo.User{ID: userID},
+		}},
+	}
+	v := event.Locales()
+	if len(v) != 2 || v[0] != "ko" {
+		t.Error("Expected [ko en], got ", v)
+	}
+
+	// changes are not visible to an event which already resolved its locales
+	err = cache.GetRedisClient().Set(userLocaleKey(userID), "de", 0).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v = event.Locales()
+	if len(v) != 2 || v[0] != "ko" {
+		t.Error("Expected cached [ko en], got ", v)
+	}
+}
+
+func TestEventContainerLocales_WithoutRedis(t *testing.T) {
+	redisClient := cache.GetRedisClient()
+	cache.SetRedisClient(nil)
+	defer cache.SetRedisClient(redisClient)
+
+	event := EventContainer{
+		Type: MessageCreateEventType,
+		MessageCreate: &discordgo.MessageCreate{Message: &discordgo.Message{
+			GuildID: "test-guild",
+			Author:  &discordgo.User{ID: "test-user"},
+		}},
+	}
+	v := event.Locales()
+	if len(v) != 1 || v[0] != DefaultLocale {
+		t.Error("Expected [en], got ", v)
+	}
+}
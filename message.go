@@ -11,7 +11,8 @@ import (
 
 // SendMessage sends a message to a specific channel, takes care of splitting and sanitising the content, the event variable is being set
 func (event EventContainer) SendMessage(channelID, content string) (messages []*discordgo.Message, err error) {
-	return SendMessagefWithBot(event.BotUserID, channelID, content, "event", event)
+	defer event.discordBreadcrumb("SendMessage", channelID, &err)
+	return sendTranslatedMessageWithBot(event.BotUserID, channelID, event.T(content))
 }
 
 // SendMessageWithBot sends a message to a specific channel, takes care of splitting and sanitising the content
@@ -21,61 +22,30 @@ func SendMessageWithBot(botID, channelID, content string) (messages []*discordgo
 
 // SendMessagef sends a message to a specific channel, takes care of splitting and sanitising the content, and replacing the fields, the event variable is being set
 func (event EventContainer) SendMessagef(channelID, content string, fields ...interface{}) (messages []*discordgo.Message, err error) {
-	return SendMessagefWithBot(event.BotUserID, channelID, content, append(fields, "event", event)...)
+	defer event.discordBreadcrumb("SendMessagef", channelID, &err)
+	return sendTranslatedMessageWithBot(event.BotUserID, channelID, event.Tf(content, fields...))
 }
 
 // SendMessagefWithBot sends a message to a specific channel, takes care of splitting and sanitising the content, and replacing the fields
 func SendMessagefWithBot(botID, channelID, content string, fields ...interface{}) (messages []*discordgo.Message, err error) {
-	var message *discordgo.Message
-	content = cleanDiscordContent(Tf(content, fields...))
-	if len(content) > 2000 {
-		for _, page := range autoPagify(content) {
-			message, err = cache.GetEDiscord(botID).ChannelMessageSend(channelID, page)
-			if err != nil {
-				return messages, err
-			}
-			messages = append(messages, message)
-		}
-	} else {
-		message, err = cache.GetEDiscord(botID).ChannelMessageSend(channelID, content)
-		if err != nil {
-			return messages, err
-		}
-		messages = append(messages, message)
-	}
-	return messages, nil
+	return sendTranslatedMessageWithBot(botID, channelID, Tf(content, fields...))
 }
 
 // SendMessagefc sends a message to a specific channel, takes care of splitting and sanitising the content, and replacing the fields, and applying pluralization, the event variable is being set
 func (event EventContainer) SendMessagefc(channelID, content string, count int, fields ...interface{}) (messages []*discordgo.Message, err error) {
-	return SendMessagefcWithBot(event.BotUserID, channelID, content, count, append(fields, "event", event)...)
+	defer event.discordBreadcrumb("SendMessagefc", channelID, &err)
+	return sendTranslatedMessageWithBot(event.BotUserID, channelID, event.Tfc(content, count, fields...))
 }
 
 // SendMessagefcWithBot sends a message to a specific channel, takes care of splitting and sanitising the content, and replacing the fields, and applying pluralization
 func SendMessagefcWithBot(botID, channelID, content string, count int, fields ...interface{}) (messages []*discordgo.Message, err error) {
-	var message *discordgo.Message
-	content = cleanDiscordContent(Tfc(content, count, fields...))
-	if len(content) > 2000 {
-		for _, page := range autoPagify(content) {
-			message, err = cache.GetEDiscord(botID).ChannelMessageSend(channelID, page)
-			if err != nil {
-				return messages, err
-			}
-			messages = append(messages, message)
-		}
-	} else {
-		message, err = cache.GetEDiscord(botID).ChannelMessageSend(channelID, content)
-		if err != nil {
-			return messages, err
-		}
-		messages = append(messages, message)
-	}
-	return messages, nil
+	return sendTranslatedMessageWithBot(botID, channelID, Tfc(content, count, fields...))
 }
 
 // SendMessageBoxed sends a message to a specific channel, will put a box around it, takes care of splitting and sanitising the content, the event variable is being set
 func (event EventContainer) SendMessageBoxed(channelID, content string) (messages []*discordgo.Message, err error) {
-	return SendMessageBoxedfWithBot(event.BotUserID, channelID, content, "event", event)
+	defer event.discordBreadcrumb("SendMessageBoxed", channelID, &err)
+	return SendMessageBoxedfWithBot(event.BotUserID, channelID, event.T(content))
 }
 
 // SendMessageBoxedWithBot sends a message to a specific channel, will put a box around it, takes care of splitting and sanitising the content
@@ -99,6 +69,7 @@ func SendMessageBoxedfWithBot(botID, channelID, content string, fields ...interf
 
 // SendEmbed sends an embed to a specific channel, takes care of splitting and sanitising the content
 func (event EventContainer) SendEmbed(channelID string, embed *discordgo.MessageEmbed) (messages []*discordgo.Message, err error) {
+	defer event.discordBreadcrumb("SendEmbed", channelID, &err)
 	return SendEmbedWithBot(event.BotUserID, channelID, embed)
 }
 
@@ -115,6 +86,7 @@ func SendEmbedWithBot(botID, channelID string, embed *discordgo.MessageEmbed) (m
 
 // SendFile sends a file to a specific channel, takes care of splitting and sanitising the content
 func (event EventContainer) SendFile(channelID string, filename string, reader io.Reader, message string) (messages []*discordgo.Message, err error) {
+	defer event.discordBreadcrumb("SendFile", channelID, &err)
 	return SendFileWithBot(event.BotUserID, channelID, filename, reader, message)
 }
 
@@ -125,6 +97,7 @@ func SendFileWithBot(botID, channelID string, filename string, reader io.Reader,
 
 // SendComplex sends a discordgo.MessageSend object to a specific channel, takes care of splitting and sanitising the content
 func (event EventContainer) SendComplex(channelID string, data *discordgo.MessageSend) (messages []*discordgo.Message, err error) {
+	defer event.discordBreadcrumb("SendComplex", channelID, &err)
 	return SendComplexWithBot(event.BotUserID, channelID, data)
 }
 
@@ -161,7 +134,8 @@ func SendComplexWithBot(botID, channelID string, data *discordgo.MessageSend) (m
 
 // EditMessage edits a specific message, takes care of sanitising the content
 func (event EventContainer) EditMessage(channelID, messageID, content string) (message *discordgo.Message, err error) {
-	return EditMessagefWithBot(event.BotUserID, channelID, messageID, content, "event", event)
+	defer event.discordBreadcrumb("EditMessage", channelID, &err)
+	return editTranslatedMessageWithBot(event.BotUserID, channelID, messageID, event.T(content))
 }
 
 // EditMessageWithBot edits a specific message, takes care of sanitising the content
@@ -171,36 +145,29 @@ func EditMessageWithBot(botID, channelID, messageID, content string) (message *d
 
 // EditMessagef edits a specific message, takes care of sanitising the content, and replacing the fields, the event variable is being set
 func (event EventContainer) EditMessagef(channelID, messageID, content string, fields ...interface{}) (message *discordgo.Message, err error) {
-	return EditMessagefWithBot(event.BotUserID, channelID, messageID, content, append(fields, "event", event)...)
+	defer event.discordBreadcrumb("EditMessagef", channelID, &err)
+	return editTranslatedMessageWithBot(event.BotUserID, channelID, messageID, event.Tf(content, fields...))
 }
 
 // EditMessagefWithBot edits a specific message, takes care of sanitising the content, and replacing the fields
 func EditMessagefWithBot(botID, channelID, messageID, content string, fields ...interface{}) (message *discordgo.Message, err error) {
-	content = cleanDiscordContent(Tf(content, fields...))
-	message, err = cache.GetEDiscord(botID).ChannelMessageEdit(channelID, messageID, content)
-	if err != nil {
-		return nil, err
-	}
-	return message, err
+	return editTranslatedMessageWithBot(botID, channelID, messageID, Tf(content, fields...))
 }
 
 // EditMessagefc edits a specific message, takes care of sanitising the content, and replacing the fields, and applying pluralization, the event variable is being set
 func (event EventContainer) EditMessagefc(channelID, messageID, content string, count int, fields ...interface{}) (message *discordgo.Message, err error) {
-	return EditMessagefcWithBot(event.BotUserID, channelID, messageID, content, count, append(fields, "event", event)...)
+	defer event.discordBreadcrumb("EditMessagefc", channelID, &err)
+	return editTranslatedMessageWithBot(event.BotUserID, channelID, messageID, event.Tfc(content, count, fields...))
 }
 
 // EditMessagefcWithBot edits a specific message, takes care of sanitising the content, and replacing the fields, and applying pluralization
 func EditMessagefcWithBot(botID, channelID, messageID, content string, count int, fields ...interface{}) (message *discordgo.Message, err error) {
-	content = cleanDiscordContent(Tfc(content, count, fields...))
-	message, err = cache.GetEDiscord(botID).ChannelMessageEdit(channelID, messageID, content)
-	if err != nil {
-		return nil, err
-	}
-	return message, err
+	return editTranslatedMessageWithBot(botID, channelID, messageID, Tfc(content, count, fields...))
 }
 
 // EditEmbed edits a specific embed, takes care of sanitising the content
 func (event EventContainer) EditEmbed(channelID, messageID string, embed *discordgo.MessageEmbed) (message *discordgo.Message, err error) {
+	defer event.discordBreadcrumb("EditEmbed", channelID, &err)
 	return EditEmbedWithBot(event.BotUserID, channelID, messageID, embed)
 }
 
@@ -215,6 +182,7 @@ func EditEmbedWithBot(botID, channelID, messageID string, embed *discordgo.Messa
 
 // EditComplex edits a specific message using a discordgo.MessageEdit object, takes care of sanitising the content
 func (event EventContainer) EditComplex(data *discordgo.MessageEdit) (message *discordgo.Message, err error) {
+	defer event.discordBreadcrumb("EditComplex", data.Channel, &err)
 	return EditComplexWithBot(event.BotUserID, data)
 }
 
@@ -234,6 +202,38 @@ func EditComplexWithBot(botID string, data *discordgo.MessageEdit) (message *dis
 	return message, err
 }
 
+// sendTranslatedMessageWithBot sends an already translated message to a specific channel, takes care of splitting and sanitising the content
+func sendTranslatedMessageWithBot(botID, channelID, content string) (messages []*discordgo.Message, err error) {
+	var message *discordgo.Message
+	content = cleanDiscordContent(content)
+	if len(content) > 2000 {
+		for _, page := range autoPagify(content) {
+			message, err = cache.GetEDiscord(botID).ChannelMessageSend(channelID, page)
+			if err != nil {
+				return messages, err
+			}
+			messages = append(messages, message)
+		}
+	} else {
+		message, err = cache.GetEDiscord(botID).ChannelMessageSend(channelID, content)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// editTranslatedMessageWithBot edits a specific message with already translated content, takes care of sanitising the content
+func editTranslatedMessageWithBot(botID, channelID, messageID, content string) (message *discordgo.Message, err error) {
+	content = cleanDiscordContent(content)
+	message, err = cache.GetEDiscord(botID).ChannelMessageEdit(channelID, messageID, content)
+	if err != nil {
+		return nil, err
+	}
+	return message, err
+}
+
 func strictPagify(text string, delimiter string) []string {
 	result := make([]string, 0)
 	textParts := strings.Split(text, delimiter)
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the upper bounds in milliseconds used for latency histograms
+var DefaultLatencyBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// Histogram counts observed values in buckets, can be published using expvar
+type Histogram struct {
+	bounds []float64
+	counts []int64 // the last count contains values above all bounds
+	count  int64
+	sum    float64
+	sync.Mutex
+}
+
+// NewHistogram creates a histogram with the given upper bounds, in ascending order
+func NewHistogram(bounds ...float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// Observe adds a value to the histogram
+func (h *Histogram) Observe(value float64) {
+	h.Lock()
+	defer h.Unlock()
+
+	i := 0
+	for i < len(h.bounds) && value > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += value
+}
+
+// String returns the histogram as JSON, satisfies expvar.Var
+// the buckets are cumulative, keyed by their upper bound
+func (h *Histogram) String() string {
+	h.Lock()
+	defer h.Unlock()
+
+	buckets := make(map[string]int64)
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		buckets[strconv.FormatFloat(bound, 'f', -1, 64)] = cumulative
+	}
+	buckets["+Inf"] = h.count
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"count":   h.count,
+		"sum":     h.sum,
+		"buckets": buckets,
+	})
+	return string(data)
+}
+
+var mapHistogramsMutex sync.Mutex
+
+// MapHistogram returns the latency histogram for the key of an expvar map, creates it if required
+func MapHistogram(m *expvar.Map, key string) *Histogram {
+	mapHistogramsMutex.Lock()
+	defer mapHistogramsMutex.Unlock()
+
+	if histogram, ok := m.Get(key).(*Histogram); ok {
+		return histogram
+	}
+
+	histogram := NewHistogram(DefaultLatencyBuckets...)
+	m.Set(key, histogram)
+	return histogram
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram(1, 10)
+	for _, value := range []float64{0.5, 1, 5, 50} {
+		histogram.Observe(value)
+	}
+
+	expected := `{"buckets":{"+Inf":4,"1":2,"10":3},"count":4,"sum":56.5}`
+	if histogram.String() != expected {
+		t.Error("Expected "+expected+", got ", histogram.String())
+	}
+}
+
+func TestMapHistogram(t *testing.T) {
+	m := new(expvar.Map).Init()
+
+	histogram := MapHistogram(m, "test")
+	histogram.Observe(1)
+
+	if MapHistogram(m, "test") != histogram {
+		t.Error("Expected existing histogram to be returned")
+	}
+	if m.Get("test") != histogram {
+		t.Error("Expected histogram to be published in the map")
+	}
+}
@@ -5,4 +5,8 @@ import "expvar"
 var (
 	// Uptime contains the timestamp when the service was started
 	Uptime = expvar.NewInt("uptime")
+	// MongoLatency contains the latency histograms of MongoDB operations in milliseconds, by collection
+	MongoLatency = expvar.NewMap("mongo_latency")
+	// MongoErrors contains the number of failed MongoDB operations, by collection
+	MongoErrors = expvar.NewMap("mongo_errors")
 )
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+)
+
+const (
+	// GuildErrorChannelsTable is the table containing all GuildErrorChannel entries
+	GuildErrorChannelsTable mongo.Collection = "guild_error_channels"
+)
+
+var (
+	// GuildErrorChannelRepository contains the database logic for the GuildErrorChannelsTable
+	GuildErrorChannelRepository = mongo.NewRepository(
+		GuildErrorChannelsTable,
+		mongo.Index{Keys: []mongo.SortField{{Field: "guildid"}}, Unique: true},
+	)
+)
+
+// GuildErrorChannel configures the channel errors of a guild are posted to
+type GuildErrorChannel struct {
+	ID        *objectid.ObjectID `bson:"_id,omitempty"`
+	GuildID   string
+	ChannelID string
+}
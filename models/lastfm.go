@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+)
+
+const (
+	// LastFmLinksTable is the table containing all LastFmLink entries
+	LastFmLinksTable mongo.Collection = "lastfm_links"
+	// LastFmScrobblesTable is the table containing all LastFmScrobble entries
+	LastFmScrobblesTable mongo.Collection = "lastfm_scrobbles"
+)
+
+var (
+	// LastFmLinkRepository contains the database logic for the LastFmLinksTable
+	LastFmLinkRepository = mongo.NewRepository(
+		LastFmLinksTable,
+		mongo.Index{Keys: []mongo.SortField{{Field: "userid"}}, Unique: true},
+	)
+	// LastFmScrobbleRepository contains the database logic for the LastFmScrobblesTable
+	LastFmScrobbleRepository = mongo.NewRepository(
+		LastFmScrobblesTable,
+		mongo.Index{Keys: []mongo.SortField{{Field: "userid"}, {Field: "time"}}},
+		mongo.Index{Keys: []mongo.SortField{{Field: "userid"}, {Field: "artist"}, {Field: "track"}, {Field: "time"}}},
+	)
+)
+
+// LastFmLink links a Discord User to a Last.FM User
+type LastFmLink struct {
+	ID             *objectid.ObjectID `bson:"_id,omitempty"`
+	UserID         string             // the Discord User ID
+	Username       string             // the Last.FM Username
+	LinkedAt       time.Time
+	Privacy        LastFmPrivacy
+	LastScrobbleAt time.Time // the time of the newest imported scrobble
+	SyncedAt       time.Time // the time of the last scrobble history import
+}
+
+// LastFmPrivacy contains the privacy settings of a LastFmLink
+type LastFmPrivacy struct {
+	HideFromGuildStats bool // if true the user will not be included in guild stats
+	HideNowPlaying     bool // if true the currently playing track will not be shown to other users
+	DisableHistory     bool // if true the scrobble history will not be imported
+}
+
+// LastFmScrobble contains a single scrobble imported from Last.FM
+type LastFmScrobble struct {
+	ID        *objectid.ObjectID `bson:"_id,omitempty"`
+	UserID    string             // the Discord User ID
+	Username  string             // the Last.FM Username
+	Track     string
+	TrackURL  string
+	Artist    string
+	ArtistURL string
+	Album     string
+	Time      time.Time
+}
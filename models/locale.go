@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+)
+
+const (
+	// LocalesTable is the table containing all LocaleEntry entries
+	LocalesTable mongo.Collection = "locales"
+)
+
+var (
+	// LocaleRepository contains the database logic for the LocalesTable
+	LocaleRepository = mongo.NewRepository(
+		LocalesTable,
+		mongo.Index{Keys: []mongo.SortField{{Field: "guildid"}}},
+		mongo.Index{Keys: []mongo.SortField{{Field: "userid"}}},
+	)
+)
+
+// LocaleEntry stores the locale of a Guild or an User
+type LocaleEntry struct {
+	ID      *objectid.ObjectID `bson:"_id,omitempty"`
+	GuildID string             // set for guild locales
+	UserID  string             // set for user locales
+	Locale  string             // a BCP 47 language tag, example: de
+}
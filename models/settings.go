@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+)
+
+const (
+	// SettingsTable is the table containing all SettingEntry entries
+	SettingsTable mongo.Collection = "settings"
+)
+
+var (
+	// SettingsRepository contains the database logic for the SettingsTable
+	// values are cached by dhelpers.GetSetting per target and key, not by the repository
+	SettingsRepository = mongo.NewRepository(
+		SettingsTable,
+		mongo.Index{
+			Keys: []mongo.SortField{
+				{Field: "guildid"}, {Field: "scope"}, {Field: "scopeid"}, {Field: "key"},
+			},
+			Unique: true,
+		},
+	)
+)
+
+// SettingEntry stores the value of a setting for a guild, channel, or user
+type SettingEntry struct {
+	ID        *objectid.ObjectID `bson:"_id,omitempty"`
+	GuildID   string
+	Scope     string // guild, channel, or user
+	ScopeID   string // the channel or user ID, empty for guild settings
+	Key       string
+	Value     string // the value encoded as JSON
+	UpdatedAt time.Time
+}
@@ -13,8 +13,20 @@ const (
 )
 
 var (
-	// StorageRepository contains the database logic for the table
-	StorageRepository = mongo.NewRepository(StorageTable)
+	// StorageStatisticsRepository contains the uncached database logic for the table
+	// used to update statistics, for example RetrievedCount, without invalidating the cache of StorageRepository
+	StorageStatisticsRepository = mongo.NewRepository(
+		StorageTable,
+		mongo.Index{Keys: []mongo.SortField{{Field: "objectname"}}, Unique: true},
+		mongo.Index{Keys: []mongo.SortField{{Field: "objectnamehash"}}},
+	)
+
+	// StorageRepository contains the database logic for the table, FindOne and GetByID results are cached
+	StorageRepository = mongo.NewCachedRepository(
+		StorageStatisticsRepository,
+		StorageTable,
+		mongo.CacheOptions{NotFoundTTL: 1 * time.Minute},
+	)
 )
 
 // StorageEntry contains information about an object stored in object storage
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+)
+
+const (
+	// DelayedTasksTable is the table containing all DelayedTask entries
+	DelayedTasksTable mongo.Collection = "delayed_tasks"
+)
+
+var (
+	// DelayedTaskRepository contains the database logic for the DelayedTasksTable
+	DelayedTaskRepository = mongo.NewRepository(
+		DelayedTasksTable,
+		mongo.Index{Keys: []mongo.SortField{{Field: "dueat"}}},
+	)
+)
+
+// DelayedTask is a task which is due too far in the future to be stored in redis
+// it is moved to redis by a TaskWorker once it is due soon
+type DelayedTask struct {
+	ID        *objectid.ObjectID `bson:"_id,omitempty"`
+	Handler   string
+	Payload   []byte
+	DueAt     time.Time
+	Attempts  int
+	CreatedAt time.Time
+}
@@ -0,0 +1,400 @@
+package mongo
+
+import (
+	"container/list"
+	"context"
+	"crypto/md5" // nolint: gosec
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// cacheInvalidationChannel is the redis channel used to broadcast invalidated collections to all processes
+const cacheInvalidationChannel = "project-d:mongo-cache:invalidate"
+
+// cacheGetScript reads the current generation of a collection, and the cached entry of that generation
+// KEYS[1]: the generation key of the collection
+// ARGV[1]: the prefix of the entry keys
+// ARGV[2]: the hash of the filter
+// returns {generation, entry or false}
+var cacheGetScript = redis.NewScript(`
+local generation = redis.call('GET', KEYS[1]) or '0'
+return {generation, redis.call('GET', ARGV[1] .. generation .. ':' .. ARGV[2])}
+`)
+
+// cacheNotFound is the cached value for filters without a document
+var cacheNotFound = []byte("not-found")
+
+// CacheOptions configures a cached repository
+type CacheOptions struct {
+	// TTL is the duration documents are cached in redis, default ten minutes
+	TTL time.Duration
+	// LocalTTL is the duration documents are cached in process, default one minute
+	// invalidations from other processes are received using pubsub, LocalTTL limits staleness if a message is missed
+	LocalTTL time.Duration
+	// LocalSize is the maximum number of documents cached in process, the least recently used are evicted, default 1000
+	LocalSize int
+	// NotFoundTTL is the duration ErrNotFound results are cached, 0 disables caching ErrNotFound
+	NotFoundTTL time.Duration
+}
+
+// cachedRepository caches FindOne and GetByID results of a repository in process and in redis
+type cachedRepository struct {
+	BasicRepository
+	collection Collection
+	options    CacheOptions
+
+	entries    map[string]*list.Element
+	lru        *list.List // the most recently used entry is at the front
+	localEpoch uint64     // increased whenever the in process cache is cleared
+	sync.Mutex
+}
+
+// localCacheEntry is an entry of the in process cache
+type localCacheEntry struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+var (
+	cachedRepositories      = make(map[Collection][]*cachedRepository)
+	cachedRepositoriesMutex sync.RWMutex
+	cacheSubscriptionOnce   sync.Once
+)
+
+// NewCachedRepository wraps a repository, FindOne and GetByID results are cached in process and in redis
+// writes through the returned repository invalidate all cached documents of the collection in all processes
+// writes through other repositories are not noticed, use it for documents which are read often but rarely change
+func NewCachedRepository(repository BasicRepository, collection Collection, options CacheOptions) BasicRepository {
+	if options.TTL <= 0 {
+		options.TTL = 10 * time.Minute
+	}
+	if options.LocalTTL <= 0 {
+		options.LocalTTL = 1 * time.Minute
+	}
+	if options.LocalSize <= 0 {
+		options.LocalSize = 1000
+	}
+
+	cached := &cachedRepository{
+		BasicRepository: repository,
+		collection:      collection,
+		options:         options,
+		entries:         make(map[string]*list.Element),
+		lru:             list.New(),
+	}
+
+	cachedRepositoriesMutex.Lock()
+	cachedRepositories[collection] = append(cachedRepositories[collection], cached)
+	cachedRepositoriesMutex.Unlock()
+
+	return cached
+}
+
+func (r *cachedRepository) GetByID(ctx context.Context, id objectid.ObjectID, result interface{}) error {
+	return r.FindOne(ctx, map[string]objectid.ObjectID{"_id": id}, result)
+}
+
+func (r *cachedRepository) FindOne(ctx context.Context, filter interface{}, result interface{}) (err error) {
+	subscribeCacheInvalidations()
+
+	hash, err := cacheFilterHash(filter)
+	if err != nil {
+		return r.BasicRepository.FindOne(ctx, filter, result)
+	}
+
+	// in process cache
+	data := r.getLocal(hash)
+	if data == nil {
+		// results read before the in process cache is cleared by a concurrent write are not cached in process
+		epoch := r.getLocalEpoch()
+
+		// redis cache
+		var generation string
+		data, generation = r.getRedis(hash)
+		if data == nil {
+			// database
+			err = r.BasicRepository.FindOne(ctx, filter, result)
+			switch {
+			case err == ErrNotFound && r.options.NotFoundTTL > 0:
+				r.setRedis(generation, hash, cacheNotFound, r.options.NotFoundTTL)
+				r.setLocal(epoch, hash, cacheNotFound, r.options.NotFoundTTL)
+			case err == nil:
+				data, err = bson.Marshal(result)
+				if err != nil {
+					return err
+				}
+				r.setRedis(generation, hash, data, r.options.TTL)
+				r.setLocal(epoch, hash, data, r.options.LocalTTL)
+			}
+			return err
+		}
+
+		r.setLocal(epoch, hash, data, r.options.LocalTTL)
+	}
+
+	if string(data) == string(cacheNotFound) {
+		return ErrNotFound
+	}
+	return bson.Unmarshal(data, result)
+}
+
+func (r *cachedRepository) FindOneAndUpdate(ctx context.Context, filter interface{}, document interface{}, upsert bool, result interface{}) error {
+	defer r.invalidate()
+	return r.BasicRepository.FindOneAndUpdate(ctx, filter, document, upsert, result)
+}
+
+func (r *cachedRepository) UpdateByID(ctx context.Context, id objectid.ObjectID, document interface{}) error {
+	defer r.invalidate()
+	return r.BasicRepository.UpdateByID(ctx, id, document)
+}
+
+func (r *cachedRepository) Update(ctx context.Context, filter interface{}, document interface{}) error {
+	defer r.invalidate()
+	return r.BasicRepository.Update(ctx, filter, document)
+}
+
+func (r *cachedRepository) UpdateMany(ctx context.Context, filter interface{}, document interface{}) (UpdateResult, error) {
+	defer r.invalidate()
+	return r.BasicRepository.UpdateMany(ctx, filter, document)
+}
+
+func (r *cachedRepository) UpsertByID(ctx context.Context, id objectid.ObjectID, document interface{}) error {
+	defer r.invalidate()
+	return r.BasicRepository.UpsertByID(ctx, id, document)
+}
+
+func (r *cachedRepository) Upsert(ctx context.Context, filter interface{}, document interface{}) error {
+	defer r.invalidate()
+	return r.BasicRepository.Upsert(ctx, filter, document)
+}
+
+func (r *cachedRepository) Store(ctx context.Context, document interface{}) (*objectid.ObjectID, error) {
+	defer r.invalidate()
+	return r.BasicRepository.Store(ctx, document)
+}
+
+func (r *cachedRepository) InsertMany(ctx context.Context, documents []interface{}) ([]objectid.ObjectID, error) {
+	defer r.invalidate()
+	return r.BasicRepository.InsertMany(ctx, documents)
+}
+
+func (r *cachedRepository) DeleteByID(ctx context.Context, id objectid.ObjectID) error {
+	defer r.invalidate()
+	return r.BasicRepository.DeleteByID(ctx, id)
+}
+
+func (r *cachedRepository) Delete(ctx context.Context, filter interface{}) error {
+	defer r.invalidate()
+	return r.BasicRepository.Delete(ctx, filter)
+}
+
+func (r *cachedRepository) DeleteMany(ctx context.Context, filter interface{}) (int64, error) {
+	defer r.invalidate()
+	return r.BasicRepository.DeleteMany(ctx, filter)
+}
+
+func (r *cachedRepository) BulkWrite(ctx context.Context, operations []WriteOperation) (BulkWriteResult, error) {
+	defer r.invalidate()
+	return r.BasicRepository.BulkWrite(ctx, operations)
+}
+
+// invalidate invalidates all cached documents of the collection, in redis and in all processes
+// the redis entries are invalidated by increasing the generation of the collection, old entries expire by themselves
+func (r *cachedRepository) invalidate() {
+	clearLocalCaches(r.collection)
+
+	redisClient := cache.GetRedisClient()
+	if redisClient == nil {
+		return
+	}
+
+	pipeline := redisClient.TxPipeline()
+	pipeline.Incr(r.generationKey())
+	pipeline.Publish(cacheInvalidationChannel, string(r.collection))
+	_, err := pipeline.Exec()
+	if err != nil && cache.HasLogger() {
+		cache.GetLogger().WithField("module", "mongo").Warnln("error invalidating cache for", string(r.collection)+":", err.Error())
+	}
+}
+
+func (r *cachedRepository) generationKey() (key string) {
+	return "project-d:mongo-cache:" + string(r.collection) + ":generation"
+}
+
+func (r *cachedRepository) entryPrefix() (prefix string) {
+	return "project-d:mongo-cache:" + string(r.collection) + ":"
+}
+
+// getRedis returns the cached entry, and the current generation of the collection
+func (r *cachedRepository) getRedis(hash string) (data []byte, generation string) {
+	redisClient := cache.GetRedisClient()
+	if redisClient == nil {
+		return nil, ""
+	}
+
+	result, err := cacheGetScript.Run(redisClient, []string{r.generationKey()}, r.entryPrefix(), hash).Result()
+	if err != nil {
+		if cache.HasLogger() {
+			cache.GetLogger().WithField("module", "mongo").Warnln("error reading cache for", string(r.collection)+":", err.Error())
+		}
+		return nil, ""
+	}
+
+	values, _ := result.([]interface{})
+	if len(values) < 2 {
+		return nil, ""
+	}
+	generation, _ = values[0].(string)
+	if entry, ok := values[1].(string); ok {
+		data = []byte(entry)
+	}
+	return data, generation
+}
+
+func (r *cachedRepository) setRedis(generation, hash string, data []byte, ttl time.Duration) {
+	redisClient := cache.GetRedisClient()
+	if redisClient == nil || generation == "" {
+		return
+	}
+
+	err := redisClient.Set(r.entryPrefix()+generation+":"+hash, data, ttl).Err()
+	if err != nil && cache.HasLogger() {
+		cache.GetLogger().WithField("module", "mongo").Warnln("error writing cache for", string(r.collection)+":", err.Error())
+	}
+}
+
+func (r *cachedRepository) getLocal(hash string) (data []byte) {
+	r.Lock()
+	defer r.Unlock()
+
+	element, ok := r.entries[hash]
+	if !ok {
+		return nil
+	}
+
+	entry := element.Value.(*localCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		delete(r.entries, hash)
+		r.lru.Remove(element)
+		return nil
+	}
+
+	r.lru.MoveToFront(element)
+	return entry.data
+}
+
+// getLocalEpoch returns the current epoch of the in process cache, to be passed to setLocal
+func (r *cachedRepository) getLocalEpoch() (epoch uint64) {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.localEpoch
+}
+
+// setLocal caches an entry in process, if the in process cache has not been cleared since epoch
+func (r *cachedRepository) setLocal(epoch uint64, hash string, data []byte, ttl time.Duration) {
+	if ttl > r.options.LocalTTL {
+		ttl = r.options.LocalTTL
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if epoch != r.localEpoch {
+		return
+	}
+
+	if element, ok := r.entries[hash]; ok {
+		delete(r.entries, hash)
+		r.lru.Remove(element)
+	}
+
+	r.entries[hash] = r.lru.PushFront(&localCacheEntry{
+		key:       hash,
+		data:      data,
+		expiresAt: time.Now().Add(ttl),
+	})
+
+	// evict least recently used entries
+	for r.lru.Len() > r.options.LocalSize {
+		element := r.lru.Back()
+		delete(r.entries, element.Value.(*localCacheEntry).key)
+		r.lru.Remove(element)
+	}
+}
+
+func (r *cachedRepository) clearLocal() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.entries = make(map[string]*list.Element)
+	r.lru.Init()
+	r.localEpoch++
+}
+
+// clearLocalCaches clears the in process cache of all cached repositories of the collection
+func clearLocalCaches(collection Collection) {
+	cachedRepositoriesMutex.RLock()
+	defer cachedRepositoriesMutex.RUnlock()
+
+	for _, cached := range cachedRepositories[collection] {
+		cached.clearLocal()
+	}
+}
+
+// subscribeCacheInvalidations starts receiving invalidations from other processes, once a redis client is available
+func subscribeCacheInvalidations() {
+	if cache.GetRedisClient() == nil {
+		return
+	}
+
+	cacheSubscriptionOnce.Do(func() {
+		pubsub := cache.GetRedisClient().Subscribe(cacheInvalidationChannel)
+		go func() {
+			for message := range pubsub.Channel() {
+				clearLocalCaches(Collection(message.Payload))
+			}
+		}()
+	})
+}
+
+// cacheFilterHash returns a hash identifying the filter, including its values
+func cacheFilterHash(filter interface{}) (hash string, err error) {
+	hasher := md5.New() // nolint: gosec
+
+	value := reflect.ValueOf(filter)
+	if value.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String {
+		var data []byte
+		data, err = bson.Marshal(filter)
+		if err != nil {
+			return "", err
+		}
+		hasher.Write(data) // nolint: errcheck, gosec
+		return hex.EncodeToString(hasher.Sum(nil)), nil
+	}
+
+	// map iteration order is random, encode the entries sorted by key so equal filters result in the same hash
+	// every entry is encoded as a length prefixed document, different filters can not result in the same input
+	keys := value.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	for _, key := range keys {
+		var data []byte
+		data, err = bson.Marshal(map[string]interface{}{key.String(): value.MapIndex(key).Interface()})
+		if err != nil {
+			return "", err
+		}
+		hasher.Write(data) // nolint: errcheck, gosec
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
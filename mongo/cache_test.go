@@ -0,0 +1,154 @@
+package mongo
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+)
+
+func TestCacheFilterHash(t *testing.T) {
+	first, err := cacheFilterHash(map[string]interface{}{"userid": "1", "guildid": "2"})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	second, _ := cacheFilterHash(map[string]interface{}{"guildid": "2", "userid": "1"})
+	if first != second {
+		t.Error("Expected equal hashes for equal filters, got ", first, second)
+	}
+	third, _ := cacheFilterHash(map[string]interface{}{"userid": "1", "guildid": "3"})
+	if first == third {
+		t.Error("Expected different hashes for different values, got ", third)
+	}
+
+	// documents are not encoded by encoding/json, their values have to be part of the hash
+	fourth, err := cacheFilterHash(bson.NewDocument(bson.EC.String("userid", "1")))
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	fifth, _ := cacheFilterHash(bson.NewDocument(bson.EC.String("userid", "2")))
+	if fourth == fifth {
+		t.Error("Expected different hashes for different documents, got ", fifth)
+	}
+}
+
+func TestCachedRepository_Local(t *testing.T) {
+	repository := NewCachedRepository(nil, Collection("test_local"), CacheOptions{LocalSize: 2}).(*cachedRepository)
+
+	repository.setLocal(0, "a", []byte("a"), time.Minute)
+	repository.setLocal(0, "b", []byte("b"), time.Minute)
+	repository.getLocal("a")
+	repository.setLocal(0, "c", []byte("c"), time.Minute)
+
+	if repository.getLocal("b") != nil {
+		t.Error("Expected least recently used entry b to be evicted")
+	}
+	if string(repository.getLocal("a")) != "a" || string(repository.getLocal("c")) != "c" {
+		t.Error("Expected entries a and c to be cached")
+	}
+
+	repository.setLocal(0, "d", []byte("d"), -time.Second)
+	if repository.getLocal("d") != nil {
+		t.Error("Expected expired entry d to be removed")
+	}
+
+	clearLocalCaches(Collection("test_local"))
+	if repository.getLocal("a") != nil {
+		t.Error("Expected cache to be cleared")
+	}
+}
+
+func TestCachedRepository_FindOne(t *testing.T) {
+	skipWithoutMongo(t)
+
+	collection := Collection("test_" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	uncached := NewRepository(collection)
+	repository := NewCachedRepository(uncached, collection, CacheOptions{NotFoundTTL: time.Minute})
+	defer dropTestCollection(collection)
+
+	id, err := repository.Store(context.Background(), &testDocument{Name: "a", Count: 1})
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	var document testDocument
+	err = repository.GetByID(context.Background(), *id, &document)
+	if err != nil || document.Count != 1 {
+		t.Error("Expected count 1, got ", document.Count, err)
+	}
+
+	// cached documents keep fields which are only mapped by bson tags
+	var cached testDocument
+	err = repository.GetByID(context.Background(), *id, &cached)
+	if err != nil || cached.ID == nil || *cached.ID != *id {
+		t.Error("Expected cached document with ID ", id.Hex(), ", got ", cached.ID, err)
+	}
+
+	// writes through other repositories are not noticed
+	err = uncached.UpdateByID(context.Background(), *id, map[string]map[string]int{"$set": {"count": 2}})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	err = repository.GetByID(context.Background(), *id, &document)
+	if err != nil || document.Count != 1 {
+		t.Error("Expected cached count 1, got ", document.Count, err)
+	}
+
+	// writes through the cached repository invalidate
+	err = repository.UpdateByID(context.Background(), *id, map[string]map[string]int{"$set": {"count": 3}})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	err = repository.GetByID(context.Background(), *id, &document)
+	if err != nil || document.Count != 3 {
+		t.Error("Expected count 3, got ", document.Count, err)
+	}
+
+	// ErrNotFound is cached
+	err = repository.FindOne(context.Background(), map[string]string{"name": "b"}, &document)
+	if err != ErrNotFound {
+		t.Error("Expected ErrNotFound, got ", err)
+	}
+	_, err = uncached.Store(context.Background(), &testDocument{Name: "b", Count: 1})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	err = repository.FindOne(context.Background(), map[string]string{"name": "b"}, &document)
+	if err != ErrNotFound {
+		t.Error("Expected cached ErrNotFound, got ", err)
+	}
+}
+
+// racingRepository returns a document, and clears the in process cache while reading it, like a concurrent write
+type racingRepository struct {
+	BasicRepository
+	collection Collection
+}
+
+func (r racingRepository) FindOne(ctx context.Context, filter interface{}, result interface{}) error {
+	clearLocalCaches(r.collection)
+	result.(*testDocument).Name = "stale"
+	return nil
+}
+
+func TestCachedRepository_FindOneConcurrentWrite(t *testing.T) {
+	collection := Collection("test_" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	repository := NewCachedRepository(racingRepository{collection: collection}, collection, CacheOptions{}).(*cachedRepository)
+
+	filter := map[string]string{"name": "stale"}
+	var document testDocument
+	err := repository.FindOne(context.Background(), filter, &document)
+	if err != nil || document.Name != "stale" {
+		t.Error("Expected stale document, got ", document, err)
+	}
+
+	hash, err := cacheFilterHash(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repository.getLocal(hash) != nil {
+		t.Error("Expected document read before a concurrent write to not be cached in process")
+	}
+}
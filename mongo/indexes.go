@@ -0,0 +1,129 @@
+package mongo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// Index is an index of a Collection, declared using NewRepository and created using EnsureIndexes
+type Index struct {
+	// Keys are the fields of the index, in order, multiple keys create a compound index
+	Keys []SortField
+	// Unique rejects documents with the same values for the keys
+	Unique bool
+	// ExpireAfter deletes documents after the duration, the key has to be a single date field
+	ExpireAfter time.Duration
+	// Name is the name of the index, generated from the keys if empty
+	Name string
+}
+
+var (
+	indexes      = make(map[Collection][]Index)
+	indexesMutex sync.RWMutex
+)
+
+// RegisterIndexes declares indexes of a Collection, they will be created by EnsureIndexes
+func RegisterIndexes(collection Collection, collectionIndexes ...Index) {
+	indexesMutex.Lock()
+	defer indexesMutex.Unlock()
+
+	indexes[collection] = append(indexes[collection], collectionIndexes...)
+}
+
+// EnsureIndexes creates all declared indexes which do not exist yet, existing indexes are not modified
+// indexes which conflict with existing documents, for example unique indexes on fields with duplicate values,
+// or with existing indexes with different options, are skipped with a warning, so they do not prevent starting
+// they are created by the next EnsureIndexes after the conflict has been resolved
+func EnsureIndexes(ctx context.Context) (err error) {
+	if cache.GetMongo() == nil {
+		return ErrUnavailable
+	}
+
+	indexesMutex.RLock()
+	defer indexesMutex.RUnlock()
+
+	for collection, collectionIndexes := range indexes {
+		indexView := cache.GetMongo().Collection(string(collection)).Indexes()
+
+		for _, index := range collectionIndexes {
+			_, err = indexView.CreateOne(ctx, index.model())
+			if err != nil {
+				if !isIndexConflict(err) {
+					return err
+				}
+
+				if cache.HasLogger() {
+					cache.GetLogger().WithField("module", "mongo").Warnln(
+						"skipping conflicting index", index.name(), "for", string(collection)+":", err.Error(),
+					)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// unregisterIndexes removes the declared indexes of a Collection, used by tests
+func unregisterIndexes(collection Collection) {
+	indexesMutex.Lock()
+	defer indexesMutex.Unlock()
+
+	delete(indexes, collection)
+}
+
+// isIndexConflict returns true if an index can not be created because of existing documents with duplicate keys,
+// or because an index with the same name or keys but different options exists
+func isIndexConflict(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "E11000") ||
+		strings.Contains(message, "IndexOptionsConflict") ||
+		strings.Contains(message, "IndexKeySpecsConflict")
+}
+
+// name returns the name of the index, or the keys if no name is set
+func (i Index) name() string {
+	if i.Name != "" {
+		return i.Name
+	}
+
+	keys := make([]string, len(i.Keys))
+	for n, key := range i.Keys {
+		keys[n] = key.Field
+	}
+	return strings.Join(keys, ",")
+}
+
+// model returns the index model used by the driver
+func (i Index) model() mongo.IndexModel {
+	keys := bson.NewDocument()
+	for _, key := range i.Keys {
+		direction := int32(1)
+		if key.Descending {
+			direction = -1
+		}
+		keys.Append(bson.EC.Int32(key.Field, direction))
+	}
+
+	options := bson.NewDocument()
+	if i.Unique {
+		options.Append(bson.EC.Boolean("unique", true))
+	}
+	if i.ExpireAfter > 0 {
+		options.Append(bson.EC.Int32("expireAfterSeconds", int32(i.ExpireAfter/time.Second)))
+	}
+	if i.Name != "" {
+		options.Append(bson.EC.String("name", i.Name))
+	}
+
+	return mongo.IndexModel{
+		Keys:    keys,
+		Options: options,
+	}
+}
@@ -0,0 +1,94 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"gitlab.com/Cacophony/dhelpers/metrics"
+)
+
+// SlowQueryThreshold is the duration above which operations are logged as slow queries, 0 disables the log
+var SlowQueryThreshold = 500 * time.Millisecond
+
+// startOperation starts a span for a repository operation, tagged with the collection, operation and filter shape
+// the returned function finishes the span, records the latency and errors, and logs slow queries
+func (r *basicRepositoryUsecase) startOperation(ctx context.Context, operation string, filter interface{}) (context.Context, func(err *error)) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "dhelpers.mongo."+operation)
+	span.SetTag("mongo.collection", string(r.collectionName))
+	span.SetTag("mongo.operation", operation)
+	shape := FilterShape(filter)
+	if filter != nil {
+		span.SetTag("mongo.filter", shape)
+	}
+
+	started := time.Now()
+	return ctx, func(err *error) {
+		duration := time.Since(started)
+
+		metrics.MapHistogram(metrics.MongoLatency, string(r.collectionName)).Observe(
+			float64(duration) / float64(time.Millisecond),
+		)
+
+		// ErrNotFound is an expected result, not a failure
+		if err != nil && *err != nil && *err != ErrNotFound {
+			metrics.MongoErrors.Add(string(r.collectionName), 1)
+			ext.Error.Set(span, true)
+			span.LogKV("error.message", (*err).Error())
+		}
+
+		if SlowQueryThreshold > 0 && duration > SlowQueryThreshold && cache.HasLogger() {
+			cache.GetLogger().WithField("module", "mongo").WithField("collection", string(r.collectionName)).Warnln(
+				"slow query:", operation, shape, "took", duration.String(),
+			)
+		}
+
+		span.Finish()
+	}
+}
+
+// FilterShape returns the structure of a filter as JSON, all values are replaced by ?
+// for example {"userid": "123", "time": {"$gte": date}} becomes {"time":{"$gte":"?"},"userid":"?"}
+func FilterShape(filter interface{}) string {
+	data, err := json.Marshal(filterShape(reflect.ValueOf(filter)))
+	if err != nil {
+		return "?"
+	}
+	return string(data)
+}
+
+func filterShape(value reflect.Value) interface{} {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "?"
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Map:
+		shape := make(map[string]interface{})
+		for _, key := range value.MapKeys() {
+			shape[fmt.Sprint(key.Interface())] = filterShape(value.MapIndex(key))
+		}
+		return shape
+	case reflect.Slice:
+		// lists of values, for example $in, are reduced to a single ?, lists of filters, for example $and, keep their shape
+		var shape []interface{}
+		for i := 0; i < value.Len(); i++ {
+			elementShape := filterShape(value.Index(i))
+			if elementShape == "?" {
+				return []interface{}{"?"}
+			}
+			shape = append(shape, elementShape)
+		}
+		return shape
+	}
+
+	return "?"
+}
@@ -0,0 +1,34 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilterShape(t *testing.T) {
+	tests := []struct {
+		filter   interface{}
+		expected string
+	}{
+		{nil, `"?"`},
+		{map[string]string{"userid": "123"}, `{"userid":"?"}`},
+		{
+			map[string]interface{}{
+				"userid": "123",
+				"time":   map[string]time.Time{"$gte": time.Now()},
+			},
+			`{"time":{"$gte":"?"},"userid":"?"}`,
+		},
+		{map[string]map[string][]string{"userid": {"$in": {"1", "2", "3"}}}, `{"userid":{"$in":["?"]}}`},
+		{
+			map[string][]interface{}{"$and": {map[string]string{"a": "1"}, map[string]int{"b": 2}}},
+			`{"$and":[{"a":"?"},{"b":"?"}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		if shape := FilterShape(test.filter); shape != test.expected {
+			t.Error("Expected "+test.expected+", got ", shape)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bsm/redis-lock"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// defines the errors returned by RunMigrations
+var (
+	ErrMigrationsLocked = errors.New("migrations are being run by another instance")
+)
+
+// MigrationsTable is the table containing all applied migrations
+const MigrationsTable Collection = "migrations"
+
+// migrationsLockKey is the redis key of the lock held while running migrations
+const migrationsLockKey = "project-d:mongo:migrations:lock"
+
+// migrationsLockTimeout is the timeout of the lock held while running migrations, renewed while migrations are running
+var migrationsLockTimeout = 10 * time.Minute
+
+// migrationRepository contains the database logic for the MigrationsTable
+var migrationRepository = NewRepository(
+	MigrationsTable,
+	Index{Keys: []SortField{{Field: "version"}}, Unique: true},
+)
+
+// Migration changes documents of collections, for example after the fields of a struct changed
+type Migration struct {
+	// Version is the unique version of the migration, migrations are run in order of their version
+	Version int
+	// Name describes the migration
+	Name string
+	// Up runs the migration, the migration is recorded as applied if no error is returned
+	Up func(ctx context.Context) error
+}
+
+// AppliedMigration is an entry of the MigrationsTable
+type AppliedMigration struct {
+	ID        *objectid.ObjectID `bson:"_id,omitempty"`
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+var (
+	migrations      []Migration
+	migrationsMutex sync.RWMutex
+)
+
+// RegisterMigration registers a migration, it will be run by RunMigrations if it has not been applied yet
+func RegisterMigration(migration Migration) {
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+
+	migrations = append(migrations, migration)
+}
+
+// HasMigrations returns true if any migrations are registered
+func HasMigrations() bool {
+	migrationsMutex.RLock()
+	defer migrationsMutex.RUnlock()
+
+	return len(migrations) > 0
+}
+
+// RunMigrations runs all registered migrations which have not been applied yet, in order of their version
+// only one instance runs migrations at the same time, other instances wait for up to one minute
+// requires a redis client for the lock, see components.InitRedis
+func RunMigrations(ctx context.Context) (applied []Migration, err error) {
+	migrationsMutex.RLock()
+	pending := make([]Migration, len(migrations))
+	copy(pending, migrations)
+	migrationsMutex.RUnlock()
+
+	if len(pending) <= 0 {
+		return nil, nil
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Version < pending[j].Version
+	})
+
+	locker := lock.New(cache.GetRedisClient(), migrationsLockKey, &lock.Options{
+		LockTimeout: migrationsLockTimeout,
+		RetryCount:  60,
+		RetryDelay:  1 * time.Second,
+	})
+	locked, err := locker.LockWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrMigrationsLocked
+	}
+	defer locker.Unlock() // nolint: errcheck
+
+	// renew the lock while migrations are running, long migrations would lose it otherwise
+	// migrations are cancelled if the lock is lost
+	ctx, cancel := context.WithCancel(ctx)
+	lockLost := make(chan struct{})
+	renewStopped := make(chan struct{})
+	go func() {
+		defer close(renewStopped)
+		renewMigrationsLock(ctx, cancel, locker, lockLost)
+	}()
+	defer func() {
+		// stop renewing before unlocking
+		cancel()
+		<-renewStopped
+	}()
+
+	// read applied migrations after locking, another instance might have applied migrations in the meantime
+	var appliedMigrations []AppliedMigration
+	err = migrationRepository.Find(ctx, map[string]interface{}{}, &appliedMigrations)
+	if err != nil {
+		return nil, err
+	}
+	appliedVersions := make(map[int]bool)
+	for _, appliedMigration := range appliedMigrations {
+		appliedVersions[appliedMigration.Version] = true
+	}
+
+	for _, migration := range pending {
+		if appliedVersions[migration.Version] {
+			continue
+		}
+
+		err = migration.Up(ctx)
+		select {
+		case <-lockLost:
+			return applied, ErrMigrationsLocked
+		default:
+		}
+		if err != nil {
+			return applied, err
+		}
+
+		_, err = migrationRepository.Store(ctx, &AppliedMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+		})
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// renewMigrationsLock renews the lock until the context is done, closes lockLost and cancels the context if the lock is lost
+func renewMigrationsLock(ctx context.Context, cancel context.CancelFunc, locker *lock.Locker, lockLost chan struct{}) {
+	ticker := time.NewTicker(migrationsLockTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			renewed, err := locker.Lock()
+			if err != nil || !renewed {
+				close(lockLost)
+				cancel()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bsm/redis-lock"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+func TestEnsureIndexes(t *testing.T) {
+	skipWithoutMongo(t)
+
+	collection := Collection("test_" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	repository := NewRepository(collection, Index{Keys: []SortField{{Field: "name"}}, Unique: true})
+	defer dropTestCollection(collection)
+
+	err := EnsureIndexes(context.Background())
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	// existing indexes are kept
+	err = EnsureIndexes(context.Background())
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+
+	_, err = repository.Store(context.Background(), &testDocument{Name: "a"})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	_, err = repository.Store(context.Background(), &testDocument{Name: "a"})
+	if err == nil {
+		t.Error("Expected duplicate key error for unique index, got nil")
+	}
+}
+
+func TestEnsureIndexes_Conflict(t *testing.T) {
+	skipWithoutMongo(t)
+
+	collection := Collection("test_" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	repository := NewRepository(collection)
+	defer dropTestCollection(collection)
+
+	// existing documents with duplicate values
+	for i := 0; i < 2; i++ {
+		_, err := repository.Store(context.Background(), &testDocument{Name: "a"})
+		if err != nil {
+			t.Fatal("Expected no error, got ", err)
+		}
+	}
+
+	RegisterIndexes(collection, Index{Keys: []SortField{{Field: "name"}}, Unique: true})
+	err := EnsureIndexes(context.Background())
+	if err != nil {
+		t.Error("Expected conflicting index to be skipped, got ", err)
+	}
+}
+
+func TestRunMigrations(t *testing.T) {
+	skipWithoutMongo(t)
+
+	version := int(time.Now().UnixNano())
+	defer func() {
+		migrationRepository.DeleteMany( // nolint: errcheck
+			context.Background(),
+			map[string]map[string]int{"version": {"$gte": version, "$lte": version + 2}},
+		)
+
+		migrationsMutex.Lock()
+		migrations = nil
+		migrationsMutex.Unlock()
+	}()
+
+	var order []int
+	RegisterMigration(Migration{Version: version + 1, Name: "second", Up: func(ctx context.Context) error {
+		order = append(order, version+1)
+		return nil
+	}})
+	RegisterMigration(Migration{Version: version, Name: "first", Up: func(ctx context.Context) error {
+		order = append(order, version)
+		return nil
+	}})
+
+	_, err := RunMigrations(context.Background())
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	if len(order) != 2 || order[0] != version || order[1] != version+1 {
+		t.Error("Expected migrations to run in order of their version, got ", order)
+	}
+
+	// applied migrations do not run again
+	applied, err := RunMigrations(context.Background())
+	if err != nil || len(applied) != 0 || len(order) != 2 {
+		t.Error("Expected no migrations to run again, got ", applied, err)
+	}
+
+	RegisterMigration(Migration{Version: version + 2, Name: "failing", Up: func(ctx context.Context) error {
+		return errors.New("migration failed")
+	}})
+	_, err = RunMigrations(context.Background())
+	if err == nil {
+		t.Error("Expected error of failed migration, got nil")
+	}
+
+	var appliedMigrations []AppliedMigration
+	err = migrationRepository.Find(context.Background(), map[string]int{"version": version + 2}, &appliedMigrations)
+	if err != nil || len(appliedMigrations) != 0 {
+		t.Error("Expected failed migration to not be recorded, got ", appliedMigrations, err)
+	}
+}
+
+func TestRunMigrations_LongMigration(t *testing.T) {
+	skipWithoutMongo(t)
+
+	version := int(time.Now().UnixNano())
+	previousTimeout := migrationsLockTimeout
+	migrationsLockTimeout = 200 * time.Millisecond
+	defer func() {
+		migrationsLockTimeout = previousTimeout
+		migrationRepository.DeleteMany( // nolint: errcheck
+			context.Background(),
+			map[string]int{"version": version},
+		)
+
+		migrationsMutex.Lock()
+		migrations = nil
+		migrationsMutex.Unlock()
+	}()
+
+	// the migration runs longer than the lock timeout, the lock is renewed meanwhile
+	var lockedByOther bool
+	RegisterMigration(Migration{Version: version, Name: "long", Up: func(ctx context.Context) error {
+		time.Sleep(500 * time.Millisecond)
+		lockedByOther, _ = lock.New(cache.GetRedisClient(), migrationsLockKey, nil).Lock()
+		return ctx.Err()
+	}})
+
+	applied, err := RunMigrations(context.Background())
+	if err != nil || len(applied) != 1 {
+		t.Error("Expected migration to be applied, got ", applied, err)
+	}
+	if lockedByOther {
+		t.Error("Expected the lock to be held while the migration is running")
+	}
+}
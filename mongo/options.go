@@ -0,0 +1,113 @@
+package mongo
+
+import (
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+)
+
+// SortField is a field to sort the results of a Find by
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// FindOptions configures FindWithOptions
+type FindOptions struct {
+	// Limit is the maximum number of documents to return, 0 returns all documents
+	Limit int64
+	// Skip is the number of documents to skip, prefer After for pagination of large collections
+	Skip int64
+	// Sort is the sort order of the documents, fields are sorted in the given order
+	Sort []SortField
+	// Projection limits the fields returned, for example map[string]int{"userid": 1}
+	Projection interface{}
+	// After only returns documents with an _id greater than After, to paginate by the last _id of the previous page
+	// the documents are sorted by _id if no Sort is set
+	After *objectid.ObjectID
+}
+
+// filter adds the pagination cursor to a filter
+func (o FindOptions) filter(filter interface{}) interface{} {
+	if o.After == nil {
+		return filter
+	}
+
+	return map[string][]interface{}{
+		"$and": {
+			filter,
+			map[string]map[string]objectid.ObjectID{"_id": {"$gt": *o.After}},
+		},
+	}
+}
+
+// options returns the driver options for a find
+func (o FindOptions) options() (options []findopt.Find) {
+	if o.Limit > 0 {
+		options = append(options, findopt.Limit(o.Limit))
+	}
+	if o.Skip > 0 {
+		options = append(options, findopt.Skip(o.Skip))
+	}
+
+	sort := o.Sort
+	if len(sort) <= 0 && o.After != nil {
+		sort = []SortField{{Field: "_id"}}
+	}
+	if len(sort) > 0 {
+		sortDocument := bson.NewDocument()
+		for _, field := range sort {
+			direction := int32(1)
+			if field.Descending {
+				direction = -1
+			}
+			sortDocument.Append(bson.EC.Int32(field.Field, direction))
+		}
+		options = append(options, findopt.Sort(sortDocument))
+	}
+
+	if o.Projection != nil {
+		options = append(options, findopt.Projection(o.Projection))
+	}
+
+	return options
+}
+
+// WriteOperationType is the type of a WriteOperation
+type WriteOperationType int
+
+// defines the possible types of a WriteOperation
+const (
+	InsertOneOperation WriteOperationType = iota
+	UpdateOneOperation
+	UpdateManyOperation
+	DeleteOneOperation
+	DeleteManyOperation
+)
+
+// WriteOperation is a single operation of a BulkWrite
+type WriteOperation struct {
+	Type WriteOperationType
+	// Filter selects the documents to update or delete
+	Filter interface{}
+	// Document is the document to insert, or the update to apply
+	Document interface{}
+	// Upsert inserts a document if no document matches an update
+	Upsert bool
+}
+
+// UpdateResult contains the result of an update
+type UpdateResult struct {
+	Matched  int64
+	Modified int64
+}
+
+// BulkWriteResult contains the results of all operations of a BulkWrite
+// if the BulkWrite failed it contains the results of the operations before the failed operation
+type BulkWriteResult struct {
+	Inserted int64
+	Matched  int64
+	Modified int64
+	Upserted int64
+	Deleted  int64
+}
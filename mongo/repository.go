@@ -9,6 +9,8 @@ import (
 
 	"github.com/mongodb/mongo-go-driver/bson/objectid"
 	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/mongodb/mongo-go-driver/mongo/mongoopt"
 	"github.com/mongodb/mongo-go-driver/mongo/updateopt"
 	"gitlab.com/Cacophony/dhelpers/cache"
 )
@@ -20,19 +22,30 @@ type Collection string
 type BasicRepository interface {
 	GetByID(ctx context.Context, id objectid.ObjectID, result interface{}) error
 	Find(ctx context.Context, filter interface{}, result interface{}) error
+	FindWithOptions(ctx context.Context, filter interface{}, options FindOptions, result interface{}) error
 	FindOne(ctx context.Context, filter interface{}, result interface{}) error
+	FindOneAndUpdate(ctx context.Context, filter interface{}, document interface{}, upsert bool, result interface{}) error
 	UpdateByID(ctx context.Context, id objectid.ObjectID, document interface{}) error
 	Update(ctx context.Context, filter interface{}, document interface{}) error
+	UpdateMany(ctx context.Context, filter interface{}, document interface{}) (UpdateResult, error)
 	UpsertByID(ctx context.Context, id objectid.ObjectID, document interface{}) error
 	Upsert(ctx context.Context, filter interface{}, document interface{}) error
 	Store(ctx context.Context, document interface{}) (*objectid.ObjectID, error)
+	InsertMany(ctx context.Context, documents []interface{}) ([]objectid.ObjectID, error)
 	DeleteByID(ctx context.Context, id objectid.ObjectID) error
 	Delete(ctx context.Context, filter interface{}) error
+	DeleteMany(ctx context.Context, filter interface{}) (int64, error)
+	// BulkWrite runs the operations one by one, in order, it is not a single database bulk write and not atomic
+	// it stops at the first failed operation, the previous operations stay applied and are counted in the result
+	BulkWrite(ctx context.Context, operations []WriteOperation) (BulkWriteResult, error)
 	Count(ctx context.Context, filter interface{}) (int64, error)
 }
 
 // NewRepository creates a new MongoDB Repository from a MongoDB collection with the BasicRepository type
-func NewRepository(collection Collection) BasicRepository {
+// indexes are declared for the collection, and created by EnsureIndexes
+func NewRepository(collection Collection, indexes ...Index) BasicRepository {
+	RegisterIndexes(collection, indexes...)
+
 	return &basicRepositoryUsecase{
 		collectionName: collection,
 	}
@@ -43,8 +56,6 @@ type basicRepositoryUsecase struct {
 	collection     *mongo.Collection
 }
 
-// TODO: tracing
-
 // "lazy loading" collection because mongo DB might not have been initialised yet
 func (r *basicRepositoryUsecase) initCollection() error {
 	if r.collection == nil {
@@ -61,9 +72,16 @@ func (r *basicRepositoryUsecase) GetByID(ctx context.Context, id objectid.Object
 	return r.FindOne(ctx, map[string]objectid.ObjectID{"_id": id}, &result)
 }
 
-// based on https://github.com/globalsign/mgo/blob/master/session.go#L4428
 func (r *basicRepositoryUsecase) Find(ctx context.Context, filter interface{}, result interface{}) error {
-	err := r.initCollection()
+	return r.FindWithOptions(ctx, filter, FindOptions{}, result)
+}
+
+// based on https://github.com/globalsign/mgo/blob/master/session.go#L4428
+func (r *basicRepositoryUsecase) FindWithOptions(ctx context.Context, filter interface{}, options FindOptions, result interface{}) (err error) {
+	ctx, finish := r.startOperation(ctx, "Find", filter)
+	defer finish(&err)
+
+	err = r.initCollection()
 	if err != nil {
 		return err
 	}
@@ -82,7 +100,7 @@ func (r *basicRepositoryUsecase) Find(ctx context.Context, filter interface{}, r
 		return errors.New("result argument must be a slice address")
 	}
 
-	cursor, err := r.collection.Find(ctx, filter)
+	cursor, err := r.collection.Find(ctx, options.filter(filter), options.options()...)
 	if err != nil {
 		return err
 	}
@@ -121,8 +139,11 @@ func (r *basicRepositoryUsecase) Find(ctx context.Context, filter interface{}, r
 	return cursor.Err()
 }
 
-func (r *basicRepositoryUsecase) FindOne(ctx context.Context, filter interface{}, document interface{}) error {
-	err := r.initCollection()
+func (r *basicRepositoryUsecase) FindOne(ctx context.Context, filter interface{}, document interface{}) (err error) {
+	ctx, finish := r.startOperation(ctx, "FindOne", filter)
+	defer finish(&err)
+
+	err = r.initCollection()
 	if err != nil {
 		return err
 	}
@@ -139,12 +160,41 @@ func (r *basicRepositoryUsecase) FindOne(ctx context.Context, filter interface{}
 	return err
 }
 
+// FindOneAndUpdate updates a single document, and decodes the updated document into result, can be used for atomic counters
+// returns ErrNotFound if no document matched and upsert is false
+func (r *basicRepositoryUsecase) FindOneAndUpdate(ctx context.Context, filter interface{}, document interface{}, upsert bool, result interface{}) (err error) {
+	ctx, finish := r.startOperation(ctx, "FindOneAndUpdate", filter)
+	defer finish(&err)
+
+	err = r.initCollection()
+	if err != nil {
+		return err
+	}
+
+	docResult := r.collection.FindOneAndUpdate(
+		ctx, filter, document,
+		findopt.ReturnDocument(mongoopt.After), findopt.Upsert(upsert),
+	)
+	if docResult == nil {
+		return ErrNotFound
+	}
+
+	err = docResult.Decode(result)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
 func (r *basicRepositoryUsecase) UpdateByID(ctx context.Context, id objectid.ObjectID, document interface{}) error {
 	return r.Update(ctx, map[string]objectid.ObjectID{"_id": id}, document)
 }
 
-func (r *basicRepositoryUsecase) Update(ctx context.Context, filter interface{}, document interface{}) error {
-	err := r.initCollection()
+func (r *basicRepositoryUsecase) Update(ctx context.Context, filter interface{}, document interface{}) (err error) {
+	ctx, finish := r.startOperation(ctx, "Update", filter)
+	defer finish(&err)
+
+	err = r.initCollection()
 	if err != nil {
 		return err
 	}
@@ -154,18 +204,43 @@ func (r *basicRepositoryUsecase) Update(ctx context.Context, filter interface{},
 		return err
 	}
 
-	if result.MatchedCount <= 0 || result.ModifiedCount <= 0 {
+	// a matched document which has not been modified already contained the update
+	if result.MatchedCount <= 0 {
 		return ErrNotFound
 	}
 	return nil
 }
 
+// UpdateMany updates all matching documents, does not return ErrNotFound if no documents matched
+func (r *basicRepositoryUsecase) UpdateMany(ctx context.Context, filter interface{}, document interface{}) (updateResult UpdateResult, err error) {
+	ctx, finish := r.startOperation(ctx, "UpdateMany", filter)
+	defer finish(&err)
+
+	err = r.initCollection()
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	result, err := r.collection.UpdateMany(ctx, filter, document)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	return UpdateResult{
+		Matched:  result.MatchedCount,
+		Modified: result.ModifiedCount,
+	}, nil
+}
+
 func (r *basicRepositoryUsecase) UpsertByID(ctx context.Context, id objectid.ObjectID, document interface{}) error {
 	return r.Upsert(ctx, map[string]objectid.ObjectID{"_id": id}, document)
 }
 
-func (r *basicRepositoryUsecase) Upsert(ctx context.Context, filter interface{}, document interface{}) error {
-	err := r.initCollection()
+func (r *basicRepositoryUsecase) Upsert(ctx context.Context, filter interface{}, document interface{}) (err error) {
+	ctx, finish := r.startOperation(ctx, "Upsert", filter)
+	defer finish(&err)
+
+	err = r.initCollection()
 	if err != nil {
 		return err
 	}
@@ -174,8 +249,11 @@ func (r *basicRepositoryUsecase) Upsert(ctx context.Context, filter interface{},
 	return err
 }
 
-func (r *basicRepositoryUsecase) Store(ctx context.Context, document interface{}) (*objectid.ObjectID, error) {
-	err := r.initCollection()
+func (r *basicRepositoryUsecase) Store(ctx context.Context, document interface{}) (storedID *objectid.ObjectID, err error) {
+	ctx, finish := r.startOperation(ctx, "Store", nil)
+	defer finish(&err)
+
+	err = r.initCollection()
 	if err != nil {
 		return nil, err
 	}
@@ -192,12 +270,44 @@ func (r *basicRepositoryUsecase) Store(ctx context.Context, document interface{}
 	return &id, nil
 }
 
+// InsertMany stores all documents, returns the IDs of the stored documents in the same order
+func (r *basicRepositoryUsecase) InsertMany(ctx context.Context, documents []interface{}) (ids []objectid.ObjectID, err error) {
+	ctx, finish := r.startOperation(ctx, "InsertMany", nil)
+	defer finish(&err)
+
+	err = r.initCollection()
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) <= 0 {
+		return nil, nil
+	}
+
+	result, err := r.collection.InsertMany(ctx, documents)
+	if err != nil {
+		return nil, err
+	}
+
+	ids = make([]objectid.ObjectID, 0, len(result.InsertedIDs))
+	for _, insertedID := range result.InsertedIDs {
+		id, ok := insertedID.(objectid.ObjectID)
+		if !ok {
+			return ids, errors.New("error gathering object ID")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 func (r *basicRepositoryUsecase) DeleteByID(ctx context.Context, id objectid.ObjectID) error {
 	return r.Delete(ctx, map[string]objectid.ObjectID{"_id": id})
 }
 
-func (r *basicRepositoryUsecase) Delete(ctx context.Context, filter interface{}) error {
-	err := r.initCollection()
+func (r *basicRepositoryUsecase) Delete(ctx context.Context, filter interface{}) (err error) {
+	ctx, finish := r.startOperation(ctx, "Delete", filter)
+	defer finish(&err)
+
+	err = r.initCollection()
 	if err != nil {
 		return err
 	}
@@ -213,8 +323,84 @@ func (r *basicRepositoryUsecase) Delete(ctx context.Context, filter interface{})
 	return nil
 }
 
-func (r *basicRepositoryUsecase) Count(ctx context.Context, filter interface{}) (int64, error) {
-	err := r.initCollection()
+// DeleteMany deletes all matching documents, returns the number of deleted documents
+// does not return ErrNotFound if no documents matched
+func (r *basicRepositoryUsecase) DeleteMany(ctx context.Context, filter interface{}) (deleted int64, err error) {
+	ctx, finish := r.startOperation(ctx, "DeleteMany", filter)
+	defer finish(&err)
+
+	err = r.initCollection()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// BulkWrite runs all operations one by one, in order, stops at the first failed operation
+// the operations are not atomic, previous operations are not rolled back on errors
+// the result contains the changes of all successful operations, and is returned with the error
+func (r *basicRepositoryUsecase) BulkWrite(ctx context.Context, operations []WriteOperation) (bulkResult BulkWriteResult, err error) {
+	ctx, finish := r.startOperation(ctx, "BulkWrite", nil)
+	defer finish(&err)
+
+	err = r.initCollection()
+	if err != nil {
+		return bulkResult, err
+	}
+
+	for _, operation := range operations {
+		switch operation.Type {
+		case InsertOneOperation:
+			_, err = r.collection.InsertOne(ctx, operation.Document)
+			if err != nil {
+				return bulkResult, err
+			}
+			bulkResult.Inserted++
+		case UpdateOneOperation, UpdateManyOperation:
+			var result *mongo.UpdateResult
+			if operation.Type == UpdateOneOperation {
+				result, err = r.collection.UpdateOne(ctx, operation.Filter, operation.Document, updateopt.Upsert(operation.Upsert))
+			} else {
+				result, err = r.collection.UpdateMany(ctx, operation.Filter, operation.Document, updateopt.Upsert(operation.Upsert))
+			}
+			if err != nil {
+				return bulkResult, err
+			}
+			bulkResult.Matched += result.MatchedCount
+			bulkResult.Modified += result.ModifiedCount
+			if result.UpsertedID != nil {
+				bulkResult.Upserted++
+			}
+		case DeleteOneOperation, DeleteManyOperation:
+			var result *mongo.DeleteResult
+			if operation.Type == DeleteOneOperation {
+				result, err = r.collection.DeleteOne(ctx, operation.Filter)
+			} else {
+				result, err = r.collection.DeleteMany(ctx, operation.Filter)
+			}
+			if err != nil {
+				return bulkResult, err
+			}
+			bulkResult.Deleted += result.DeletedCount
+		default:
+			return bulkResult, errors.New("invalid write operation type")
+		}
+	}
+
+	return bulkResult, nil
+}
+
+func (r *basicRepositoryUsecase) Count(ctx context.Context, filter interface{}) (count int64, err error) {
+	ctx, finish := r.startOperation(ctx, "Count", filter)
+	defer finish(&err)
+
+	err = r.initCollection()
 	if err != nil {
 		return 0, err
 	}
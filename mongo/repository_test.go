@@ -0,0 +1,253 @@
+package mongo
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+func init() {
+	// init logger
+	cache.SetLogger(logrus.NewEntry(logrus.New()))
+	// init redis
+	cache.SetRedisClient(redis.NewClient(&redis.Options{
+		Addr:     os.Getenv("REDIS_ADDRESS"),
+		Password: "",
+		DB:       0,
+	}))
+	// init mongodb, tests which require MongoDB are skipped if it is not configured
+	if os.Getenv("MONGODB_URL") == "" {
+		return
+	}
+	client, err := mongo.NewClient(os.Getenv("MONGODB_URL"))
+	if err != nil {
+		return
+	}
+	err = client.Connect(context.Background())
+	if err != nil {
+		return
+	}
+	cache.SetMongo(client.Database(os.Getenv("MONGODB_DATABASE")))
+}
+
+// skipWithoutMongo skips a test which requires MongoDB, if MONGODB_URL is not set
+func skipWithoutMongo(t *testing.T) {
+	if cache.GetMongo() == nil {
+		t.Skip("MongoDB is not configured, set MONGODB_URL to run this test")
+	}
+}
+
+type testDocument struct {
+	ID    *objectid.ObjectID `bson:"_id,omitempty"`
+	Name  string
+	Count int
+}
+
+// dropTestCollection drops a collection created by a test, and removes its declared indexes
+func dropTestCollection(collection Collection) {
+	unregisterIndexes(collection)
+	if cache.GetMongo() != nil {
+		cache.GetMongo().Collection(string(collection)).Drop(context.Background()) // nolint: errcheck
+	}
+}
+
+// newTestRepository returns a repository for a new collection, containing documents a to e with count 1 to 5
+func newTestRepository(t *testing.T) (BasicRepository, func()) {
+	skipWithoutMongo(t)
+
+	collection := Collection("test_" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	repository := NewRepository(collection)
+
+	var documents []interface{}
+	for i, name := range []string{"a", "b", "c", "d", "e"} {
+		documents = append(documents, &testDocument{Name: name, Count: i + 1})
+	}
+	ids, err := repository.InsertMany(context.Background(), documents)
+	if err != nil || len(ids) != 5 {
+		t.Fatal("Expected 5 inserted documents, got ", ids, err)
+	}
+
+	return repository, func() {
+		dropTestCollection(collection)
+	}
+}
+
+func TestBasicRepository_FindWithOptions(t *testing.T) {
+	repository, cleanup := newTestRepository(t)
+	defer cleanup()
+
+	var documents []testDocument
+	err := repository.FindWithOptions(
+		context.Background(),
+		map[string]interface{}{},
+		FindOptions{Sort: []SortField{{Field: "count", Descending: true}}, Skip: 1, Limit: 2},
+		&documents,
+	)
+	if err != nil || len(documents) != 2 || documents[0].Name != "d" || documents[1].Name != "c" {
+		t.Error("Expected documents d and c, got ", documents, err)
+	}
+
+	documents = nil
+	err = repository.FindWithOptions(
+		context.Background(),
+		map[string]interface{}{},
+		FindOptions{Projection: map[string]int{"name": 1}, Limit: 1, Sort: []SortField{{Field: "name"}}},
+		&documents,
+	)
+	if err != nil || len(documents) != 1 || documents[0].Name != "a" || documents[0].Count != 0 {
+		t.Error("Expected document a without count, got ", documents, err)
+	}
+
+	// paginate using the last _id of the previous page
+	var names string
+	var after *objectid.ObjectID
+	for {
+		var page []testDocument
+		err = repository.FindWithOptions(
+			context.Background(),
+			map[string]map[string]int{"count": {"$gt": 1}},
+			FindOptions{Limit: 2, After: after},
+			&page,
+		)
+		if err != nil {
+			t.Error("Expected no error, got ", err)
+			return
+		}
+		if len(page) <= 0 {
+			break
+		}
+		for _, document := range page {
+			names += document.Name
+		}
+		after = page[len(page)-1].ID
+	}
+	if names != "bcde" {
+		t.Error("Expected pages to contain bcde, got ", names)
+	}
+}
+
+func TestBasicRepository_Update(t *testing.T) {
+	repository, cleanup := newTestRepository(t)
+	defer cleanup()
+
+	// matched, but not modified
+	err := repository.Update(
+		context.Background(),
+		map[string]string{"name": "a"},
+		map[string]map[string]int{"$set": {"count": 1}},
+	)
+	if err != nil {
+		t.Error("Expected no error for unchanged document, got ", err)
+	}
+
+	err = repository.Update(
+		context.Background(),
+		map[string]string{"name": "z"},
+		map[string]map[string]int{"$set": {"count": 1}},
+	)
+	if err != ErrNotFound {
+		t.Error("Expected ErrNotFound, got ", err)
+	}
+
+	result, err := repository.UpdateMany(
+		context.Background(),
+		map[string]map[string]int{"count": {"$lte": 2}},
+		map[string]map[string]int{"$set": {"count": 2}},
+	)
+	if err != nil || result.Matched != 2 || result.Modified != 1 {
+		t.Error("Expected 2 matched and 1 modified documents, got ", result, err)
+	}
+}
+
+func TestBasicRepository_FindOneAndUpdate(t *testing.T) {
+	repository, cleanup := newTestRepository(t)
+	defer cleanup()
+
+	var counter testDocument
+	for i := 1; i <= 3; i++ {
+		err := repository.FindOneAndUpdate(
+			context.Background(),
+			map[string]string{"name": "counter"},
+			map[string]map[string]int{"$inc": {"count": 1}},
+			true,
+			&counter,
+		)
+		if err != nil || counter.Count != i {
+			t.Error("Expected counter to be ", i, ", got ", counter.Count, err)
+		}
+	}
+
+	err := repository.FindOneAndUpdate(
+		context.Background(),
+		map[string]string{"name": "missing"},
+		map[string]map[string]int{"$inc": {"count": 1}},
+		false,
+		&counter,
+	)
+	if err != ErrNotFound {
+		t.Error("Expected ErrNotFound, got ", err)
+	}
+}
+
+func TestBasicRepository_BulkWrite(t *testing.T) {
+	repository, cleanup := newTestRepository(t)
+	defer cleanup()
+
+	result, err := repository.BulkWrite(context.Background(), []WriteOperation{
+		{Type: InsertOneOperation, Document: &testDocument{Name: "f", Count: 6}},
+		{Type: UpdateOneOperation, Filter: map[string]string{"name": "a"}, Document: map[string]map[string]int{"$set": {"count": 10}}},
+		{Type: UpdateOneOperation, Filter: map[string]string{"name": "g"}, Document: map[string]map[string]int{"$set": {"count": 7}}, Upsert: true},
+		{Type: DeleteManyOperation, Filter: map[string]map[string]int{"count": {"$lte": 3}}},
+	})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	if result.Inserted != 1 || result.Matched != 1 || result.Modified != 1 || result.Upserted != 1 || result.Deleted != 2 {
+		t.Error("Expected 1 inserted, 1 matched, 1 modified, 1 upserted, and 2 deleted documents, got ", result)
+	}
+
+	deleted, err := repository.DeleteMany(context.Background(), map[string]map[string]int{"count": {"$gte": 6}})
+	if err != nil || deleted != 3 {
+		t.Error("Expected 3 deleted documents, got ", deleted, err)
+	}
+
+	count, err := repository.Count(context.Background(), map[string]interface{}{})
+	if err != nil || count != 2 {
+		t.Error("Expected 2 remaining documents, got ", count, err)
+	}
+}
+
+func TestBasicRepository_BulkWriteStopsAtError(t *testing.T) {
+	repository, cleanup := newTestRepository(t)
+	defer cleanup()
+
+	result, err := repository.BulkWrite(context.Background(), []WriteOperation{
+		{Type: InsertOneOperation, Document: &testDocument{Name: "f", Count: 6}},
+		{Type: WriteOperationType(-1)},
+		{Type: InsertOneOperation, Document: &testDocument{Name: "g", Count: 7}},
+	})
+	if err == nil {
+		t.Error("Expected error for invalid operation type")
+	}
+	if result.Inserted != 1 {
+		t.Error("Expected the operation before the error to be counted, got ", result)
+	}
+
+	// the operation before the error stays applied, the operation after the error is not run
+	count, err := repository.Count(context.Background(), map[string]string{"name": "f"})
+	if err != nil || count != 1 {
+		t.Error("Expected f to be inserted, got ", count, err)
+	}
+	count, err = repository.Count(context.Background(), map[string]string{"name": "g"})
+	if err != nil || count != 0 {
+		t.Error("Expected g to not be inserted, got ", count, err)
+	}
+}
@@ -1,17 +1,33 @@
 package net
 
 import (
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/sethgrid/pester"
 )
 
-// GetHTTPClientTimeout returns a HTTP client with a specified timeout
+// sharedTransport is the transport used by all clients with keep alive, idle connections are reused between requests
+var sharedTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   10,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// GetHTTPClientTimeout returns a HTTP client with a specified timeout, using the shared transport
 func GetHTTPClientTimeout(timeout time.Duration) *http.Client {
 	// create http client with given timeout
 	return &http.Client{
-		Timeout: timeout,
+		Transport: sharedTransport,
+		Timeout:   timeout,
 	}
 }
 
@@ -3,9 +3,7 @@ package net
 import (
 	"bytes"
 	"compress/gzip"
-	"errors"
 	"io"
-	"strconv"
 
 	"net/http"
 
@@ -19,54 +17,70 @@ func pesterLogHook(e pester.ErrEntry) {
 	)
 }
 
-func readResponse(response *http.Response) ([]byte, error) {
+// readResponse reads the body of the response, returns a *StatusError if the StatusCode was not 2xx
+func readResponse(request *http.Request, response *http.Response) ([]byte, error) {
+	body, err := readBody(response, DefaultMaxResponseSize)
+
 	// Only continue if code was 200 - 299
 	if response.StatusCode < 200 || response.StatusCode > 299 {
-		return nil, errors.New("expected status 200; got " + strconv.Itoa(response.StatusCode))
+		if err != nil && err != ErrResponseTooLarge {
+			return nil, err
+		}
+		return nil, newStatusError(request, response, body)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Read body
-	if response.Body != nil {
-		defer func() {
-			closeBodyErr := response.Body.Close()
-			if closeBodyErr != nil {
-				cache.GetLogger().WithError(closeBodyErr).Errorln("error closing body")
-			}
-		}()
+	return body, nil
+}
+
+// readBody reads and closes the body of the response, decompresses gzip if required
+// maxSize	: the maximum size of the (decompressed) body in bytes, negative values disable the limit
+// if the limit is exceeded, the first maxSize bytes are returned with ErrResponseTooLarge
+func readBody(response *http.Response, maxSize int64) ([]byte, error) {
+	if response.Body == nil {
+		return nil, nil
 	}
+	defer func() {
+		closeBodyErr := response.Body.Close()
+		if closeBodyErr != nil && cache.HasLogger() {
+			cache.GetLogger().WithError(closeBodyErr).Errorln("error closing body")
+		}
+	}()
 
-	// create bytes buffer
-	buf := bytes.NewBuffer(nil)
+	var reader io.Reader = response.Body
 
 	// read content-encoding
-	switch response.Header.Get("Content-Encoding") {
-	case "gzip":
+	if response.Header.Get("Content-Encoding") == "gzip" {
 		// decompress gzip if required
-		var gzipReader *gzip.Reader
 		gzipReader, err := gzip.NewReader(response.Body)
 		if err != nil {
 			return nil, err
 		}
-		// close reader
-		if gzipReader != nil {
-			defer func() {
-				closeGzipErr := gzipReader.Close()
-				if closeGzipErr != nil {
-					cache.GetLogger().WithError(closeGzipErr).Errorln("error closing gzip reader")
-				}
-			}()
-		}
-		// copy result to buffer
-		_, err = io.Copy(buf, gzipReader)
-		if err != nil {
-			return nil, err
-		}
-	default:
-		// copy raw data to buffer
-		_, err := io.Copy(buf, response.Body)
-		if err != nil {
-			return nil, err
-		}
+		defer func() {
+			closeGzipErr := gzipReader.Close()
+			if closeGzipErr != nil && cache.HasLogger() {
+				cache.GetLogger().WithError(closeGzipErr).Errorln("error closing gzip reader")
+			}
+		}()
+		reader = gzipReader
+	}
+
+	// read one byte more than allowed to detect larger bodies
+	if maxSize >= 0 {
+		reader = io.LimitReader(reader, maxSize+1)
+	}
+
+	// create bytes buffer
+	buf := bytes.NewBuffer(nil)
+	_, err := io.Copy(buf, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxSize >= 0 && int64(buf.Len()) > maxSize {
+		return buf.Bytes()[:maxSize], ErrResponseTooLarge
 	}
 
 	// return bytes
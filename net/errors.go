@@ -0,0 +1,66 @@
+package net
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrResponseTooLarge is returned if a response body exceeds the maximum response size
+var ErrResponseTooLarge = errors.New("response body exceeds the maximum size")
+
+// statusErrorBodyLength is the maximum length of the body snippet of a StatusError, in bytes
+const statusErrorBodyLength = 512
+
+// StatusError is returned if a response has no 2xx status
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string // for example 404 Not Found
+	Body       string // the beginning of the response body
+}
+
+func (e *StatusError) Error() string {
+	message := e.Method + " " + e.URL + ": unexpected status " + e.Status
+	if e.Body != "" {
+		message += ": " + e.Body
+	}
+	return message
+}
+
+// StatusCode returns the status code of a *StatusError, returns 0 for other errors
+func StatusCode(err error) int {
+	if statusErr, ok := err.(*StatusError); ok {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+func newStatusError(request *http.Request, response *http.Response, body []byte) *StatusError {
+	if len(body) > statusErrorBodyLength {
+		body = body[:statusErrorBodyLength]
+		// remove the rest of a rune cut in half
+		for i := 0; i < utf8.UTFMax-1 && len(body) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(body); r != utf8.RuneError || size > 1 {
+				break
+			}
+			body = body[:len(body)-1]
+		}
+	}
+
+	status := response.Status
+	if status == "" {
+		status = strconv.Itoa(response.StatusCode)
+	}
+
+	return &StatusError{
+		Method:     request.Method,
+		URL:        request.URL.String(),
+		StatusCode: response.StatusCode,
+		Status:     status,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
@@ -1,13 +1,14 @@
 package net
 
 import (
+	"context"
 	"net/http"
 	"time"
 )
 
 // Get does a GET request and returns the result, returns an error if the StatusCode was not 2xx
 func Get(url string) ([]byte, error) {
-	return GetTimeout(url, time.Second*15)
+	return DefaultClient.Get(context.Background(), url)
 }
 
 // GetResilient does a GET request with up to three retries and concurrency, and returns the result, returns an error if the StatusCode was not 2xx
@@ -17,24 +18,10 @@ func GetResilient(url string) ([]byte, error) {
 
 // GetTimeout does a GET request and returns the result, with a specified timeout, returns an error if the StatusCode was not 2xx
 func GetTimeout(url string, timeout time.Duration) ([]byte, error) {
-	// Prepare request
-	request, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	// set user agent header
-	request.Header.Set("User-Agent", defaultUA)
-	// allow receiving gzip
-	request.Header.Add("Accept-Encoding", "gzip")
+	client := NewClient()
+	client.HTTPClient = GetHTTPClientTimeout(timeout)
 
-	// Do request
-	response, err := GetHTTPClientTimeoutWithoutKeepAlive(timeout).Do(request)
-	if err != nil {
-		return nil, err
-	}
-
-	// read body or return error
-	return readResponse(response)
+	return client.Get(context.Background(), url)
 }
 
 // GetTimeoutAndRetries does a GET request, with up to n retries, and returns the result, with a specified timeout, returns an error if the StatusCode was not 2xx
@@ -56,5 +43,5 @@ func GetTimeoutAndRetries(url string, timeout time.Duration, retries int) ([]byt
 	}
 
 	// read body or return error
-	return readResponse(response)
+	return readResponse(request, response)
 }
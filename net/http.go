@@ -0,0 +1,194 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/json-iterator/go"
+)
+
+// DefaultMaxResponseSize is the maximum size of response bodies read by a Client, in bytes
+const DefaultMaxResponseSize = 20 << 20 // 20 MB
+
+// DefaultClient is a Client with the default options, used by Get, GetTimeout, and GetResilient
+var DefaultClient = NewClient()
+
+// Client does HTTP requests using a shared transport with keep alive
+// responses without a 2xx status are returned as *StatusError
+type Client struct {
+	// HTTPClient is used to do requests, default uses the shared transport and a timeout of 15 seconds
+	HTTPClient *http.Client
+	// Headers are set on every request, for example Authorization
+	Headers http.Header
+	// UserAgent is set on every request, default Cacophony/version
+	UserAgent string
+	// MaxResponseSize is the maximum size of response bodies in bytes, larger responses return ErrResponseTooLarge
+	// default DefaultMaxResponseSize, negative values disable the limit
+	MaxResponseSize int64
+	// AllowedContentTypes are the allowed media types of 2xx responses, other responses return ErrBlockedContentType
+	// entries ending with / allow all subtypes, for example image/, all types are allowed if empty
+	AllowedContentTypes []string
+}
+
+// Response is the response of a request done by a Client
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// NewClient creates a Client with the default options
+func NewClient() *Client {
+	return &Client{
+		HTTPClient:      GetHTTPClientTimeout(15 * time.Second),
+		Headers:         make(http.Header),
+		UserAgent:       defaultUA,
+		MaxResponseSize: DefaultMaxResponseSize,
+	}
+}
+
+// Do does the request, and reads the response
+// returns a *StatusError if the StatusCode was not 2xx, and ErrResponseTooLarge if the body of a 2xx response exceeds MaxResponseSize
+// the headers of the request are not modified
+func (c *Client) Do(ctx context.Context, request *http.Request) (response *Response, err error) {
+	request = request.WithContext(ctx)
+
+	// WithContext does a shallow copy, copy the headers to not modify the request of the caller
+	header := make(http.Header, len(request.Header))
+	for key, values := range request.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	request.Header = header
+
+	for key, values := range c.Headers {
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+	if request.Header.Get("User-Agent") == "" && c.UserAgent != "" {
+		request.Header.Set("User-Agent", c.UserAgent)
+	}
+	// allow receiving gzip
+	if request.Header.Get("Accept-Encoding") == "" {
+		request.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	httpResponse, err := c.HTTPClient.Do(request)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok && isSafeFetchError(urlErr.Err) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
+
+	if len(c.AllowedContentTypes) > 0 &&
+		httpResponse.StatusCode >= 200 && httpResponse.StatusCode <= 299 &&
+		!contentTypeAllowed(c.AllowedContentTypes, httpResponse.Header.Get("Content-Type")) {
+		httpResponse.Body.Close() // nolint: errcheck, gosec
+		return nil, ErrBlockedContentType
+	}
+
+	body, err := readBody(httpResponse, c.MaxResponseSize)
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		// the StatusError only contains the beginning of the body, large bodies are not an error
+		if err != nil && err != ErrResponseTooLarge {
+			return nil, err
+		}
+		return nil, newStatusError(request, httpResponse, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		StatusCode: httpResponse.StatusCode,
+		Header:     httpResponse.Header,
+		Body:       body,
+	}, nil
+}
+
+// Request does a request with the given method and body, and returns the response body
+// headers	: additional headers for this request, can be nil
+func (c *Client) Request(ctx context.Context, method, url string, body io.Reader, headers http.Header) (data []byte, err error) {
+	request, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range headers {
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+
+	response, err := c.Do(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// Get does a GET request and returns the response body
+func (c *Client) Get(ctx context.Context, url string) (data []byte, err error) {
+	return c.Request(ctx, http.MethodGet, url, nil, nil)
+}
+
+// Post does a POST request and returns the response body
+func (c *Client) Post(ctx context.Context, url, contentType string, body io.Reader) (data []byte, err error) {
+	return c.Request(ctx, http.MethodPost, url, body, http.Header{"Content-Type": {contentType}})
+}
+
+// Put does a PUT request and returns the response body
+func (c *Client) Put(ctx context.Context, url, contentType string, body io.Reader) (data []byte, err error) {
+	return c.Request(ctx, http.MethodPut, url, body, http.Header{"Content-Type": {contentType}})
+}
+
+// Delete does a DELETE request and returns the response body
+func (c *Client) Delete(ctx context.Context, url string) (data []byte, err error) {
+	return c.Request(ctx, http.MethodDelete, url, nil, nil)
+}
+
+// GetJSON does a GET request and decodes the JSON response into result
+func (c *Client) GetJSON(ctx context.Context, url string, result interface{}) (err error) {
+	return c.RequestJSON(ctx, http.MethodGet, url, nil, result)
+}
+
+// PostJSON does a POST request with the payload encoded as JSON, and decodes the JSON response into result
+func (c *Client) PostJSON(ctx context.Context, url string, payload, result interface{}) (err error) {
+	return c.RequestJSON(ctx, http.MethodPost, url, payload, result)
+}
+
+// PutJSON does a PUT request with the payload encoded as JSON, and decodes the JSON response into result
+func (c *Client) PutJSON(ctx context.Context, url string, payload, result interface{}) (err error) {
+	return c.RequestJSON(ctx, http.MethodPut, url, payload, result)
+}
+
+// RequestJSON does a request with the payload encoded as JSON, and decodes the JSON response into result
+// payload	: sent as the request body, no body is sent if nil
+// result	: the response is not decoded if nil, or if the response is empty
+func (c *Client) RequestJSON(ctx context.Context, method, url string, payload, result interface{}) (err error) {
+	headers := http.Header{"Accept": {"application/json"}}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := jsoniter.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		headers.Set("Content-Type", "application/json")
+	}
+
+	data, err := c.Request(ctx, method, url, body, headers)
+	if err != nil {
+		return err
+	}
+
+	if result == nil || len(data) <= 0 {
+		return nil
+	}
+	return jsoniter.Unmarshal(data, result)
+}
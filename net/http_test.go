@@ -0,0 +1,149 @@
+package net
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClient_RequestJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"method":"` + r.Method + `","body":` + string(body) + `}`)) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.Headers.Set("Authorization", "Bearer token")
+
+	var result struct {
+		Method string
+		Body   map[string]int
+	}
+	err := client.PostJSON(context.Background(), server.URL, map[string]int{"a": 1}, &result)
+	if err != nil || result.Method != "POST" || result.Body["a"] != 1 {
+		t.Error("Expected POST with body a=1, got ", result, err)
+	}
+
+	err = NewClient().GetJSON(context.Background(), server.URL, &result)
+	if StatusCode(err) != http.StatusUnauthorized {
+		t.Error("Expected status 401, got ", err)
+	}
+}
+
+func TestClient_StatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(strings.Repeat("a", 1000))) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	_, err := NewClient().Delete(context.Background(), server.URL)
+	statusErr, ok := err.(*StatusError)
+	if !ok {
+		t.Fatal("Expected *StatusError, got ", err)
+	}
+	if statusErr.StatusCode != http.StatusNotFound || statusErr.Method != "DELETE" || len(statusErr.Body) != statusErrorBodyLength {
+		t.Error("Expected DELETE with status 404 and body snippet, got ", statusErr.Method, statusErr.StatusCode, len(statusErr.Body))
+	}
+	if !strings.Contains(statusErr.Error(), "404 Not Found") {
+		t.Error("Expected error to contain the status, got ", statusErr.Error())
+	}
+
+	// bodies of error responses larger than the limit still return the StatusError
+	client := NewClient()
+	client.MaxResponseSize = 100
+	_, err = client.Get(context.Background(), server.URL)
+	statusErr, ok = err.(*StatusError)
+	if !ok || statusErr.StatusCode != http.StatusNotFound || statusErr.Body != strings.Repeat("a", 100) {
+		t.Error("Expected *StatusError with status 404 and the truncated body, got ", err)
+	}
+}
+
+func TestClient_DoHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join(r.Header["X-Test"], ","))) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.Headers.Set("X-Test", "client")
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("X-Test", "request")
+
+	// the same request can be done again, without adding the client headers twice
+	for i := 0; i < 2; i++ {
+		response, err := client.Do(context.Background(), request)
+		if err != nil || string(response.Body) != "request,client" {
+			t.Error("Expected headers request,client, got ", response, err)
+		}
+	}
+	if len(request.Header) != 1 || request.Header.Get("X-Test") != "request" {
+		t.Error("Expected headers of the request to not be modified, got ", request.Header)
+	}
+}
+
+func TestClient_MaxResponseSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := []byte(strings.Repeat("a", 100))
+		if r.URL.Query().Get("gzip") != "" {
+			buf := bytes.NewBuffer(nil)
+			gzipWriter := gzip.NewWriter(buf)
+			gzipWriter.Write(data) // nolint: errcheck
+			gzipWriter.Close()     // nolint: errcheck
+			w.Header().Set("Content-Encoding", "gzip")
+			data = buf.Bytes()
+		}
+		w.Write(data) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.MaxResponseSize = 100
+	data, err := client.Get(context.Background(), server.URL)
+	if err != nil || len(data) != 100 {
+		t.Error("Expected 100 bytes, got ", len(data), err)
+	}
+	data, err = client.Get(context.Background(), server.URL+"?gzip=1")
+	if err != nil || len(data) != 100 {
+		t.Error("Expected 100 decompressed bytes, got ", len(data), err)
+	}
+
+	client.MaxResponseSize = 99
+	_, err = client.Get(context.Background(), server.URL)
+	if err != ErrResponseTooLarge {
+		t.Error("Expected ErrResponseTooLarge, got ", err)
+	}
+	_, err = client.Get(context.Background(), server.URL+"?gzip=1")
+	if err != ErrResponseTooLarge {
+		t.Error("Expected ErrResponseTooLarge for decompressed body, got ", err)
+	}
+}
+
+func TestClient_Context(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewClient().Get(ctx, server.URL)
+	if err == nil {
+		t.Error("Expected error for cancelled context, got nil")
+	}
+}
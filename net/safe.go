@@ -0,0 +1,319 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defines the errors returned when fetching URLs using a safe Client
+var (
+	ErrBlockedAddress     = errors.New("address is not allowed")
+	ErrBlockedScheme      = errors.New("scheme is not allowed")
+	ErrBlockedPort        = errors.New("port is not allowed")
+	ErrBlockedContentType = errors.New("content type is not allowed")
+	ErrTooManyRedirects   = errors.New("too many redirects")
+	errInvalidDialAddress = errors.New("invalid dial address")
+)
+
+// safeFetchErrors are returned unwrapped by a safe Client
+var safeFetchErrors = []error{ErrBlockedAddress, ErrBlockedScheme, ErrBlockedPort, ErrTooManyRedirects, errInvalidDialAddress}
+
+// blockedNetworks are the networks a safe Client does not connect to
+var blockedNetworks = parseNetworks(
+	"0.0.0.0/8",       // this network
+	"10.0.0.0/8",      // private
+	"100.64.0.0/10",   // carrier-grade NAT
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local, includes cloud metadata services
+	"172.16.0.0/12",   // private
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"192.168.0.0/16",  // private
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved, includes broadcast
+	"::/128",          // unspecified
+	"::1/128",         // loopback
+	"64:ff9b::/96",    // IPv4/IPv6 translation
+	"100::/64",        // discard
+	"2001:db8::/32",   // documentation
+	"fc00::/7",        // unique local
+	"fe80::/10",       // link-local
+	"ff00::/8",        // multicast
+)
+
+// SafeOptions configures a Client created by NewSafeClient
+type SafeOptions struct {
+	// AllowedSchemes are the allowed URL schemes, default http and https
+	AllowedSchemes []string
+	// AllowedPorts are the allowed ports, default 80 and 443
+	AllowedPorts []int
+	// AllowedContentTypes are the allowed media types of responses, all types are allowed if empty
+	// entries ending with / allow all subtypes, for example image/
+	AllowedContentTypes []string
+	// AllowedNetworks are exempt from the blocked networks, for example trusted internal services, optional
+	AllowedNetworks []*net.IPNet
+	// MaxRedirects is the maximum number of redirects followed, default 5
+	MaxRedirects int
+	// MaxResponseSize is the maximum size of response bodies in bytes, default DefaultMaxResponseSize
+	MaxResponseSize int64
+	// Timeout is the timeout of a request including redirects, default 15 seconds
+	Timeout time.Duration
+}
+
+// DefaultSafeClient is a safe Client with the default options, used by SafeGet
+var DefaultSafeClient = NewSafeClient(SafeOptions{})
+
+// SafeGet does a GET request for a user supplied URL using the DefaultSafeClient, see NewSafeClient
+func SafeGet(ctx context.Context, url string) (data []byte, err error) {
+	return DefaultSafeClient.Get(ctx, url)
+}
+
+// NewSafeClient creates a Client for user supplied URLs
+// connections to private, loopback, link-local, and other internal addresses are rejected with ErrBlockedAddress
+// the host is resolved and checked when connecting, and the checked address is connected to
+// so redirects and DNS rebinding are covered as well
+// schemes and ports are checked for every request, including redirects
+func NewSafeClient(options SafeOptions) *Client {
+	if len(options.AllowedSchemes) <= 0 {
+		options.AllowedSchemes = []string{"http", "https"}
+	}
+	if len(options.AllowedPorts) <= 0 {
+		options.AllowedPorts = []int{80, 443}
+	}
+	if options.MaxRedirects <= 0 {
+		options.MaxRedirects = 5
+	}
+	if options.MaxResponseSize == 0 {
+		options.MaxResponseSize = DefaultMaxResponseSize
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 15 * time.Second
+	}
+
+	dialer := &safeDialer{
+		options: options,
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+	}
+
+	client := NewClient()
+	client.MaxResponseSize = options.MaxResponseSize
+	client.AllowedContentTypes = options.AllowedContentTypes
+	client.HTTPClient = &http.Client{
+		Transport: &safeTransport{
+			options: options,
+			transport: &http.Transport{
+				// no proxy, the proxy would connect to the addresses instead
+				Proxy:                 nil,
+				DialContext:           dialer.DialContext,
+				MaxIdleConns:          100,
+				MaxIdleConnsPerHost:   10,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) > options.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return nil
+		},
+		Timeout: options.Timeout,
+	}
+	return client
+}
+
+// safeDialer resolves the host itself, and only connects to the resolved addresses if all of them are allowed
+type safeDialer struct {
+	options SafeOptions
+	dialer  *net.Dialer
+}
+
+func (d *safeDialer) DialContext(ctx context.Context, network, address string) (conn net.Conn, err error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errInvalidDialAddress
+	}
+
+	ipAddresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ipAddresses) <= 0 {
+		return nil, errInvalidDialAddress
+	}
+
+	addresses := make([]string, len(ipAddresses))
+	for i, ipAddress := range ipAddresses {
+		addresses[i] = net.JoinHostPort(ipAddress.IP.String(), port)
+		err = d.options.checkAddress(addresses[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// connect to the checked IP literals, so the host is not resolved again
+	for _, address := range addresses {
+		conn, err = d.dialer.DialContext(ctx, network, address)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// safeTransport checks the scheme and port of every request, including redirects
+type safeTransport struct {
+	options   SafeOptions
+	transport http.RoundTripper
+}
+
+func (t *safeTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	err := t.options.checkURL(request.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := t.transport.RoundTrip(request)
+	if err != nil {
+		// return the errors of the dialer unwrapped
+		if isSafeFetchError(err) {
+			return nil, err
+		}
+		if opErr, ok := err.(*net.OpError); ok && isSafeFetchError(opErr.Err) {
+			return nil, opErr.Err
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+// checkURL checks the scheme and port of the URL
+func (options SafeOptions) checkURL(requestURL *url.URL) (err error) {
+	scheme := strings.ToLower(requestURL.Scheme)
+	if !containsString(options.AllowedSchemes, scheme) {
+		return ErrBlockedScheme
+	}
+
+	port := requestURL.Port()
+	if port == "" {
+		switch scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	return options.checkPort(port)
+}
+
+// checkAddress checks the resolved ip:port a connection is opened to
+func (options SafeOptions) checkAddress(address string) (err error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return errInvalidDialAddress
+	}
+
+	err = options.checkPort(port)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errInvalidDialAddress
+	}
+	if !IsPublicIP(ip) && !containsIP(options.AllowedNetworks, ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+func (options SafeOptions) checkPort(port string) (err error) {
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return ErrBlockedPort
+	}
+	for _, allowed := range options.AllowedPorts {
+		if allowed == portNumber {
+			return nil
+		}
+	}
+	return ErrBlockedPort
+}
+
+// IsPublicIP returns false for private, loopback, link-local, multicast, and other reserved addresses
+func IsPublicIP(ip net.IP) bool {
+	// check IPv4-mapped IPv6 addresses as IPv4 addresses
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return !containsIP(blockedNetworks, ip)
+}
+
+// contentTypeAllowed returns true if the media type of the content type matches one of the allowed types
+func contentTypeAllowed(allowed []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, allowedType := range allowed {
+		allowedType = strings.ToLower(allowedType)
+		if mediaType == allowedType || (strings.HasSuffix(allowedType, "/") && strings.HasPrefix(mediaType, allowedType)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSafeFetchError(err error) bool {
+	for _, safeFetchErr := range safeFetchErrors {
+		if err == safeFetchErr {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNetworks(cidrs ...string) (networks []*net.IPNet) {
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,131 @@
+package net
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for address, public := range map[string]bool{
+		"8.8.8.8":          true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.20.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"::ffff:127.0.0.1": false,
+		"::ffff:8.8.8.8":   true,
+	} {
+		if IsPublicIP(net.ParseIP(address)) != public {
+			t.Error("Expected IsPublicIP(", address, ") to be ", public)
+		}
+	}
+}
+
+// newSafeTestServer starts a server listening on the given loopback address
+func newSafeTestServer(t *testing.T, address string, handler http.Handler) (*httptest.Server, int) {
+	listener, err := net.Listen("tcp", address+":0")
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+	return server, port
+}
+
+func TestSafeClient_BlockedAddress(t *testing.T) {
+	server, port := newSafeTestServer(t, "127.0.0.1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal")) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	client := NewSafeClient(SafeOptions{AllowedPorts: []int{port}})
+	for _, target := range []string{
+		server.URL,
+		"http://localhost:" + strconv.Itoa(port),
+		"http://[::ffff:127.0.0.1]:" + strconv.Itoa(port),
+	} {
+		_, err := client.Get(context.Background(), target)
+		if err != ErrBlockedAddress {
+			t.Error("Expected ErrBlockedAddress for ", target, ", got ", err)
+		}
+	}
+
+	_, err := NewSafeClient(SafeOptions{}).Get(context.Background(), server.URL)
+	if err != ErrBlockedPort {
+		t.Error("Expected ErrBlockedPort, got ", err)
+	}
+
+	_, err = client.Get(context.Background(), "ftp://127.0.0.1:"+strconv.Itoa(port))
+	if err != ErrBlockedScheme {
+		t.Error("Expected ErrBlockedScheme, got ", err)
+	}
+}
+
+func TestSafeClient_Redirect(t *testing.T) {
+	internal, internalPort := newSafeTestServer(t, "127.0.0.2", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal")) // nolint: errcheck
+	}))
+	defer internal.Close()
+
+	// the server on 127.0.0.1 is allowed, and redirects to the blocked server on 127.0.0.2
+	var external *httptest.Server
+	external, externalPort := newSafeTestServer(t, "127.0.0.1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/internal":
+			http.Redirect(w, r, internal.URL, http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, external.URL+"/loop", http.StatusFound)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png")) // nolint: errcheck
+		case "/redirect-image":
+			http.Redirect(w, r, external.URL+"/image", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("html")) // nolint: errcheck
+		}
+	}))
+	defer external.Close()
+
+	client := NewSafeClient(SafeOptions{
+		AllowedPorts:        []int{externalPort, internalPort},
+		AllowedNetworks:     parseNetworks("127.0.0.1/32"),
+		AllowedContentTypes: []string{"image/"},
+	})
+
+	_, err := client.Get(context.Background(), external.URL+"/internal")
+	if err != ErrBlockedAddress {
+		t.Error("Expected ErrBlockedAddress after redirect, got ", err)
+	}
+
+	_, err = client.Get(context.Background(), external.URL+"/loop")
+	if err != ErrTooManyRedirects {
+		t.Error("Expected ErrTooManyRedirects, got ", err)
+	}
+
+	_, err = client.Get(context.Background(), external.URL+"/html")
+	if err != ErrBlockedContentType {
+		t.Error("Expected ErrBlockedContentType, got ", err)
+	}
+
+	data, err := client.Get(context.Background(), external.URL+"/redirect-image")
+	if err != nil || string(data) != "png" {
+		t.Error("Expected png, got ", string(data), err)
+	}
+}
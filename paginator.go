@@ -0,0 +1,355 @@
+package dhelpers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/go-redis/redis"
+	"github.com/json-iterator/go"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// defines the reactions used to control a Paginator
+const (
+	PaginatorEmojiPrevious = "◀"
+	PaginatorEmojiNext     = "▶"
+	PaginatorEmojiStop     = "⏹"
+)
+
+const (
+	// paginatorExpiry is the duration after the last interaction after which a Paginator stops reacting
+	paginatorExpiry = 15 * time.Minute
+	// paginatorRetries is the number of attempts to change the page if the Paginator is changed concurrently
+	paginatorRetries = 5
+)
+
+// ErrPaginatorChanged is returned if a Paginator has been changed or stopped since it was read
+var ErrPaginatorChanged = errors.New("paginator has been changed or stopped concurrently")
+
+// paginatorStoreScript stores the state of a Paginator if its version did not change since it was read
+// a new Paginator is only stored if the key does not exist, an existing Paginator is never recreated after it got stopped
+// KEYS[1]: the paginator key
+// ARGV[1]: the version the state was read with, 0 for a new Paginator
+// ARGV[2]: the new state
+// ARGV[3]: the expiry in milliseconds
+// returns 1 if the state has been stored
+var paginatorStoreScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if tonumber(ARGV[1]) == 0 then
+	if current then
+		return 0
+	end
+elseif not current or cjson.decode(current).Version ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// Paginator is a single message users can page through using reactions
+// the state is stored in redis, so any processor instance can handle the reactions
+type Paginator struct {
+	BotUserID string
+	Module    string // the module which created the Paginator, only this module will handle reactions
+	ChannelID string
+	MessageID string
+	Pages     []string                  // set for text pages
+	Embeds    []*discordgo.MessageEmbed // set for embed pages
+	Page      int                       // the current page, starting at 0
+	UserIDs   []string                  // if set only these users can change pages
+	ExpiresAt time.Time
+	Version   int // incremented on every change, to detect concurrent changes
+}
+
+func paginatorKey(messageID string) (key string) {
+	return "project-d:paginator:" + messageID
+}
+
+// PagesFromContent splits a long text into pages, to be used with SendPagedMessage
+func PagesFromContent(content string) (pages []string) {
+	return autoPagify(cleanDiscordContent(content))
+}
+
+// SendPagedMessage sends a message users can page through using reactions
+// module	: the module handling the reactions using HandlePaginatorReaction
+// pages	: the content of each page
+// userIDs	: the users allowed to change pages, everyone is allowed if empty
+func (event EventContainer) SendPagedMessage(module, channelID string, pages []string, userIDs ...string) (paginator *Paginator, err error) {
+	defer event.discordBreadcrumb("SendPagedMessage", channelID, &err)
+	return SendPagedMessageWithBot(event.BotUserID, module, channelID, pages, userIDs...)
+}
+
+// SendPagedMessageWithBot sends a message users can page through using reactions
+// module	: the module handling the reactions using HandlePaginatorReaction
+// pages	: the content of each page
+// userIDs	: the users allowed to change pages, everyone is allowed if empty
+func SendPagedMessageWithBot(botID, module, channelID string, pages []string, userIDs ...string) (paginator *Paginator, err error) {
+	paginator = &Paginator{
+		BotUserID: botID,
+		Module:    module,
+		ChannelID: channelID,
+		Pages:     pages,
+		UserIDs:   userIDs,
+	}
+	return paginator, paginator.send()
+}
+
+// SendPagedEmbed sends an embed users can page through using reactions
+// module	: the module handling the reactions using HandlePaginatorReaction
+// embeds	: the embed of each page
+// userIDs	: the users allowed to change pages, everyone is allowed if empty
+func (event EventContainer) SendPagedEmbed(module, channelID string, embeds []*discordgo.MessageEmbed, userIDs ...string) (paginator *Paginator, err error) {
+	defer event.discordBreadcrumb("SendPagedEmbed", channelID, &err)
+	return SendPagedEmbedWithBot(event.BotUserID, module, channelID, embeds, userIDs...)
+}
+
+// SendPagedEmbedWithBot sends an embed users can page through using reactions
+// module	: the module handling the reactions using HandlePaginatorReaction
+// embeds	: the embed of each page
+// userIDs	: the users allowed to change pages, everyone is allowed if empty
+func SendPagedEmbedWithBot(botID, module, channelID string, embeds []*discordgo.MessageEmbed, userIDs ...string) (paginator *Paginator, err error) {
+	paginator = &Paginator{
+		BotUserID: botID,
+		Module:    module,
+		ChannelID: channelID,
+		Embeds:    embeds,
+		UserIDs:   userIDs,
+	}
+	return paginator, paginator.send()
+}
+
+// HandlePaginatorReaction changes the page of a Paginator, if the event is a reaction on a Paginator of the module
+// returns true if the reaction has been handled
+func HandlePaginatorReaction(module string, event EventContainer) (handled bool, err error) {
+	if event.Type != MessageReactionAddEventType || event.MessageReactionAdd == nil {
+		return false, nil
+	}
+	reaction := event.MessageReactionAdd.MessageReaction
+	if reaction.UserID == event.BotUserID {
+		return false, nil
+	}
+
+	paginator, err := getPaginator(reaction.MessageID)
+	if err != nil {
+		return false, err
+	}
+	if paginator == nil || paginator.Module != module {
+		return false, nil
+	}
+
+	// remove reaction of the user, requires Manage Messages
+	defer cache.GetEDiscord(paginator.BotUserID).MessageReactionRemove( // nolint: errcheck
+		reaction.ChannelID, reaction.MessageID, reaction.Emoji.APIName(), reaction.UserID,
+	)
+
+	if !paginator.allowed(reaction.UserID) {
+		return true, nil
+	}
+
+	var change int
+	switch reaction.Emoji.Name {
+	case PaginatorEmojiPrevious:
+		change = -1
+	case PaginatorEmojiNext:
+		change = 1
+	case PaginatorEmojiStop:
+		return true, paginator.Stop()
+	default:
+		return true, nil
+	}
+
+	// reactions can be handled by multiple processes at the same time, retry with the current state on conflicts
+	for i := 0; i < paginatorRetries; i++ {
+		err = paginator.SetPage(paginator.Page + change)
+		if err != ErrPaginatorChanged {
+			return true, err
+		}
+
+		paginator, err = getPaginator(reaction.MessageID)
+		if err != nil || paginator == nil {
+			// stopped or expired meanwhile
+			return true, err
+		}
+	}
+	return true, ErrPaginatorChanged
+}
+
+// SetPage changes the page of the Paginator, wraps around at the first and last page
+// returns ErrPaginatorChanged if the Paginator has been changed or stopped since it was read
+func (p *Paginator) SetPage(page int) (err error) {
+	numberOfPages := p.numberOfPages()
+	if numberOfPages <= 0 {
+		return nil
+	}
+
+	page = page % numberOfPages
+	if page < 0 {
+		page += numberOfPages
+	}
+	previousPage := p.Page
+	p.Page = page
+
+	// store first, so concurrent changes do not get lost
+	err = p.store()
+	if err != nil {
+		p.Page = previousPage
+		return err
+	}
+
+	session := cache.GetEDiscord(p.BotUserID)
+	if p.Embeds != nil {
+		_, err = session.ChannelMessageEditEmbed(p.ChannelID, p.MessageID, p.embed())
+	} else {
+		_, err = session.ChannelMessageEdit(p.ChannelID, p.MessageID, p.content())
+	}
+	return err
+}
+
+// Stop removes all controls of the Paginator, the current page stays visible
+func (p *Paginator) Stop() (err error) {
+	err = cache.GetRedisClient().Del(paginatorKey(p.MessageID)).Err()
+	if err != nil {
+		return err
+	}
+
+	// requires Manage Messages
+	cache.GetEDiscord(p.BotUserID).MessageReactionsRemoveAll(p.ChannelID, p.MessageID) // nolint: errcheck
+	return nil
+}
+
+func (p *Paginator) send() (err error) {
+	session := cache.GetEDiscord(p.BotUserID)
+
+	var message *discordgo.Message
+	if p.Embeds != nil {
+		message, err = session.ChannelMessageSendEmbed(p.ChannelID, p.embed())
+	} else {
+		message, err = session.ChannelMessageSend(p.ChannelID, p.content())
+	}
+	if err != nil {
+		return err
+	}
+	p.MessageID = message.ID
+
+	// no controls required for a single page
+	if p.numberOfPages() <= 1 {
+		return nil
+	}
+
+	for _, emoji := range []string{PaginatorEmojiPrevious, PaginatorEmojiNext, PaginatorEmojiStop} {
+		err = session.MessageReactionAdd(p.ChannelID, p.MessageID, emoji)
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.store()
+}
+
+// store stores the state of the Paginator, if it has not been changed or stopped since it was read
+// returns ErrPaginatorChanged otherwise
+func (p *Paginator) store() (err error) {
+	version := p.Version
+	p.Version++
+	p.ExpiresAt = time.Now().Add(paginatorExpiry)
+
+	data, err := jsoniter.Marshal(p)
+	if err != nil {
+		p.Version = version
+		return err
+	}
+
+	stored, err := paginatorStoreScript.Run(
+		cache.GetRedisClient(),
+		[]string{paginatorKey(p.MessageID)},
+		version, data, int64(paginatorExpiry/time.Millisecond),
+	).Int64()
+	if err != nil || stored != 1 {
+		p.Version = version
+		if err == nil {
+			err = ErrPaginatorChanged
+		}
+		return err
+	}
+	return nil
+}
+
+func getPaginator(messageID string) (paginator *Paginator, err error) {
+	data, err := cache.GetRedisClient().Get(paginatorKey(messageID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = jsoniter.Unmarshal(data, &paginator)
+	return paginator, err
+}
+
+func (p *Paginator) allowed(userID string) bool {
+	if len(p.UserIDs) <= 0 {
+		return true
+	}
+
+	for _, allowedUserID := range p.UserIDs {
+		if allowedUserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Paginator) numberOfPages() int {
+	if p.Embeds != nil {
+		return len(p.Embeds)
+	}
+	return len(p.Pages)
+}
+
+func (p *Paginator) pageIndicator() string {
+	return strconv.Itoa(p.Page+1) + "/" + strconv.Itoa(p.numberOfPages())
+}
+
+func (p *Paginator) content() string {
+	if len(p.Pages) <= 0 {
+		return ""
+	}
+
+	content := cleanDiscordContent(p.Pages[p.Page])
+	if len(p.Pages) <= 1 {
+		return content
+	}
+
+	indicator := "\n`" + p.pageIndicator() + "`"
+	if len(content)+len(indicator) > 2000 {
+		// cut on a rune boundary, to not split multi byte characters
+		cut := 2000 - len(indicator) - len("…")
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		content = content[:cut] + "…"
+	}
+	return content + indicator
+}
+
+func (p *Paginator) embed() *discordgo.MessageEmbed {
+	if len(p.Embeds) <= 0 {
+		return nil
+	}
+
+	// copy embed to not modify the stored page
+	embed := *p.Embeds[p.Page]
+	if len(p.Embeds) > 1 {
+		footer := &discordgo.MessageEmbedFooter{Text: p.pageIndicator()}
+		if embed.Footer != nil {
+			footer.IconURL = embed.Footer.IconURL
+			footer.Text = embed.Footer.Text + " • " + footer.Text
+		}
+		embed.Footer = footer
+	}
+	return truncateEmbed(&embed)
+}
@@ -0,0 +1,207 @@
+package dhelpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// startPaginatorDiscordStub redirects the Discord requests of a new bot session to a local stub server
+// returns the bot user id, and a function returning the received requests as "METHOD path"
+func startPaginatorDiscordStub(t *testing.T) (botID string, requests func() []string, stop func()) {
+	botID = "bot" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	var received []string
+	var receivedMutex sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedMutex.Lock()
+		received = append(received, r.Method+" "+r.URL.Path)
+		receivedMutex.Unlock()
+
+		switch r.Method {
+		case http.MethodPost, http.MethodPatch:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"message` + botID + `","channel_id":"channel"}`)) // nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.GetEDiscord(botID).Client = &http.Client{Transport: stubTransport{target: target, next: http.DefaultTransport}}
+
+	return botID, func() []string {
+		receivedMutex.Lock()
+		defer receivedMutex.Unlock()
+		return append([]string{}, received...)
+	}, server.Close
+}
+
+func paginatorReactionEvent(botID, messageID, userID, emoji string) EventContainer {
+	return EventContainer{
+		Type:      MessageReactionAddEventType,
+		BotUserID: botID,
+		MessageReactionAdd: &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{
+			UserID:    userID,
+			MessageID: messageID,
+			ChannelID: "channel",
+			Emoji:     discordgo.Emoji{Name: emoji},
+		}},
+	}
+}
+
+func TestPaginator_content(t *testing.T) {
+	paginator := &Paginator{Pages: []string{strings.Repeat("ä", 1500), "b"}}
+
+	content := paginator.content()
+	if len(content) > 2000 || !utf8.ValidString(content) || !strings.HasSuffix(content, "…\n`1/2`") {
+		t.Error("Expected valid truncated content of at most 2000 bytes, got ", len(content), " bytes")
+	}
+
+	paginator.Page = 1
+	content = paginator.content()
+	if content != "b\n`2/2`" {
+		t.Error("Expected b\\n`2/2`, got ", content)
+	}
+}
+
+func TestHandlePaginatorReaction(t *testing.T) {
+	botID, requests, stop := startPaginatorDiscordStub(t)
+	defer stop()
+
+	paginator, err := SendPagedMessageWithBot(botID, "test", "channel", []string{"a", "b", "c"}, "user")
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	messageID := paginator.MessageID
+	defer cache.GetRedisClient().Del(paginatorKey(messageID))
+
+	for _, step := range []struct {
+		module, userID, emoji string
+		handled               bool
+		page                  int
+	}{
+		{"test", "user", PaginatorEmojiPrevious, true, 2}, // wraps around to the last page
+		{"test", "user", PaginatorEmojiNext, true, 0},     // wraps around to the first page
+		{"test", "user", PaginatorEmojiNext, true, 1},
+		{"test", "other", PaginatorEmojiNext, true, 1}, // reactions of other users are removed and ignored
+		{"other", "user", PaginatorEmojiNext, false, 1},
+		{"test", botID, PaginatorEmojiNext, false, 1},
+	} {
+		handled, err := HandlePaginatorReaction(step.module, paginatorReactionEvent(botID, messageID, step.userID, step.emoji))
+		if err != nil || handled != step.handled {
+			t.Error("Expected handled ", step.handled, " for ", step, ", got ", handled, err)
+		}
+		stored, err := getPaginator(messageID)
+		if err != nil || stored == nil || stored.Page != step.page {
+			t.Error("Expected page ", step.page, " for ", step, ", got ", stored, err)
+		}
+	}
+
+	handled, err := HandlePaginatorReaction("test", paginatorReactionEvent(botID, messageID, "user", PaginatorEmojiStop))
+	if err != nil || !handled {
+		t.Error("Expected stop to be handled, got ", handled, err)
+	}
+	stored, err := getPaginator(messageID)
+	if err != nil || stored != nil {
+		t.Error("Expected state to be removed, got ", stored, err)
+	}
+	var removedAll bool
+	for _, request := range requests() {
+		if strings.HasPrefix(request, http.MethodDelete) && strings.HasSuffix(request, "/messages/"+messageID+"/reactions") {
+			removedAll = true
+		}
+	}
+	if !removedAll {
+		t.Error("Expected all reactions to be removed, got ", requests())
+	}
+
+	// stopped paginators do not react anymore
+	handled, err = HandlePaginatorReaction("test", paginatorReactionEvent(botID, messageID, "user", PaginatorEmojiNext))
+	if err != nil || handled {
+		t.Error("Expected reaction on stopped paginator to not be handled, got ", handled, err)
+	}
+}
+
+func TestHandlePaginatorReaction_Expired(t *testing.T) {
+	botID, _, stop := startPaginatorDiscordStub(t)
+	defer stop()
+
+	paginator, err := SendPagedMessageWithBot(botID, "test", "channel", []string{"a", "b"})
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	err = cache.GetRedisClient().PExpire(paginatorKey(paginator.MessageID), time.Millisecond).Err()
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	handled, err := HandlePaginatorReaction("test", paginatorReactionEvent(botID, paginator.MessageID, "user", PaginatorEmojiNext))
+	if err != nil || handled {
+		t.Error("Expected reaction on expired paginator to not be handled, got ", handled, err)
+	}
+}
+
+func TestPaginator_SetPageConcurrent(t *testing.T) {
+	botID, _, stop := startPaginatorDiscordStub(t)
+	defer stop()
+
+	paginator, err := SendPagedMessageWithBot(botID, "test", "channel", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	defer cache.GetRedisClient().Del(paginatorKey(paginator.MessageID))
+
+	// two processes read the same state
+	first, err := getPaginator(paginator.MessageID)
+	if err != nil || first == nil {
+		t.Fatal("Expected stored paginator, got ", first, err)
+	}
+	second, err := getPaginator(paginator.MessageID)
+	if err != nil || second == nil {
+		t.Fatal("Expected stored paginator, got ", second, err)
+	}
+
+	err = first.SetPage(1)
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	err = second.SetPage(2)
+	if err != ErrPaginatorChanged {
+		t.Error("Expected ErrPaginatorChanged, got ", err)
+	}
+	stored, err := getPaginator(paginator.MessageID)
+	if err != nil || stored == nil || stored.Page != 1 {
+		t.Error("Expected page 1, got ", stored, err)
+	}
+
+	// stopped paginators are not recreated by a concurrent change
+	err = stored.Stop()
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	err = first.SetPage(2)
+	if err != ErrPaginatorChanged {
+		t.Error("Expected ErrPaginatorChanged, got ", err)
+	}
+	stored, err = getPaginator(paginator.MessageID)
+	if err != nil || stored != nil {
+		t.Error("Expected paginator to stay stopped, got ", stored, err)
+	}
+}
@@ -0,0 +1,303 @@
+package dhelpers
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/getsentry/sentry-go"
+	"github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/Cacophony/dhelpers/bucket"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"gitlab.com/Cacophony/dhelpers/emoji"
+)
+
+// ErrorContext contains information about where an error occurred
+type ErrorContext struct {
+	Service     string
+	Event       *EventContainer // set for errors while handling an event
+	Job         string          // set for errors in jobs
+	Request     *http.Request   // set for errors in HTTP handlers
+	GuildID     string
+	ChannelID   string
+	UserID      string
+	MessageID   string
+	ReferenceID string // a short ID shown to users, to find the report of the error
+	Expected    bool   // true if the error is caused by the user or missing permissions, expected errors are not reported to developers
+}
+
+// ErrorReporter reports errors to a sink
+type ErrorReporter interface {
+	Report(err error, errorContext ErrorContext)
+}
+
+// ErrorReporterFunc is a function implementing ErrorReporter
+type ErrorReporterFunc func(err error, errorContext ErrorContext)
+
+// Report calls the function
+func (f ErrorReporterFunc) Report(err error, errorContext ErrorContext) {
+	f(err, errorContext)
+}
+
+var (
+	errorReporters      = make(map[ErrorHandlerType]ErrorReporter)
+	errorReportersMutex sync.RWMutex
+)
+
+func init() {
+	RegisterErrorReporter(SentryErrorHandler, ErrorReporterFunc(reportToSentry))
+	RegisterErrorReporter(DiscordErrorHandler, ErrorReporterFunc(reportToDiscord))
+	RegisterErrorReporter(LogErrorHandler, ErrorReporterFunc(reportToLog))
+	RegisterErrorReporter(GuildErrorHandler, ErrorReporterFunc(reportToGuildErrorChannel))
+}
+
+// RegisterErrorReporter registers an ErrorReporter under a name, replaces previous reporters with the same name
+// the name can be used in the ErrorHandlers of routing rules
+// example: RegisterErrorReporter(WebhookErrorHandler, NewWebhookErrorReporter("https://example.org/errors"))
+func RegisterErrorReporter(name ErrorHandlerType, reporter ErrorReporter) {
+	errorReportersMutex.Lock()
+	errorReporters[name] = reporter
+	errorReportersMutex.Unlock()
+}
+
+// GetErrorReporter returns the ErrorReporter registered under name
+func GetErrorReporter(name ErrorHandlerType) (reporter ErrorReporter, ok bool) {
+	errorReportersMutex.RLock()
+	defer errorReportersMutex.RUnlock()
+
+	reporter, ok = errorReporters[name]
+	return reporter, ok
+}
+
+// ReportError reports an error to all given error handlers, unknown error handlers are skipped
+func ReportError(err error, errorContext ErrorContext, errorHandlers ...ErrorHandlerType) {
+	if err == nil {
+		return
+	}
+
+	for _, errorHandler := range errorHandlers {
+		reporter, ok := GetErrorReporter(errorHandler)
+		if !ok {
+			continue
+		}
+
+		reporter.Report(err, errorContext)
+	}
+}
+
+// tags returns the context as tags, empty values are skipped
+func (c ErrorContext) tags() (tags map[string]string) {
+	tags = make(map[string]string)
+	for key, value := range map[string]string{
+		"service":   c.Service,
+		"job":       c.Job,
+		"GuildID":   c.GuildID,
+		"ChannelID": c.ChannelID,
+		"AuthorID":  c.UserID,
+		"MessageID": c.MessageID,
+		"reference": c.ReferenceID,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	if c.Event != nil {
+		tags["EventType"] = string(c.Event.Type)
+	}
+	return tags
+}
+
+// defines ratelimiters for the ErrorReporters
+var (
+	sentryLimiter  = bucket.NewBucket(5)
+	discordLimiter = bucket.NewKeyBucket(3)
+)
+
+// reportToSentry sends unexpected errors to sentry
+// uses the hub of the event if set, to include the breadcrumbs of the event
+func reportToSentry(err error, errorContext ErrorContext) {
+	if errorContext.Expected {
+		return
+	}
+
+	if sentry.CurrentHub().Client() == nil {
+		return
+	}
+
+	if !sentryLimiter.Allow() {
+		return
+	}
+
+	hub := sentry.CurrentHub()
+	if errorContext.Event != nil {
+		hub = errorContext.Event.SentryHub()
+	}
+
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTags(errorContext.tags())
+		if errorContext.UserID != "" {
+			scope.SetUser(sentry.User{ID: errorContext.UserID})
+		}
+		if errorContext.Request != nil {
+			scope.SetRequest(errorContext.Request)
+		}
+
+		hub.CaptureException(err)
+	})
+}
+
+// reportToDiscord tells the user about the error in the channel of the message
+// falls back to a reaction if the bot is not allowed to send messages
+func reportToDiscord(err error, errorContext ErrorContext) {
+	event := errorContext.Event
+	if event == nil || errorContext.ChannelID == "" || cache.GetEDiscord(event.BotUserID) == nil {
+		return
+	}
+
+	if !discordLimiter.Allow(errorContext.ChannelID) {
+		return
+	}
+
+	// send message to discord, or add reaction if no message permission
+	channelPermissions, chErr := cache.GetEDiscord(event.BotUserID).UserChannelPermissions(event.BotUserID, errorContext.ChannelID)
+	if chErr != nil {
+		return
+	}
+
+	if channelPermissions&discordgo.PermissionSendMessages == discordgo.PermissionSendMessages {
+		// send message if possible
+
+		referenceID := errorContext.ReferenceID
+		if errorContext.Expected {
+			referenceID = ""
+		}
+
+		event.SendMessage( // nolint: errcheck
+			errorContext.ChannelID,
+			event.UserErrorMessage(err, referenceID),
+		)
+	} else if channelPermissions&discordgo.PermissionAddReactions == discordgo.PermissionAddReactions &&
+		errorContext.MessageID != "" {
+		// try falling back to reaction if not possible
+
+		reactions := []string{
+			emoji.GetWithout("stop"),
+			emoji.GetWithout("weary"),
+			emoji.GetWithout("speaknoevil"),
+			emoji.GetWithout("notlikethis"),
+			emoji.GetWithout("cry"),
+			emoji.GetWithout("frown"),
+			emoji.GetWithout("unamused"),
+		}
+		rand.Seed(time.Now().Unix())
+		cache.GetEDiscord(event.BotUserID).MessageReactionAdd(errorContext.ChannelID, errorContext.MessageID, reactions[rand.Intn(len(reactions))]) // nolint: errcheck
+	}
+}
+
+// reportToLog logs unexpected errors with a stacktrace
+func reportToLog(err error, errorContext ErrorContext) {
+	if errorContext.Expected || !cache.HasLogger() {
+		return
+	}
+
+	fields := make(logrus.Fields)
+	for key, value := range errorContext.tags() {
+		fields[key] = value
+	}
+	if errorContext.Request != nil {
+		fields["method"] = errorContext.Request.Method
+		fields["url"] = errorContext.Request.URL.String()
+	}
+
+	// log stacktrace
+	buf := make([]byte, 1<<16)
+	stackSize := runtime.Stack(buf, false)
+
+	cache.GetLogger().WithFields(fields).Errorln(err.Error() + "\n\n" + string(buf[0:stackSize]))
+}
+
+// webhookErrorReport is the body sent by the WebhookErrorReporter
+type webhookErrorReport struct {
+	Error     string
+	Service   string
+	EventType EventType `json:",omitempty"`
+	Job       string    `json:",omitempty"`
+	Method    string    `json:",omitempty"`
+	URL       string    `json:",omitempty"`
+	GuildID   string    `json:",omitempty"`
+	ChannelID string    `json:",omitempty"`
+	UserID    string    `json:",omitempty"`
+	MessageID string    `json:",omitempty"`
+	Time      time.Time
+}
+
+// webhookReportBuffer is the number of reports a WebhookErrorReporter queues, further reports are dropped
+const webhookReportBuffer = 100
+
+// NewWebhookErrorReporter returns an ErrorReporter posting unexpected errors as JSON to url
+// reports are sent by a separate goroutine, so a slow webhook does not block the reporting goroutine
+// allows five errors per second, reports are dropped if the webhook can not keep up
+func NewWebhookErrorReporter(url string) ErrorReporter {
+	limiter := bucket.NewBucket(5)
+	client := &http.Client{Timeout: 10 * time.Second}
+	queue := make(chan []byte, webhookReportBuffer)
+
+	go func() {
+		for body := range queue {
+			resp, postErr := client.Post(url, "application/json", bytes.NewReader(body))
+			if postErr != nil {
+				if cache.HasLogger() {
+					cache.GetLogger().WithField("module", "reporter").Errorln("error sending error to webhook", postErr.Error())
+				}
+				continue
+			}
+			resp.Body.Close() // nolint: errcheck, gosec
+		}
+	}()
+
+	return ErrorReporterFunc(func(err error, errorContext ErrorContext) {
+		if errorContext.Expected {
+			return
+		}
+
+		if !limiter.Allow() {
+			return
+		}
+
+		report := webhookErrorReport{
+			Error:     err.Error(),
+			Service:   errorContext.Service,
+			Job:       errorContext.Job,
+			GuildID:   errorContext.GuildID,
+			ChannelID: errorContext.ChannelID,
+			UserID:    errorContext.UserID,
+			MessageID: errorContext.MessageID,
+			Time:      time.Now(),
+		}
+		if errorContext.Event != nil {
+			report.EventType = errorContext.Event.Type
+		}
+		if errorContext.Request != nil {
+			report.Method = errorContext.Request.Method
+			report.URL = errorContext.Request.URL.String()
+		}
+
+		body, marshalErr := jsoniter.Marshal(report)
+		if marshalErr != nil {
+			return
+		}
+
+		select {
+		case queue <- body:
+		default:
+			if cache.HasLogger() {
+				cache.GetLogger().WithField("module", "reporter").Warnln("webhook queue is full, dropping error:", err.Error())
+			}
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package dhelpers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"gitlab.com/Cacophony/dhelpers/state"
+)
+
+func TestReportError(t *testing.T) {
+	var reportedErr error
+	var reportedContext ErrorContext
+	RegisterErrorReporter("test", ErrorReporterFunc(func(err error, errorContext ErrorContext) {
+		reportedErr = err
+		reportedContext = errorContext
+	}))
+
+	event := &EventContainer{
+		Type: MessageCreateEventType,
+		MessageCreate: &discordgo.MessageCreate{Message: &discordgo.Message{
+			ID:        "message",
+			ChannelID: "channel",
+			GuildID:   "guild",
+			Author:    &discordgo.User{ID: "user"},
+		}},
+	}
+	testErr := errors.New("test error")
+	HandleErrWith("Test", testErr, event, "test", "unknown")
+	if reportedErr != testErr {
+		t.Error("Expected test error, got ", reportedErr)
+	}
+	if reportedContext.Service != "Test" || reportedContext.Event != event ||
+		reportedContext.GuildID != "guild" || reportedContext.ChannelID != "channel" ||
+		reportedContext.UserID != "user" || reportedContext.MessageID != "message" {
+		t.Errorf("Expected context for event, got %+v", reportedContext)
+	}
+	if reportedContext.Expected {
+		t.Error("Expected error to be unexpected")
+	}
+
+	HandleErrWith("Test", state.ErrStateNotFound, nil, "test")
+	if !reportedContext.Expected {
+		t.Error("Expected state error to be expected")
+	}
+
+	HandleJobErrorWith("Worker", "job", testErr, "test")
+	if reportedContext.Job != "job" || reportedContext.Service != "Worker" {
+		t.Errorf("Expected context for job, got %+v", reportedContext)
+	}
+}
+
+func TestWebhookErrorReporter(t *testing.T) {
+	reports := make(chan webhookErrorReport, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report webhookErrorReport
+		err = jsoniter.Unmarshal(body, &report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports <- report
+	}))
+	defer server.Close()
+
+	reporter := NewWebhookErrorReporter(server.URL)
+	reporter.Report(errors.New("test error"), ErrorContext{Service: "Test", Job: "job"})
+
+	report := <-reports
+	if report.Error != "test error" || report.Service != "Test" || report.Job != "job" {
+		t.Errorf("Expected report for test error, got %+v", report)
+	}
+
+	// expected errors should not be sent
+	reporter.Report(errors.New("test error"), ErrorContext{Expected: true})
+	select {
+	case report = <-reports:
+		t.Errorf("Expected no report for expected error, got %+v", report)
+	default:
+	}
+}
+
+func TestWebhookErrorReporter_SlowWebhook(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	// reporting does not wait for the webhook, reports exceeding the queue are dropped
+	reporter := NewWebhookErrorReporter(server.URL)
+	started := time.Now()
+	for i := 0; i < webhookReportBuffer+10; i++ {
+		reporter.Report(errors.New("test error"), ErrorContext{Service: "Test"})
+	}
+	if time.Since(started) > time.Second {
+		t.Error("Expected reporting to not block, took ", time.Since(started))
+	}
+}
+
+func TestCheckErr(t *testing.T) {
+	testErr := errors.New("test error")
+
+	defer func() {
+		recovered, ok := recover().(error)
+		if !ok || errors.Cause(recovered) != testErr {
+			t.Error("Expected panic with the wrapped error, got ", recovered)
+		}
+		if !strings.Contains(fmt.Sprintf("%+v", recovered), "TestCheckErr") {
+			t.Error("Expected stacktrace of the caller, got ", fmt.Sprintf("%+v", recovered))
+		}
+	}()
+
+	CheckErr(nil)
+	CheckErr(testErr)
+	t.Error("Expected CheckErr to panic")
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/bwmarrin/discordgo"
+	"gitlab.com/Cacophony/dhelpers/cache"
 )
 
 // Routing JSON Config
@@ -118,12 +119,13 @@ func GetRoutings() (routingRules []RoutingRule, err error) {
 					CaseSensitive:      false,
 				}
 				for _, errorHandler := range rawRule.ErrorHandlers {
-					switch errorHandler {
-					case string(SentryErrorHandler):
-						newEntry.ErrorHandlers = append(newEntry.ErrorHandlers, SentryErrorHandler)
-					case string(DiscordErrorHandler):
-						newEntry.ErrorHandlers = append(newEntry.ErrorHandlers, DiscordErrorHandler)
+					if _, ok := GetErrorReporter(ErrorHandlerType(errorHandler)); !ok {
+						if cache.HasLogger() {
+							cache.GetLogger().WithField("module", "router").Warnln("skipping unknown error handler", errorHandler)
+						}
+						continue
 					}
+					newEntry.ErrorHandlers = append(newEntry.ErrorHandlers, ErrorHandlerType(errorHandler))
 				}
 
 				if (ruleType == MessageCreateEventType ||
@@ -0,0 +1,368 @@
+package dhelpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bsm/redis-lock"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+// defines the errors returned by the Scheduler
+var (
+	ErrCronNotInitialized = errors.New("cron handler is not initialized, see components.InitCron")
+	ErrJobNameMissing     = errors.New("job name is missing")
+	ErrJobNameDuplicate   = errors.New("job name is used by multiple jobs")
+	ErrJobFunctionMissing = errors.New("job function is missing, set Job or Run")
+	ErrJobNotFound        = errors.New("job not found")
+	ErrJobLockLost        = errors.New("job lost its lock while running")
+)
+
+// defaultJobLockTimeout is the lock timeout used if a Job does not define one
+const defaultJobLockTimeout = 1 * time.Minute
+
+// JobOutcome is the result of a Job run
+type JobOutcome string
+
+// defines the possible outcomes of a Job run
+const (
+	JobOutcomeSuccess JobOutcome = "success"
+	JobOutcomeFailure JobOutcome = "failure"
+)
+
+// JobStatus contains information about a Job of a Scheduler
+type JobStatus struct {
+	Name         string
+	Cron         string
+	Running      bool
+	Paused       bool
+	Next         time.Time
+	LastRun      time.Time // the start of the last run on this instance
+	LastDuration time.Duration
+	LastOutcome  JobOutcome
+	LastError    string
+}
+
+// Scheduler runs Jobs using cron, a Job only runs on one instance at the same time
+// locks are renewed while a Job runs, runs are recovered from panics and reported to healthchecks.io
+// Jobs can be triggered, paused and resumed on all instances, see TriggerJob, PauseJob, and ResumeJob
+type Scheduler struct {
+	// Service is used when reporting errors, default Worker
+	Service string
+	// Instance identifies this instance in the job history, default hostname:pid
+	Instance string
+	// ErrorHandlers are used when reporting errors of Jobs, see HandleJobErrorWith
+	ErrorHandlers []ErrorHandlerType
+
+	jobs   []*scheduledJob
+	pubsub *redis.PubSub
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	stopped bool
+	sync.Mutex
+}
+
+// scheduledJob is a Job including its state
+type scheduledJob struct {
+	Job
+	schedule cron.Schedule
+
+	status JobStatus
+	sync.RWMutex
+}
+
+// NewScheduler creates a Scheduler for the jobs, use Start to register them
+// returns an error if a Job is invalid
+func NewScheduler(jobs []Job) (scheduler *Scheduler, err error) {
+	scheduler = &Scheduler{
+		Service:  "Worker",
+		Instance: jobInstanceName(),
+	}
+	scheduler.ctx, scheduler.cancel = context.WithCancel(context.Background())
+
+	names := make(map[string]bool)
+	for _, job := range jobs {
+		if job.Name == "" {
+			return nil, ErrJobNameMissing
+		}
+		if names[job.Name] {
+			return nil, errors.Wrap(ErrJobNameDuplicate, job.Name)
+		}
+		names[job.Name] = true
+
+		if job.Job == nil && job.Run == nil {
+			return nil, errors.Wrap(ErrJobFunctionMissing, job.Name)
+		}
+
+		var schedule cron.Schedule
+		if job.Cron != "" {
+			schedule, err = cron.Parse(job.Cron)
+			if err != nil {
+				return nil, errors.Wrap(err, job.Name)
+			}
+		}
+
+		scheduler.jobs = append(scheduler.jobs, &scheduledJob{
+			Job:      job,
+			schedule: schedule,
+			status: JobStatus{
+				Name: job.Name,
+				Cron: job.Cron,
+			},
+		})
+	}
+
+	return scheduler, nil
+}
+
+// Start registers all Jobs at the cached cron handler, and starts Jobs which should run at launch
+// subscribes to the job control channel to receive triggers from other instances
+func (s *Scheduler) Start() (err error) {
+	cronHandler := cache.GetCron()
+	if cronHandler == nil {
+		return ErrCronNotInitialized
+	}
+
+	s.pubsub = cache.GetRedisClient().Subscribe(jobControlChannel)
+	// wait for the subscription to be confirmed
+	_, err = s.pubsub.Receive()
+	if err != nil {
+		s.pubsub.Close() // nolint: errcheck
+		return err
+	}
+	go s.listenJobControl(s.pubsub)
+
+	for _, job := range s.jobs {
+		job := job
+
+		if job.schedule != nil {
+			cronHandler.Schedule(job.schedule, cron.FuncJob(func() {
+				s.runScheduled(job)
+			}))
+		}
+
+		if job.AtLaunch {
+			go s.runScheduled(job)
+		}
+	}
+
+	return nil
+}
+
+// Stop cancels the context of all running Jobs, and waits for them to finish
+// Jobs will not be started again after Stop
+func (s *Scheduler) Stop() {
+	s.Lock()
+	s.stopped = true
+	s.Unlock()
+
+	if s.pubsub != nil {
+		s.pubsub.Close() // nolint: errcheck
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Trigger runs a Job now, in the background, even if it is paused
+// use TriggerJob to run a Job on any instance
+func (s *Scheduler) Trigger(name string) (err error) {
+	job := s.job(name)
+	if job == nil {
+		return ErrJobNotFound
+	}
+
+	go s.run(job)
+	return nil
+}
+
+// Status returns the status of all Jobs
+func (s *Scheduler) Status() (statuses []JobStatus) {
+	paused := make(map[string]bool)
+	pausedJobs, err := GetPausedJobs()
+	if err != nil && cache.HasLogger() {
+		cache.GetLogger().WithField("module", "scheduler").Warnln("error reading paused jobs:", err.Error())
+	}
+	for _, jobName := range pausedJobs {
+		paused[jobName] = true
+	}
+
+	now := time.Now()
+	for _, job := range s.jobs {
+		job.RLock()
+		status := job.status
+		job.RUnlock()
+
+		status.Paused = paused[job.Name]
+		if job.schedule != nil {
+			status.Next = job.schedule.Next(now)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (s *Scheduler) job(name string) *scheduledJob {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+// runScheduled runs the Job, unless it is paused
+func (s *Scheduler) runScheduled(job *scheduledJob) {
+	paused, err := IsJobPaused(job.Name)
+	if err != nil {
+		HandleJobErrorWith(s.Service, job.Name, err, s.ErrorHandlers...)
+		return
+	}
+	if paused {
+		return
+	}
+
+	s.run(job)
+}
+
+// run runs the Job, if it is not running on any instance yet
+func (s *Scheduler) run(job *scheduledJob) {
+	s.Lock()
+	if s.stopped {
+		s.Unlock()
+		return
+	}
+	s.wg.Add(1)
+	s.Unlock()
+	defer s.wg.Done()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	lockLost := make(chan struct{})
+
+	// legacy Job functions take the Job lock themselves using JobStart, locking here would make them skip every run
+	if job.Run != nil {
+		lockTimeout := job.LockTimeout
+		if lockTimeout <= 0 {
+			lockTimeout = defaultJobLockTimeout
+		}
+
+		start, locker, err := JobStart(job.Name, lockTimeout)
+		if err != nil {
+			HandleJobErrorWith(s.Service, job.Name, err, s.ErrorHandlers...)
+			return
+		}
+		if !start {
+			// running on another instance
+			return
+		}
+		defer locker.Unlock() // nolint: errcheck
+
+		go renewJobLock(ctx, cancel, locker, lockTimeout, lockLost)
+	}
+
+	started := time.Now()
+	job.Lock()
+	job.status.Running = true
+	job.Unlock()
+
+	err := job.execute(ctx)
+	select {
+	case <-lockLost:
+		if err == nil || errors.Cause(err) == context.Canceled {
+			err = ErrJobLockLost
+		}
+	default:
+	}
+
+	run := JobRun{
+		Job:      job.Name,
+		Start:    started,
+		End:      time.Now(),
+		Status:   JobOutcomeSuccess,
+		Instance: s.Instance,
+	}
+	if err != nil {
+		run.Status = JobOutcomeFailure
+		run.Error = err.Error()
+	}
+
+	job.Lock()
+	job.status.Running = false
+	job.status.LastRun = run.Start
+	job.status.LastDuration = run.End.Sub(run.Start)
+	job.status.LastOutcome = run.Status
+	job.status.LastError = run.Error
+	job.Unlock()
+
+	if err != nil {
+		HandleJobErrorWith(s.Service, job.Name, err, s.ErrorHandlers...)
+	}
+
+	// legacy Job functions are called on every instance, and can not tell if they skipped because of their own lock
+	// they have to report to the history and healthcheck themselves
+	if job.Run == nil {
+		return
+	}
+
+	historyErr := addJobRun(run)
+	if historyErr != nil && cache.HasLogger() {
+		cache.GetLogger().WithField("module", "scheduler").Warnln("error storing history for", job.Name+":", historyErr.Error())
+	}
+
+	if err != nil {
+		err = JobFinishFailure(job.HealthcheckURL)
+	} else {
+		err = JobFinishSuccess(job.HealthcheckURL)
+	}
+	if err != nil && cache.HasLogger() {
+		cache.GetLogger().WithField("module", "scheduler").Warnln("error pinging healthcheck for", job.Name+":", err.Error())
+	}
+}
+
+// execute runs the function of the Job, panics are returned as errors
+func (job *scheduledJob) execute(ctx context.Context) (err error) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		if recoveredErr, ok := recovered.(error); ok {
+			err = errors.WithStack(recoveredErr)
+			return
+		}
+		err = errors.Errorf("panic: %v", recovered)
+	}()
+
+	if job.Run != nil {
+		return job.Run(ctx)
+	}
+	job.Job.Job()
+	return nil
+}
+
+// renewJobLock renews the lock of a running Job until the context is done
+// cancels the context and closes lockLost if the lock could not be renewed
+func renewJobLock(ctx context.Context, cancel context.CancelFunc, locker *lock.Locker, lockTimeout time.Duration, lockLost chan struct{}) {
+	ticker := time.NewTicker(lockTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			renewed, err := locker.Lock()
+			if err != nil || !renewed {
+				close(lockLost)
+				cancel()
+				return
+			}
+		}
+	}
+}
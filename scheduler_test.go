@@ -0,0 +1,224 @@
+package dhelpers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+func TestNewScheduler(t *testing.T) {
+	job := func() {}
+
+	_, err := NewScheduler([]Job{{Name: "test:a", Job: job}, {Name: "test:a", Job: job}})
+	if errors.Cause(err) != ErrJobNameDuplicate {
+		t.Error("Expected ErrJobNameDuplicate, got ", err)
+	}
+
+	_, err = NewScheduler([]Job{{Name: "test:a"}})
+	if errors.Cause(err) != ErrJobFunctionMissing {
+		t.Error("Expected ErrJobFunctionMissing, got ", err)
+	}
+
+	_, err = NewScheduler([]Job{{Name: "test:a", Cron: "invalid", Job: job}})
+	if err == nil {
+		t.Error("Expected error for invalid cron expression, got nil")
+	}
+
+	scheduler, err := NewScheduler([]Job{{Name: "test:a", Cron: "@every 1h", Job: job}})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	status := scheduler.Status()
+	if len(status) != 1 || status[0].Next.Before(time.Now().Add(59*time.Minute)) {
+		t.Error("Expected next run in one hour, got ", status)
+	}
+}
+
+func TestScheduler_run(t *testing.T) {
+	var pings []string
+	var pingsMutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pingsMutex.Lock()
+		pings = append(pings, r.URL.Path)
+		pingsMutex.Unlock()
+	}))
+	defer server.Close()
+
+	prefix := "test:scheduler:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"
+	scheduler, err := NewScheduler([]Job{
+		{
+			Name:           prefix + "success",
+			HealthcheckURL: server.URL + "/success",
+			Run: func(ctx context.Context) error {
+				return nil
+			},
+		},
+		{
+			Name:           prefix + "panic",
+			HealthcheckURL: server.URL + "/panic",
+			Run: func(ctx context.Context) error {
+				panic(errors.New("job panic"))
+			},
+		},
+		{
+			Name:        prefix + "lock-lost",
+			LockTimeout: 200 * time.Millisecond,
+			Run: func(ctx context.Context) error {
+				// another instance takes over the lock
+				cache.GetRedisClient().Set(jobLockKey(prefix+"lock-lost"), "other", time.Minute)
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+	})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	scheduler.ErrorHandlers = []ErrorHandlerType{LogErrorHandler}
+
+	for _, job := range scheduler.jobs {
+		scheduler.run(job)
+	}
+
+	status := scheduler.Status()
+	if status[0].LastOutcome != JobOutcomeSuccess || status[0].LastRun.IsZero() {
+		t.Error("Expected successful run, got ", status[0])
+	}
+	if status[1].LastOutcome != JobOutcomeFailure || status[1].LastError != "job panic" {
+		t.Error("Expected failed run recovered from panic, got ", status[1])
+	}
+	if status[2].LastOutcome != JobOutcomeFailure || status[2].LastError != ErrJobLockLost.Error() {
+		t.Error("Expected failed run because of lost lock, got ", status[2])
+	}
+
+	history, err := GetJobHistory(prefix+"success", 10)
+	if err != nil || len(history) != 1 || history[0].Status != JobOutcomeSuccess || history[0].Instance != scheduler.Instance {
+		t.Error("Expected one successful run in the history, got ", history, err)
+	}
+
+	pingsMutex.Lock()
+	if len(pings) != 2 || pings[0] != "/success" || pings[1] != "/panic/fail" {
+		t.Error("Expected healthcheck pings for /success and /panic/fail, got ", pings)
+	}
+	pingsMutex.Unlock()
+}
+
+func TestScheduler_runLocked(t *testing.T) {
+	name := "test:scheduler:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":locked"
+
+	var runs int
+	scheduler, err := NewScheduler([]Job{{Name: name, Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}}})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+
+	// job is running on another instance
+	start, locker, err := JobStart(name, time.Minute)
+	if err != nil || !start {
+		t.Error("Expected job to be started, got ", start, err)
+		return
+	}
+	defer locker.Unlock() // nolint: errcheck
+
+	scheduler.run(scheduler.jobs[0])
+
+	if runs != 0 {
+		t.Error("Expected job to be skipped, got runs: ", runs)
+	}
+	if !scheduler.Status()[0].LastRun.IsZero() {
+		t.Error("Expected no run to be recorded, got ", scheduler.Status()[0].LastRun)
+	}
+}
+
+func TestScheduler_runLegacyJob(t *testing.T) {
+	var pings int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&pings, 1)
+	}))
+	defer server.Close()
+
+	name := "test:scheduler:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":legacy"
+
+	// legacy Job functions take the Job lock themselves
+	var runs int
+	scheduler, err := NewScheduler([]Job{{Name: name, HealthcheckURL: server.URL, Job: func() {
+		start, locker, err := JobStart(name, time.Minute)
+		if err != nil || !start {
+			return
+		}
+		defer locker.Unlock() // nolint: errcheck
+		runs++
+	}}})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+
+	scheduler.run(scheduler.jobs[0])
+	if runs != 1 {
+		t.Error("Expected legacy job to run, got runs: ", runs)
+	}
+	if scheduler.Status()[0].LastOutcome != JobOutcomeSuccess {
+		t.Error("Expected successful run, got ", scheduler.Status()[0])
+	}
+
+	// the scheduler can not tell if the function skipped, runs are not recorded
+	history, err := GetJobHistory(name, 10)
+	if err != nil || len(history) != 0 {
+		t.Error("Expected no runs in the history, got ", history, err)
+	}
+	if atomic.LoadInt64(&pings) != 0 {
+		t.Error("Expected no healthcheck pings, got ", atomic.LoadInt64(&pings))
+	}
+}
+
+func TestScheduler_runScheduledPaused(t *testing.T) {
+	name := "test:scheduler:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":paused"
+
+	var runs int
+	scheduler, err := NewScheduler([]Job{{Name: name, Job: func() { runs++ }}})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+
+	err = PauseJob(name)
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	defer ResumeJob(name) // nolint: errcheck
+
+	scheduler.runScheduled(scheduler.jobs[0])
+	if runs != 0 {
+		t.Error("Expected paused job to be skipped, got runs: ", runs)
+	}
+	if !scheduler.Status()[0].Paused {
+		t.Error("Expected job status to be paused")
+	}
+
+	err = ResumeJob(name)
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+
+	scheduler.runScheduled(scheduler.jobs[0])
+	if runs != 1 {
+		t.Error("Expected resumed job to run, got runs: ", runs)
+	}
+}
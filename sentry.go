@@ -0,0 +1,117 @@
+package dhelpers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+const (
+	// sentryHubExpiry is the duration after which hubs of events are removed, if they have not been released
+	sentryHubExpiry = 10 * time.Minute
+	// sentryHubPruneInterval is the interval in which expired hubs are removed
+	sentryHubPruneInterval = 1 * time.Minute
+)
+
+type eventSentryHub struct {
+	hub       *sentry.Hub
+	createdAt time.Time
+}
+
+var (
+	eventSentryHubs      = make(map[string]eventSentryHub)
+	eventSentryHubsMutex sync.Mutex
+	eventSentryHubsPrune sync.Once
+)
+
+// SentryHub returns the sentry hub for the event, the scope contains the guild, channel, and user of the event
+// all breadcrumbs recorded while handling the event are added to the hub
+// call ReleaseSentryHub after the event has been handled
+// returns the current hub if sentry is not initialised
+func (event EventContainer) SentryHub() *sentry.Hub {
+	if sentry.CurrentHub().Client() == nil {
+		return sentry.CurrentHub()
+	}
+
+	eventSentryHubsMutex.Lock()
+	defer eventSentryHubsMutex.Unlock()
+
+	if entry, ok := eventSentryHubs[event.Key]; ok && event.Key != "" {
+		return entry.hub
+	}
+
+	hub := sentry.CurrentHub().Clone()
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetTag("EventType", string(event.Type))
+		scope.SetTag("EventKey", event.Key)
+		scope.SetTag("BotUserID", event.BotUserID)
+		if guildID := event.GuildID(); guildID != "" {
+			scope.SetTag("GuildID", guildID)
+		}
+		if channelID := event.ChannelID(); channelID != "" {
+			scope.SetTag("ChannelID", channelID)
+		}
+		if userID := event.UserID(); userID != "" {
+			scope.SetTag("AuthorID", userID)
+			scope.SetUser(sentry.User{ID: userID})
+		}
+	})
+
+	if event.Key != "" {
+		eventSentryHubs[event.Key] = eventSentryHub{hub: hub, createdAt: time.Now()}
+		eventSentryHubsPrune.Do(func() {
+			go pruneSentryHubs(sentryHubPruneInterval)
+		})
+	}
+	return hub
+}
+
+// ReleaseSentryHub removes the sentry hub of the event, defer after receiving an event
+// example: defer event.ReleaseSentryHub()
+func (event EventContainer) ReleaseSentryHub() {
+	eventSentryHubsMutex.Lock()
+	delete(eventSentryHubs, event.Key)
+	eventSentryHubsMutex.Unlock()
+}
+
+// pruneSentryHubs removes the hubs of events which have not been released within sentryHubExpiry
+func pruneSentryHubs(interval time.Duration) {
+	for range time.Tick(interval) {
+		removeExpiredSentryHubs()
+	}
+}
+
+func removeExpiredSentryHubs() {
+	eventSentryHubsMutex.Lock()
+	defer eventSentryHubsMutex.Unlock()
+
+	for key, entry := range eventSentryHubs {
+		if time.Since(entry.createdAt) > sentryHubExpiry {
+			delete(eventSentryHubs, key)
+		}
+	}
+}
+
+// discordBreadcrumb records a Discord API call made while handling the event
+// defer to record the result: defer event.discordBreadcrumb("SendMessage", channelID, &err)
+func (event EventContainer) discordBreadcrumb(action, channelID string, err *error) {
+	if sentry.CurrentHub().Client() == nil {
+		return
+	}
+
+	breadcrumb := &sentry.Breadcrumb{
+		Type:      "http",
+		Category:  "discord",
+		Message:   action,
+		Level:     sentry.LevelInfo,
+		Timestamp: time.Now(),
+		Data:      map[string]interface{}{"ChannelID": channelID},
+	}
+	if err != nil && *err != nil {
+		breadcrumb.Level = sentry.LevelError
+		breadcrumb.Data["error"] = (*err).Error()
+	}
+
+	event.SentryHub().AddBreadcrumb(breadcrumb, nil)
+}
@@ -0,0 +1,109 @@
+package dhelpers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+)
+
+func TestSentryErrorReporter(t *testing.T) {
+	requests := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests <- body
+	}))
+	defer server.Close()
+
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:       "http://public@" + strings.TrimPrefix(server.URL, "http://") + "/1",
+		Transport: sentry.NewHTTPSyncTransport(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sentry.CurrentHub().BindClient(nil)
+
+	event := EventContainer{
+		Type: MessageCreateEventType,
+		Key:  "test-sentry-event",
+		MessageCreate: &discordgo.MessageCreate{Message: &discordgo.Message{
+			ID:        "test-message",
+			ChannelID: "test-channel",
+			GuildID:   "test-guild",
+			Author:    &discordgo.User{ID: "test-user"},
+		}},
+	}
+	defer event.ReleaseSentryHub()
+
+	var sendErr error
+	event.discordBreadcrumb("SendMessage", "test-channel", &sendErr)
+
+	HandleErrWith("Test", errors.WithStack(errors.New("test sentry error")), &event, SentryErrorHandler)
+
+	var body []byte
+	select {
+	case body = <-requests:
+	default:
+		t.Fatal("Expected error to be sent to sentry")
+	}
+
+	for _, expected := range []string{"test sentry error", "test-guild", "test-channel", "test-user", "SendMessage", "sentry_test.go"} {
+		if !bytes.Contains(body, []byte(expected)) {
+			t.Error("Expected sentry event to contain ", expected, ", got ", string(body))
+		}
+	}
+
+	// expected errors should not be sent
+	HandleErrWith("Test", errors.WithStack(&discordgo.RESTError{Message: &discordgo.APIErrorMessage{
+		Code: discordgo.ErrCodeMissingPermissions,
+	}}), &event, SentryErrorHandler)
+	select {
+	case body = <-requests:
+		t.Error("Expected no sentry event for expected error, got ", string(body))
+	default:
+	}
+}
+
+func TestSentryHub_Store(t *testing.T) {
+	event := EventContainer{Type: MessageCreateEventType, Key: "test-sentry-hub"}
+
+	// no hubs are stored if sentry is not initialised
+	event.SentryHub()
+	eventSentryHubsMutex.Lock()
+	_, stored := eventSentryHubs[event.Key]
+	eventSentryHubsMutex.Unlock()
+	if stored {
+		t.Error("Expected no hub to be stored without sentry client")
+	}
+
+	err := sentry.Init(sentry.ClientOptions{Dsn: "http://public@127.0.0.1/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sentry.CurrentHub().BindClient(nil)
+
+	hub := event.SentryHub()
+	if event.SentryHub() != hub {
+		t.Error("Expected the same hub for the same event")
+	}
+
+	eventSentryHubsMutex.Lock()
+	eventSentryHubs[event.Key] = eventSentryHub{hub: hub, createdAt: time.Now().Add(-sentryHubExpiry - time.Second)}
+	eventSentryHubsMutex.Unlock()
+	removeExpiredSentryHubs()
+	if event.SentryHub() == hub {
+		t.Error("Expected expired hub to be removed")
+	}
+	event.ReleaseSentryHub()
+}
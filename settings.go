@@ -0,0 +1,617 @@
+package dhelpers
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"gitlab.com/Cacophony/dhelpers/models"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+)
+
+// defines the errors returned by settings
+var (
+	ErrSettingKeyMissing      = errors.New("setting key is missing")
+	ErrSettingKeyDuplicate    = errors.New("setting key is registered multiple times")
+	ErrSettingNotRegistered   = errors.New("setting is not registered")
+	ErrSettingInvalidType     = errors.New("setting value has an invalid type")
+	ErrSettingScopeNotAllowed = errors.New("setting can not be set for this scope")
+)
+
+// settingsChangesChannel is the redis channel setting changes are published to
+const settingsChangesChannel = "project-d:settings:changes"
+
+// settingCacheExpiry is the duration setting values are cached in redis
+const settingCacheExpiry = 1 * time.Hour
+
+// SettingType is the type of the value of a Setting
+type SettingType string
+
+// defines the possible setting types
+const (
+	SettingTypeString     SettingType = "string"     // string
+	SettingTypeInt        SettingType = "int"        // int
+	SettingTypeFloat      SettingType = "float"      // float64
+	SettingTypeBool       SettingType = "bool"       // bool
+	SettingTypeStringList SettingType = "stringlist" // []string
+)
+
+// SettingScope is the scope a setting value is set for
+type SettingScope string
+
+// defines the possible setting scopes
+const (
+	SettingScopeGuild   SettingScope = "guild"
+	SettingScopeChannel SettingScope = "channel"
+	SettingScopeUser    SettingScope = "user"
+)
+
+// Setting defines a setting, register it using RegisterSetting
+type Setting struct {
+	// Key identifies the setting, for example lastfm:default-period
+	Key string
+	// Type is the type of the value
+	Type SettingType
+	// Default is used if no value has been set, has to be of the Type
+	Default interface{}
+	// Description describes the setting
+	Description string
+	// Scopes are the scopes the setting can be set for, all scopes if empty
+	Scopes []SettingScope
+	// Validate is called before a value is set, values are rejected if an error is returned, optional
+	Validate func(value interface{}) error
+}
+
+// SettingTarget is the guild, channel, or user a setting value is set for
+// create it using GuildSetting, ChannelSetting, or UserSetting
+type SettingTarget struct {
+	Scope   SettingScope
+	GuildID string
+	ScopeID string // the channel or user ID, empty for guild settings
+}
+
+// SettingChange is published to all processes when a setting value is set or reset
+type SettingChange struct {
+	Key     string
+	Scope   SettingScope
+	GuildID string
+	ScopeID string
+	Value   interface{} // the new value, nil if reset
+	Reset   bool
+	Time    time.Time
+}
+
+// SettingsExport contains all setting values of a guild, see ExportGuildSettings
+type SettingsExport struct {
+	GuildID    string
+	ExportedAt time.Time
+	Settings   []ExportedSetting
+}
+
+// ExportedSetting is a setting value of a SettingsExport
+type ExportedSetting struct {
+	Key     string
+	Scope   SettingScope
+	ScopeID string `json:",omitempty"`
+	Value   interface{}
+}
+
+var (
+	settings      = make(map[string]Setting)
+	settingsMutex sync.RWMutex
+)
+
+// GuildSetting returns the target for a setting value of a guild
+func GuildSetting(guildID string) SettingTarget {
+	return SettingTarget{Scope: SettingScopeGuild, GuildID: guildID}
+}
+
+// ChannelSetting returns the target for a setting value of a channel, falls back to the guild value
+func ChannelSetting(guildID, channelID string) SettingTarget {
+	return SettingTarget{Scope: SettingScopeChannel, GuildID: guildID, ScopeID: channelID}
+}
+
+// UserSetting returns the target for a setting value of a user in a guild, falls back to the guild value
+func UserSetting(guildID, userID string) SettingTarget {
+	return SettingTarget{Scope: SettingScopeUser, GuildID: guildID, ScopeID: userID}
+}
+
+// RegisterSetting registers a setting, has to be called before values of the setting can be get or set
+func RegisterSetting(setting Setting) (err error) {
+	if setting.Key == "" {
+		return ErrSettingKeyMissing
+	}
+
+	setting.Default, err = normalizeSettingValue(setting.Type, setting.Default)
+	if err != nil {
+		return errors.Wrap(err, "invalid default of setting "+setting.Key)
+	}
+
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	if _, ok := settings[setting.Key]; ok {
+		return ErrSettingKeyDuplicate
+	}
+	settings[setting.Key] = setting
+	return nil
+}
+
+// GetSettingDefinitions returns all registered settings, sorted by key
+func GetSettingDefinitions() (definitions []Setting) {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+
+	for _, setting := range settings {
+		definitions = append(definitions, setting)
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Key < definitions[j].Key
+	})
+	return definitions
+}
+
+// GetSetting returns the value of a setting for the target
+// channel and user values fall back to the guild value, the guild value falls back to the default of the setting
+func GetSetting(ctx context.Context, target SettingTarget, key string) (value interface{}, err error) {
+	setting, err := getSettingDefinition(key)
+	if err != nil {
+		return nil, err
+	}
+
+	lookups := []SettingTarget{target}
+	if target.Scope != SettingScopeGuild {
+		lookups = append(lookups, GuildSetting(target.GuildID))
+	}
+
+	for _, lookup := range lookups {
+		if !setting.allows(lookup.Scope) {
+			continue
+		}
+
+		var data string
+		data, err = getSettingValue(ctx, lookup, key)
+		if err != nil {
+			return nil, err
+		}
+		if data == "" {
+			continue
+		}
+
+		return decodeSettingValue(setting.Type, data)
+	}
+
+	// copy the default, to not share lists with the caller
+	return normalizeSettingValue(setting.Type, setting.Default)
+}
+
+// GetSettingString returns the value of a SettingTypeString setting for the target, see GetSetting
+func GetSettingString(ctx context.Context, target SettingTarget, key string) (value string, err error) {
+	result, err := getTypedSetting(ctx, target, key, SettingTypeString)
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+// GetSettingInt returns the value of a SettingTypeInt setting for the target, see GetSetting
+func GetSettingInt(ctx context.Context, target SettingTarget, key string) (value int, err error) {
+	result, err := getTypedSetting(ctx, target, key, SettingTypeInt)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int), nil
+}
+
+// GetSettingFloat returns the value of a SettingTypeFloat setting for the target, see GetSetting
+func GetSettingFloat(ctx context.Context, target SettingTarget, key string) (value float64, err error) {
+	result, err := getTypedSetting(ctx, target, key, SettingTypeFloat)
+	if err != nil {
+		return 0, err
+	}
+	return result.(float64), nil
+}
+
+// GetSettingBool returns the value of a SettingTypeBool setting for the target, see GetSetting
+func GetSettingBool(ctx context.Context, target SettingTarget, key string) (value bool, err error) {
+	result, err := getTypedSetting(ctx, target, key, SettingTypeBool)
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// GetSettingStringList returns the value of a SettingTypeStringList setting for the target, see GetSetting
+func GetSettingStringList(ctx context.Context, target SettingTarget, key string) (value []string, err error) {
+	result, err := getTypedSetting(ctx, target, key, SettingTypeStringList)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]string), nil
+}
+
+// SetSetting sets the value of a setting for the target, and publishes the change
+// value	: has to be of the type of the setting, and pass its validation
+func SetSetting(ctx context.Context, target SettingTarget, key string, value interface{}) (err error) {
+	setting, err := getSettingDefinition(key)
+	if err != nil {
+		return err
+	}
+
+	value, err = setting.check(target.Scope, value)
+	if err != nil {
+		return err
+	}
+
+	data, err := jsoniter.MarshalToString(value)
+	if err != nil {
+		return err
+	}
+
+	err = models.SettingsRepository.Upsert(
+		ctx,
+		settingFilter(target, key),
+		map[string]interface{}{"$set": models.SettingEntry{
+			GuildID:   target.GuildID,
+			Scope:     string(target.Scope),
+			ScopeID:   target.ScopeID,
+			Key:       key,
+			Value:     data,
+			UpdatedAt: time.Now(),
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = cache.GetRedisClient().Set(settingCacheKey(target, key), data, settingCacheExpiry).Err()
+	if err != nil {
+		return err
+	}
+
+	return publishSettingChange(SettingChange{
+		Key:     key,
+		Scope:   target.Scope,
+		GuildID: target.GuildID,
+		ScopeID: target.ScopeID,
+		Value:   value,
+		Time:    time.Now(),
+	})
+}
+
+// ResetSetting removes the value of a setting for the target, and publishes the change
+func ResetSetting(ctx context.Context, target SettingTarget, key string) (err error) {
+	err = models.SettingsRepository.Delete(ctx, settingFilter(target, key))
+	if err != nil && err != mongo.ErrNotFound {
+		return err
+	}
+
+	err = cache.GetRedisClient().Set(settingCacheKey(target, key), "", settingCacheExpiry).Err()
+	if err != nil {
+		return err
+	}
+
+	return publishSettingChange(SettingChange{
+		Key:     key,
+		Scope:   target.Scope,
+		GuildID: target.GuildID,
+		ScopeID: target.ScopeID,
+		Reset:   true,
+		Time:    time.Now(),
+	})
+}
+
+// ListenSettingChanges calls the handler for every setting change of any process until the context is done
+func ListenSettingChanges(ctx context.Context, handler func(change SettingChange)) (err error) {
+	pubsub := cache.GetRedisClient().Subscribe(settingsChangesChannel)
+	defer pubsub.Close() // nolint: errcheck
+
+	// wait for the subscription to be confirmed
+	_, err = pubsub.Receive()
+	if err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case redisMessage, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var change SettingChange
+			err = jsoniter.UnmarshalFromString(redisMessage.Payload, &change)
+			if err != nil {
+				if cache.HasLogger() {
+					cache.GetLogger().WithField("module", "settings").Warnln("received invalid setting change:", err.Error())
+				}
+				continue
+			}
+
+			// JSON decodes numbers as float64, restore the type of the setting
+			if setting, err := getSettingDefinition(change.Key); err == nil && !change.Reset {
+				change.Value, _ = normalizeSettingValue(setting.Type, change.Value)
+			}
+
+			handler(change)
+		}
+	}
+}
+
+// ExportGuildSettings returns all setting values of a guild, including channel and user values
+func ExportGuildSettings(ctx context.Context, guildID string) (export SettingsExport, err error) {
+	var entries []models.SettingEntry
+	err = models.SettingsRepository.Find(ctx, map[string]string{"guildid": guildID}, &entries)
+	if err != nil {
+		return export, err
+	}
+
+	export.GuildID = guildID
+	export.ExportedAt = time.Now()
+	for _, entry := range entries {
+		var value interface{}
+		err = jsoniter.UnmarshalFromString(entry.Value, &value)
+		if err != nil {
+			return export, errors.Wrap(err, "invalid value of setting "+entry.Key)
+		}
+
+		export.Settings = append(export.Settings, ExportedSetting{
+			Key:     entry.Key,
+			Scope:   SettingScope(entry.Scope),
+			ScopeID: entry.ScopeID,
+			Value:   value,
+		})
+	}
+
+	sort.Slice(export.Settings, func(i, j int) bool {
+		a, b := export.Settings[i], export.Settings[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		return a.ScopeID < b.ScopeID
+	})
+
+	return export, nil
+}
+
+// ImportGuildSettings sets all setting values of an export for a guild, the export can be of another guild
+// all values are checked before any value is set
+// replace	: if true, values of the guild which are not part of the export are reset, after the export is set
+func ImportGuildSettings(ctx context.Context, guildID string, export SettingsExport, replace bool) (err error) {
+	values := make([]interface{}, len(export.Settings))
+	imported := make(map[SettingTarget]map[string]bool)
+	for i, exported := range export.Settings {
+		setting, err := getSettingDefinition(exported.Key)
+		if err != nil {
+			return errors.Wrap(err, "invalid setting "+exported.Key)
+		}
+
+		values[i], err = setting.check(exported.Scope, exported.Value)
+		if err != nil {
+			return errors.Wrap(err, "invalid value of setting "+exported.Key)
+		}
+
+		target := SettingTarget{Scope: exported.Scope, GuildID: guildID, ScopeID: exported.ScopeID}
+		if imported[target] == nil {
+			imported[target] = make(map[string]bool)
+		}
+		imported[target][exported.Key] = true
+	}
+
+	for i, exported := range export.Settings {
+		err = SetSetting(
+			ctx,
+			SettingTarget{Scope: exported.Scope, GuildID: guildID, ScopeID: exported.ScopeID},
+			exported.Key,
+			values[i],
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// values are only reset after the export is set, a failed import does not leave the guild without its values
+	if replace {
+		var entries []models.SettingEntry
+		err = models.SettingsRepository.Find(ctx, map[string]string{"guildid": guildID}, &entries)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			target := SettingTarget{Scope: SettingScope(entry.Scope), GuildID: guildID, ScopeID: entry.ScopeID}
+			if imported[target][entry.Key] {
+				continue
+			}
+
+			err = ResetSetting(ctx, target, entry.Key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// allows returns true if the setting can be set for the scope
+func (setting Setting) allows(scope SettingScope) bool {
+	if len(setting.Scopes) <= 0 {
+		return true
+	}
+	for _, allowed := range setting.Scopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the value converted to the type of the setting, if it can be set for the scope
+func (setting Setting) check(scope SettingScope, value interface{}) (result interface{}, err error) {
+	if !setting.allows(scope) {
+		return nil, ErrSettingScopeNotAllowed
+	}
+
+	result, err = normalizeSettingValue(setting.Type, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if setting.Validate != nil {
+		err = setting.Validate(result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func getSettingDefinition(key string) (setting Setting, err error) {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+
+	setting, ok := settings[key]
+	if !ok {
+		return setting, ErrSettingNotRegistered
+	}
+	return setting, nil
+}
+
+func getTypedSetting(ctx context.Context, target SettingTarget, key string, settingType SettingType) (value interface{}, err error) {
+	setting, err := getSettingDefinition(key)
+	if err != nil {
+		return nil, err
+	}
+	if setting.Type != settingType {
+		return nil, ErrSettingInvalidType
+	}
+
+	return GetSetting(ctx, target, key)
+}
+
+func settingCacheKey(target SettingTarget, key string) (cacheKey string) {
+	return "project-d:settings:value:" + target.GuildID + ":" + string(target.Scope) + ":" + target.ScopeID + ":" + key
+}
+
+// getSettingValue returns the JSON encoded value of a setting for the target, returns an empty string if no value has been set
+// values are cached in redis by target and key, so changes only invalidate the changed value
+func getSettingValue(ctx context.Context, target SettingTarget, key string) (data string, err error) {
+	// try cache, empty values are cached as well
+	cacheKey := settingCacheKey(target, key)
+	data, err = cache.GetRedisClient().Get(cacheKey).Result()
+	if err == nil {
+		return data, nil
+	}
+	if err != redis.Nil {
+		return "", err
+	}
+
+	var entry models.SettingEntry
+	err = models.SettingsRepository.FindOne(ctx, settingFilter(target, key), &entry)
+	if err != nil && err != mongo.ErrNotFound {
+		return "", err
+	}
+
+	// the value is only cached if it is not cached yet, a concurrent write may have cached a newer value
+	// while it was read, writes overwrite the cached value
+	err = cache.GetRedisClient().SetNX(cacheKey, entry.Value, settingCacheExpiry).Err()
+	return entry.Value, err
+}
+
+func settingFilter(target SettingTarget, key string) (filter map[string]string) {
+	return map[string]string{
+		"guildid": target.GuildID,
+		"scope":   string(target.Scope),
+		"scopeid": target.ScopeID,
+		"key":     key,
+	}
+}
+
+func publishSettingChange(change SettingChange) (err error) {
+	data, err := jsoniter.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	return cache.GetRedisClient().Publish(settingsChangesChannel, data).Err()
+}
+
+// decodeSettingValue decodes a JSON encoded value to the type of the setting
+func decodeSettingValue(settingType SettingType, data string) (value interface{}, err error) {
+	err = jsoniter.UnmarshalFromString(data, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalizeSettingValue(settingType, value)
+}
+
+// normalizeSettingValue converts the value to the Go type of the setting type
+// accepts the types JSON values are decoded to, for example float64 for SettingTypeInt
+func normalizeSettingValue(settingType SettingType, value interface{}) (result interface{}, err error) {
+	switch settingType {
+	case SettingTypeString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case SettingTypeBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case SettingTypeInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int32:
+			return int(v), nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+				return int(v), nil
+			}
+		}
+	case SettingTypeFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+	case SettingTypeStringList:
+		switch v := value.(type) {
+		case []string:
+			return append([]string{}, v...), nil
+		case []interface{}:
+			list := make([]string, 0, len(v))
+			for _, item := range v {
+				text, ok := item.(string)
+				if !ok {
+					return nil, ErrSettingInvalidType
+				}
+				list = append(list, text)
+			}
+			return list, nil
+		}
+	}
+
+	return nil, ErrSettingInvalidType
+}
@@ -0,0 +1,298 @@
+package dhelpers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRegisterSetting(t *testing.T) {
+	err := RegisterSetting(Setting{Type: SettingTypeInt, Default: 1})
+	if err != ErrSettingKeyMissing {
+		t.Error("Expected ErrSettingKeyMissing, got ", err)
+	}
+
+	err = RegisterSetting(Setting{Key: "test:register-invalid", Type: SettingTypeInt, Default: "1"})
+	if errors.Cause(err) != ErrSettingInvalidType {
+		t.Error("Expected ErrSettingInvalidType, got ", err)
+	}
+
+	err = RegisterSetting(Setting{Key: "test:register", Type: SettingTypeInt, Default: int64(1)})
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	err = RegisterSetting(Setting{Key: "test:register", Type: SettingTypeInt, Default: 2})
+	if err != ErrSettingKeyDuplicate {
+		t.Error("Expected ErrSettingKeyDuplicate, got ", err)
+	}
+
+	setting, err := getSettingDefinition("test:register")
+	if err != nil || setting.Default != 1 {
+		t.Error("Expected default 1, got ", setting.Default, err)
+	}
+
+	_, err = getSettingDefinition("test:missing")
+	if err != ErrSettingNotRegistered {
+		t.Error("Expected ErrSettingNotRegistered, got ", err)
+	}
+}
+
+func TestNormalizeSettingValue(t *testing.T) {
+	value, err := normalizeSettingValue(SettingTypeInt, float64(5))
+	if err != nil || value != 5 {
+		t.Error("Expected 5, got ", value, err)
+	}
+	_, err = normalizeSettingValue(SettingTypeInt, 5.5)
+	if err != ErrSettingInvalidType {
+		t.Error("Expected ErrSettingInvalidType, got ", err)
+	}
+	value, err = normalizeSettingValue(SettingTypeFloat, 5)
+	if err != nil || value != float64(5) {
+		t.Error("Expected 5.0, got ", value, err)
+	}
+	_, err = normalizeSettingValue(SettingTypeBool, "true")
+	if err != ErrSettingInvalidType {
+		t.Error("Expected ErrSettingInvalidType, got ", err)
+	}
+
+	value, err = decodeSettingValue(SettingTypeStringList, `["a","b"]`)
+	list, ok := value.([]string)
+	if err != nil || !ok || len(list) != 2 || list[0] != "a" || list[1] != "b" {
+		t.Error("Expected [a b], got ", value, err)
+	}
+	_, err = decodeSettingValue(SettingTypeStringList, `["a",1]`)
+	if err != ErrSettingInvalidType {
+		t.Error("Expected ErrSettingInvalidType, got ", err)
+	}
+}
+
+func TestSetSetting_Check(t *testing.T) {
+	err := RegisterSetting(Setting{
+		Key:     "test:check",
+		Type:    SettingTypeInt,
+		Default: 10,
+		Scopes:  []SettingScope{SettingScopeGuild, SettingScopeChannel},
+		Validate: func(value interface{}) error {
+			if value.(int) <= 0 {
+				return errors.New("value has to be positive")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	// all checks happen before the database is used
+	err = SetSetting(context.Background(), UserSetting("1", "2"), "test:check", 5)
+	if err != ErrSettingScopeNotAllowed {
+		t.Error("Expected ErrSettingScopeNotAllowed, got ", err)
+	}
+	err = SetSetting(context.Background(), GuildSetting("1"), "test:check", "5")
+	if err != ErrSettingInvalidType {
+		t.Error("Expected ErrSettingInvalidType, got ", err)
+	}
+	err = SetSetting(context.Background(), GuildSetting("1"), "test:check", -1)
+	if err == nil || err.Error() != "value has to be positive" {
+		t.Error("Expected validation error, got ", err)
+	}
+	err = SetSetting(context.Background(), GuildSetting("1"), "test:missing", 1)
+	if err != ErrSettingNotRegistered {
+		t.Error("Expected ErrSettingNotRegistered, got ", err)
+	}
+
+	_, err = GetSettingString(context.Background(), GuildSetting("1"), "test:check")
+	if err != ErrSettingInvalidType {
+		t.Error("Expected ErrSettingInvalidType, got ", err)
+	}
+
+	err = ImportGuildSettings(context.Background(), "1", SettingsExport{Settings: []ExportedSetting{
+		{Key: "test:check", Scope: SettingScopeGuild, Value: float64(0)},
+	}}, true)
+	if err == nil {
+		t.Error("Expected validation error for import, got nil")
+	}
+}
+
+// registerTestSetting registers a setting with a unique key
+func registerTestSetting(t *testing.T, setting Setting) string {
+	setting.Key = "test:" + setting.Key + ":" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	err := RegisterSetting(setting)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	return setting.Key
+}
+
+func TestGetSetting_Fallback(t *testing.T) {
+	skipWithoutMongo(t)
+
+	key := registerTestSetting(t, Setting{Key: "fallback", Type: SettingTypeInt, Default: 1})
+	guildID := "guild" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	ctx := context.Background()
+	defer ResetSetting(ctx, GuildSetting(guildID), key)              // nolint: errcheck
+	defer ResetSetting(ctx, ChannelSetting(guildID, "channel"), key) // nolint: errcheck
+
+	// default
+	value, err := GetSettingInt(ctx, UserSetting(guildID, "user"), key)
+	if err != nil || value != 1 {
+		t.Error("Expected default 1, got ", value, err)
+	}
+
+	// guild value
+	err = SetSetting(ctx, GuildSetting(guildID), key, 2)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	value, err = GetSettingInt(ctx, UserSetting(guildID, "user"), key)
+	if err != nil || value != 2 {
+		t.Error("Expected guild value 2 for user, got ", value, err)
+	}
+	value, err = GetSettingInt(ctx, ChannelSetting(guildID, "channel"), key)
+	if err != nil || value != 2 {
+		t.Error("Expected guild value 2 for channel, got ", value, err)
+	}
+
+	// channel value
+	err = SetSetting(ctx, ChannelSetting(guildID, "channel"), key, 3)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	value, err = GetSettingInt(ctx, ChannelSetting(guildID, "channel"), key)
+	if err != nil || value != 3 {
+		t.Error("Expected channel value 3, got ", value, err)
+	}
+	value, err = GetSettingInt(ctx, ChannelSetting(guildID, "other-channel"), key)
+	if err != nil || value != 2 {
+		t.Error("Expected guild value 2 for other channel, got ", value, err)
+	}
+}
+
+func TestSetSetting_RoundTrip(t *testing.T) {
+	skipWithoutMongo(t)
+
+	key := registerTestSetting(t, Setting{Key: "round-trip", Type: SettingTypeStringList, Default: []string{"a"}})
+	target := GuildSetting("guild" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	ctx := context.Background()
+	defer ResetSetting(ctx, target, key) // nolint: errcheck
+
+	// the default is copied, changes of the caller do not change the default
+	value, err := GetSettingStringList(ctx, target, key)
+	if err != nil || len(value) != 1 || value[0] != "a" {
+		t.Fatal("Expected default [a], got ", value, err)
+	}
+	value[0] = "changed"
+	value, err = GetSettingStringList(ctx, target, key)
+	if err != nil || len(value) != 1 || value[0] != "a" {
+		t.Error("Expected unchanged default [a], got ", value, err)
+	}
+
+	err = SetSetting(ctx, target, key, []string{"b", "c"})
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	value, err = GetSettingStringList(ctx, target, key)
+	if err != nil || len(value) != 2 || value[0] != "b" || value[1] != "c" {
+		t.Error("Expected [b c], got ", value, err)
+	}
+
+	err = ResetSetting(ctx, target, key)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+	value, err = GetSettingStringList(ctx, target, key)
+	if err != nil || len(value) != 1 || value[0] != "a" {
+		t.Error("Expected default [a] after reset, got ", value, err)
+	}
+}
+
+func TestImportGuildSettings_Replace(t *testing.T) {
+	skipWithoutMongo(t)
+
+	keyA := registerTestSetting(t, Setting{Key: "import-a", Type: SettingTypeInt, Default: 0})
+	keyB := registerTestSetting(t, Setting{Key: "import-b", Type: SettingTypeString, Default: ""})
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	sourceGuildID, targetGuildID := "source"+suffix, "target"+suffix
+	ctx := context.Background()
+	defer ResetSetting(ctx, GuildSetting(sourceGuildID), keyA)              // nolint: errcheck
+	defer ResetSetting(ctx, UserSetting(sourceGuildID, "user"), keyB)       // nolint: errcheck
+	defer ResetSetting(ctx, GuildSetting(targetGuildID), keyA)              // nolint: errcheck
+	defer ResetSetting(ctx, UserSetting(targetGuildID, "user"), keyB)       // nolint: errcheck
+	defer ResetSetting(ctx, ChannelSetting(targetGuildID, "channel"), keyB) // nolint: errcheck
+
+	for _, set := range []struct {
+		target SettingTarget
+		key    string
+		value  interface{}
+	}{
+		{GuildSetting(sourceGuildID), keyA, 5},
+		{UserSetting(sourceGuildID, "user"), keyB, "user value"},
+		{GuildSetting(targetGuildID), keyA, 1},
+		{ChannelSetting(targetGuildID, "channel"), keyB, "removed by import"},
+	} {
+		err := SetSetting(ctx, set.target, set.key, set.value)
+		if err != nil {
+			t.Fatal("Expected no error, got ", err)
+		}
+	}
+
+	export, err := ExportGuildSettings(ctx, sourceGuildID)
+	if err != nil || len(export.Settings) != 2 {
+		t.Fatal("Expected 2 exported settings, got ", export.Settings, err)
+	}
+
+	err = ImportGuildSettings(ctx, targetGuildID, export, true)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	valueA, err := GetSettingInt(ctx, GuildSetting(targetGuildID), keyA)
+	if err != nil || valueA != 5 {
+		t.Error("Expected imported value 5, got ", valueA, err)
+	}
+	valueB, err := GetSettingString(ctx, UserSetting(targetGuildID, "user"), keyB)
+	if err != nil || valueB != "user value" {
+		t.Error("Expected imported user value, got ", valueB, err)
+	}
+	valueB, err = GetSettingString(ctx, ChannelSetting(targetGuildID, "channel"), keyB)
+	if err != nil || valueB != "" {
+		t.Error("Expected channel value to be reset by replace, got ", valueB, err)
+	}
+}
+
+func TestListenSettingChanges(t *testing.T) {
+	key := registerTestSetting(t, Setting{Key: "listen", Type: SettingTypeInt, Default: 0})
+	target := GuildSetting("guild" + strconv.FormatInt(time.Now().UnixNano(), 10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan SettingChange, 10)
+	go ListenSettingChanges(ctx, func(change SettingChange) { // nolint: errcheck
+		if change.Key == key {
+			changes <- change
+		}
+	})
+
+	// publish until the subscription is ready
+	for i := 0; i < 50; i++ {
+		err := publishSettingChange(SettingChange{Key: key, Scope: target.Scope, GuildID: target.GuildID, Value: 7})
+		if err != nil {
+			t.Fatal("Expected no error, got ", err)
+		}
+
+		select {
+		case change := <-changes:
+			// JSON decodes the value as float64
+			if value, ok := change.Value.(int); !ok || value != 7 {
+				t.Errorf("Expected int 7, got %T %v", change.Value, change.Value)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	t.Error("Expected to receive the setting change")
+}
@@ -143,7 +143,7 @@ func RetrieveFile(ctx context.Context, objectName string) (data []byte, err erro
 	// Increase MongoDB RetrievedCount
 	go func() {
 		defer RecoverLog()
-		goErr := models.StorageRepository.Update(
+		goErr := models.StorageStatisticsRepository.Update(
 			ctx,
 			map[string]string{"objectname": objectName},
 			map[string]map[string]int{"$inc": {"retrievedcount": 1}},
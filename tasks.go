@@ -0,0 +1,549 @@
+package dhelpers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/json-iterator/go"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/opentracing/opentracing-go"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"gitlab.com/Cacophony/dhelpers/models"
+	"gitlab.com/Cacophony/dhelpers/mongo"
+)
+
+// defines the errors returned by the delayed task helpers
+var (
+	ErrTaskNotFound        = errors.New("task not found")
+	ErrTaskHandlerNotFound = errors.New("task handler not found")
+)
+
+// taskRedisHorizon is the maximum delay of tasks stored in redis, tasks due later are stored in MongoDB
+const taskRedisHorizon = 24 * time.Hour
+
+// taskDataKey is the hash containing all tasks stored in redis, by ID
+const taskDataKey = "project-d:tasks:data"
+
+func taskDueKey(handler string) (key string) {
+	return "project-d:tasks:" + handler + ":due"
+}
+
+func taskLeasesKey(handler string) (key string) {
+	return "project-d:tasks:" + handler + ":leases"
+}
+
+// taskCancelledKey marks a cancelled Task, so it is not moved from MongoDB to redis while it is being cancelled
+func taskCancelledKey(taskID string) (key string) {
+	return "project-d:tasks:cancelled:" + taskID
+}
+
+// taskCancelledExpiry is the duration a Task is marked as cancelled, longer than a run of TaskWorker.promote
+const taskCancelledExpiry = 1 * time.Hour
+
+// taskClaimScript claims due tasks, tasks with expired leases are due again
+// KEYS[1]: the sorted set of due tasks
+// KEYS[2]: the sorted set of leased tasks
+// ARGV[1]: the current time in milliseconds
+// ARGV[2]: the lease duration in milliseconds
+// ARGV[3]: the maximum number of tasks to claim
+// returns the IDs of the claimed tasks
+var taskClaimScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now)
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('ZADD', KEYS[1], now, id)
+end
+
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now, 'LIMIT', 0, tonumber(ARGV[3]))
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZADD', KEYS[2], now + tonumber(ARGV[2]), id)
+end
+return ids
+`)
+
+// taskRetryScript stores a failed Task to be due again, unless it has been cancelled while it was running
+// KEYS[1]: the hash of task data
+// KEYS[2]: the sorted set of leased tasks
+// KEYS[3]: the sorted set of due tasks
+// ARGV[1]: the task ID
+// ARGV[2]: the task data
+// ARGV[3]: the due time in milliseconds
+// returns 1 if the task has been stored
+var taskRetryScript = redis.NewScript(`
+redis.call('ZREM', KEYS[2], ARGV[1])
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+return 1
+`)
+
+// taskPromoteScript stores a Task moved from MongoDB, unless it is being cancelled
+// KEYS[1]: the hash of task data
+// KEYS[2]: the sorted set of due tasks
+// KEYS[3]: the cancellation mark of the task
+// ARGV[1]: the task ID
+// ARGV[2]: the task data
+// ARGV[3]: the due time in milliseconds
+// returns 1 if the task has been stored, the cancellation mark is set to skipped otherwise
+var taskPromoteScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[3])
+if ttl > 0 then
+	redis.call('SET', KEYS[3], 'skipped', 'PX', ttl)
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+return 1
+`)
+
+// Task is a delayed task, run by a TaskWorker once it is due
+type Task struct {
+	ID        string
+	Handler   string
+	Payload   []byte
+	DueAt     time.Time
+	Attempts  int // the number of failed attempts
+	CreatedAt time.Time
+}
+
+// Decode decodes the payload of the Task into value
+func (t *Task) Decode(value interface{}) (err error) {
+	return jsoniter.Unmarshal(t.Payload, value)
+}
+
+// TaskHandler runs a Task, the Task will be retried if an error is returned
+// the context is cancelled once the lease of the Task expires
+type TaskHandler func(ctx context.Context, task *Task) error
+
+var (
+	taskHandlers      = make(map[string]TaskHandler)
+	taskHandlersMutex sync.RWMutex
+)
+
+// RegisterTaskHandler registers a handler for Tasks, TaskWorkers started afterwards run Tasks for the handler
+// name	: the name of the handler, should be prefixed by module, for example mod:unmute
+func RegisterTaskHandler(name string, handler TaskHandler) {
+	taskHandlersMutex.Lock()
+	defer taskHandlersMutex.Unlock()
+
+	taskHandlers[name] = handler
+}
+
+// GetTaskHandler returns the handler registered for the name
+func GetTaskHandler(name string) (handler TaskHandler, ok bool) {
+	taskHandlersMutex.RLock()
+	defer taskHandlersMutex.RUnlock()
+
+	handler, ok = taskHandlers[name]
+	return handler, ok
+}
+
+// EnqueueTask stores a Task which will be run by a TaskWorker with the handler once it is due
+// handler	: the name of the handler, see RegisterTaskHandler, can be registered in a different service
+// payload	: will be encoded as JSON, use Task.Decode to read it
+// dueAt	: the time the task should run at
+func EnqueueTask(ctx context.Context, handler string, payload interface{}, dueAt time.Time) (taskID string, err error) {
+	var span opentracing.Span
+	span, ctx = opentracing.StartSpanFromContext(ctx, "dhelpers.EnqueueTask")
+	defer span.Finish()
+
+	data, err := jsoniter.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	id := objectid.New()
+	task := &Task{
+		ID:        id.Hex(),
+		Handler:   handler,
+		Payload:   data,
+		DueAt:     dueAt,
+		CreatedAt: time.Now(),
+	}
+
+	// store tasks which are due far in the future in MongoDB
+	if time.Until(dueAt) > taskRedisHorizon {
+		_, err = models.DelayedTaskRepository.Store(ctx, &models.DelayedTask{
+			ID:        &id,
+			Handler:   task.Handler,
+			Payload:   task.Payload,
+			DueAt:     task.DueAt,
+			CreatedAt: task.CreatedAt,
+		})
+		return task.ID, err
+	}
+
+	return task.ID, storeTask(task)
+}
+
+// CancelTask removes a Task which has not been run yet
+// a Task which is being run at the moment can not be stopped, but will not be retried
+func CancelTask(ctx context.Context, taskID string) (err error) {
+	var span opentracing.Span
+	span, ctx = opentracing.StartSpanFromContext(ctx, "dhelpers.CancelTask")
+	defer span.Finish()
+
+	// mark the task first, so it is not moved from MongoDB to redis after it has been removed from redis
+	redisClient := cache.GetRedisClient()
+	err = redisClient.Set(taskCancelledKey(taskID), "cancelled", taskCancelledExpiry).Err()
+	if err != nil {
+		return err
+	}
+
+	task, err := getTask(taskID)
+	if err != nil && err != ErrTaskNotFound {
+		return err
+	}
+	if task != nil {
+		pipeline := redisClient.TxPipeline()
+		pipeline.ZRem(taskDueKey(task.Handler), task.ID)
+		pipeline.ZRem(taskLeasesKey(task.Handler), task.ID)
+		pipeline.HDel(taskDataKey, task.ID)
+		_, err = pipeline.Exec()
+		return err
+	}
+
+	id, err := objectid.FromHex(taskID)
+	if err != nil {
+		return ErrTaskNotFound
+	}
+	err = models.DelayedTaskRepository.DeleteByID(ctx, id)
+	if err != mongo.ErrNotFound {
+		return err
+	}
+
+	// the task has been removed from MongoDB by TaskWorker.promote meanwhile, without being moved to redis
+	state, err := redisClient.Get(taskCancelledKey(taskID)).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if state == "skipped" {
+		return nil
+	}
+	return ErrTaskNotFound
+}
+
+// storeTask stores the Task in redis, it will be due at Task.DueAt
+func storeTask(task *Task) (err error) {
+	data, err := jsoniter.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	pipeline := cache.GetRedisClient().TxPipeline()
+	pipeline.HSet(taskDataKey, task.ID, data)
+	pipeline.ZAdd(taskDueKey(task.Handler), redis.Z{
+		Score:  float64(taskMilliseconds(task.DueAt)),
+		Member: task.ID,
+	})
+	_, err = pipeline.Exec()
+	return err
+}
+
+func getTask(taskID string) (task *Task, err error) {
+	data, err := cache.GetRedisClient().HGet(taskDataKey, taskID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrTaskNotFound
+		}
+		return nil, err
+	}
+
+	err = jsoniter.Unmarshal(data, &task)
+	return task, err
+}
+
+func taskMilliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// TaskWorker runs due Tasks of all registered handlers
+// Tasks are delivered at least once, a Task is run again if its lease expires before it has been completed
+type TaskWorker struct {
+	// Service is used when reporting errors, default Worker
+	Service string
+	// ErrorHandlers are used when reporting errors of Tasks, see HandleJobErrorWith
+	ErrorHandlers []ErrorHandlerType
+	// PollInterval is the interval at which due Tasks are claimed, default one second
+	PollInterval time.Duration
+	// Lease is the time a Task may run before it is claimed again, default five minutes
+	Lease time.Duration
+	// Concurrency is the maximum number of Tasks run at the same time, default 10
+	Concurrency int
+	// MaxAttempts is the number of attempts after which a failing Task is dropped, default 5
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry, doubled for every further attempt, up to one hour, default 10 seconds
+	RetryDelay time.Duration
+
+	handlers []string
+	slots    chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewTaskWorker creates a TaskWorker for all registered handlers, use Start to start it
+func NewTaskWorker() *TaskWorker {
+	worker := &TaskWorker{
+		Service:      "Worker",
+		PollInterval: 1 * time.Second,
+		Lease:        5 * time.Minute,
+		Concurrency:  10,
+		MaxAttempts:  5,
+		RetryDelay:   10 * time.Second,
+	}
+	worker.ctx, worker.cancel = context.WithCancel(context.Background())
+	return worker
+}
+
+// Start starts claiming and running Tasks, and moving Tasks from MongoDB to redis once they are due soon
+func (w *TaskWorker) Start() {
+	taskHandlersMutex.RLock()
+	for name := range taskHandlers {
+		w.handlers = append(w.handlers, name)
+	}
+	taskHandlersMutex.RUnlock()
+
+	w.slots = make(chan struct{}, w.Concurrency)
+
+	w.wg.Add(2)
+	go w.loop(w.PollInterval, w.poll)
+	go w.loop(1*time.Minute, w.promote)
+}
+
+// Stop stops claiming Tasks, and waits for running Tasks to finish
+func (w *TaskWorker) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
+
+func (w *TaskWorker) loop(interval time.Duration, fn func()) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn()
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll claims due Tasks of all handlers, up to the number of free slots
+func (w *TaskWorker) poll() {
+	for _, handler := range w.handlers {
+		free := cap(w.slots) - len(w.slots)
+		if free <= 0 || w.ctx.Err() != nil {
+			return
+		}
+
+		ids, err := w.claim(handler, free)
+		if err != nil {
+			HandleJobErrorWith(w.Service, "tasks:"+handler, err, w.ErrorHandlers...)
+			continue
+		}
+
+		for _, id := range ids {
+			w.slots <- struct{}{}
+			w.wg.Add(1)
+			go func(handler, id string) {
+				defer func() {
+					<-w.slots
+					w.wg.Done()
+				}()
+
+				w.run(handler, id)
+			}(handler, id)
+		}
+	}
+}
+
+func (w *TaskWorker) claim(handler string, limit int) (ids []string, err error) {
+	result, err := taskClaimScript.Run(
+		cache.GetRedisClient(),
+		[]string{taskDueKey(handler), taskLeasesKey(handler)},
+		taskMilliseconds(time.Now()), int64(w.Lease/time.Millisecond), limit,
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, _ := result.([]interface{})
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// run runs a claimed Task, retries it with backoff if it fails
+func (w *TaskWorker) run(handlerName, taskID string) {
+	task, err := getTask(taskID)
+	if err != nil {
+		if err == ErrTaskNotFound {
+			// cancelled after it has been claimed
+			cache.GetRedisClient().ZRem(taskLeasesKey(handlerName), taskID) // nolint: errcheck
+			return
+		}
+		HandleJobErrorWith(w.Service, "tasks:"+handlerName, err, w.ErrorHandlers...)
+		return
+	}
+
+	err = w.execute(task)
+	if err == nil {
+		w.complete(task)
+		return
+	}
+
+	task.Attempts++
+	HandleJobErrorWith(w.Service, "tasks:"+task.Handler, err, w.ErrorHandlers...)
+	if task.Attempts >= w.MaxAttempts {
+		w.complete(task)
+		return
+	}
+
+	task.DueAt = time.Now().Add(w.retryDelay(task.Attempts))
+	err = w.retry(task)
+	if err != nil {
+		HandleJobErrorWith(w.Service, "tasks:"+task.Handler, err, w.ErrorHandlers...)
+	}
+}
+
+// execute runs the handler of the Task, panics are returned as errors
+func (w *TaskWorker) execute(task *Task) (err error) {
+	handler, ok := GetTaskHandler(task.Handler)
+	if !ok {
+		return ErrTaskHandlerNotFound
+	}
+
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		if recoveredErr, ok := recovered.(error); ok {
+			err = recoveredErr
+			return
+		}
+		err = errors.New("task handler panicked")
+	}()
+
+	ctx, cancel := context.WithTimeout(w.ctx, w.Lease)
+	defer cancel()
+
+	return handler(ctx, task)
+}
+
+// complete removes the Task
+func (w *TaskWorker) complete(task *Task) {
+	pipeline := cache.GetRedisClient().TxPipeline()
+	pipeline.ZRem(taskLeasesKey(task.Handler), task.ID)
+	pipeline.HDel(taskDataKey, task.ID)
+	_, err := pipeline.Exec()
+	if err != nil {
+		HandleJobErrorWith(w.Service, "tasks:"+task.Handler, err, w.ErrorHandlers...)
+	}
+}
+
+// retry releases the lease of the Task, and stores it to be due again
+// a task cancelled while it was running is not retried
+func (w *TaskWorker) retry(task *Task) (err error) {
+	data, err := jsoniter.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	return taskRetryScript.Run(
+		cache.GetRedisClient(),
+		[]string{taskDataKey, taskLeasesKey(task.Handler), taskDueKey(task.Handler)},
+		task.ID, data, taskMilliseconds(task.DueAt),
+	).Err()
+}
+
+// retryDelay returns the delay before the given attempt, doubled for every attempt, up to one hour
+func (w *TaskWorker) retryDelay(attempts int) time.Duration {
+	delay := float64(w.RetryDelay) * math.Pow(2, float64(attempts-1))
+	if delay > float64(time.Hour) {
+		return time.Hour
+	}
+	return time.Duration(delay)
+}
+
+// promote moves Tasks stored in MongoDB to redis once they are due soon
+// only runs on one instance at the same time
+func (w *TaskWorker) promote() {
+	if cache.GetMongo() == nil {
+		return
+	}
+
+	start, locker, err := JobStart("tasks:promote", 1*time.Minute)
+	if err != nil {
+		HandleJobErrorWith(w.Service, "tasks:promote", err, w.ErrorHandlers...)
+		return
+	}
+	if !start {
+		return
+	}
+	defer locker.Unlock() // nolint: errcheck
+
+	var delayedTasks []models.DelayedTask
+	err = models.DelayedTaskRepository.Find(
+		w.ctx,
+		map[string]map[string]time.Time{"dueat": {"$lte": time.Now().Add(taskRedisHorizon)}},
+		&delayedTasks,
+	)
+	if err != nil {
+		HandleJobErrorWith(w.Service, "tasks:promote", err, w.ErrorHandlers...)
+		return
+	}
+
+	for _, delayedTask := range delayedTasks {
+		err = promoteTask(&Task{
+			ID:        delayedTask.ID.Hex(),
+			Handler:   delayedTask.Handler,
+			Payload:   delayedTask.Payload,
+			DueAt:     delayedTask.DueAt,
+			Attempts:  delayedTask.Attempts,
+			CreatedAt: delayedTask.CreatedAt,
+		})
+		if err != nil {
+			HandleJobErrorWith(w.Service, "tasks:promote", err, w.ErrorHandlers...)
+			return
+		}
+
+		err = models.DelayedTaskRepository.DeleteByID(w.ctx, *delayedTask.ID)
+		if err != nil && err != mongo.ErrNotFound {
+			HandleJobErrorWith(w.Service, "tasks:promote", err, w.ErrorHandlers...)
+			return
+		}
+	}
+}
+
+// promoteTask stores a Task moved from MongoDB in redis, unless it is being cancelled
+func promoteTask(task *Task) (err error) {
+	data, err := jsoniter.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	return taskPromoteScript.Run(
+		cache.GetRedisClient(),
+		[]string{taskDataKey, taskDueKey(task.Handler), taskCancelledKey(task.ID)},
+		task.ID, data, taskMilliseconds(task.DueAt),
+	).Err()
+}
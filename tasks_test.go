@@ -0,0 +1,213 @@
+package dhelpers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"gitlab.com/Cacophony/dhelpers/cache"
+)
+
+func newTestTaskWorker(handler string) *TaskWorker {
+	worker := NewTaskWorker()
+	worker.ErrorHandlers = []ErrorHandlerType{LogErrorHandler}
+	worker.RetryDelay = 10 * time.Millisecond
+	worker.handlers = []string{handler}
+	worker.slots = make(chan struct{}, worker.Concurrency)
+	return worker
+}
+
+func TestTaskWorker(t *testing.T) {
+	handler := "test:tasks:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	var received []string
+	var receivedMutex sync.Mutex
+	RegisterTaskHandler(handler, func(ctx context.Context, task *Task) error {
+		var payload string
+		err := task.Decode(&payload)
+		if err != nil {
+			return err
+		}
+
+		receivedMutex.Lock()
+		defer receivedMutex.Unlock()
+		received = append(received, payload)
+		if task.Attempts == 0 && payload == "retry" {
+			return errors.New("first attempt failed")
+		}
+		return nil
+	})
+
+	worker := newTestTaskWorker(handler)
+
+	_, err := EnqueueTask(context.Background(), handler, "now", time.Now())
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	_, err = EnqueueTask(context.Background(), handler, "retry", time.Now())
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	laterID, err := EnqueueTask(context.Background(), handler, "later", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	defer CancelTask(context.Background(), laterID) // nolint: errcheck
+
+	worker.poll()
+	worker.wg.Wait()
+
+	receivedMutex.Lock()
+	if len(received) != 2 {
+		t.Error("Expected two due tasks to run, got ", received)
+	}
+	receivedMutex.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	worker.poll()
+	worker.wg.Wait()
+
+	receivedMutex.Lock()
+	if len(received) != 3 || received[2] != "retry" {
+		t.Error("Expected failed task to be retried, got ", received)
+	}
+	receivedMutex.Unlock()
+
+	task, err := getTask(laterID)
+	if err != nil || task.Handler != handler {
+		t.Error("Expected task due later to be stored, got ", task, err)
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	handler := "test:tasks:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	var runs int
+	RegisterTaskHandler(handler, func(ctx context.Context, task *Task) error {
+		runs++
+		return nil
+	})
+
+	taskID, err := EnqueueTask(context.Background(), handler, nil, time.Now())
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+
+	err = CancelTask(context.Background(), taskID)
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+
+	worker := newTestTaskWorker(handler)
+	worker.poll()
+	worker.wg.Wait()
+
+	if runs != 0 {
+		t.Error("Expected cancelled task to not run, got runs: ", runs)
+	}
+	if _, err = getTask(taskID); err != ErrTaskNotFound {
+		t.Error("Expected ErrTaskNotFound, got ", err)
+	}
+}
+
+func TestTaskWorker_claimLeaseExpired(t *testing.T) {
+	handler := "test:tasks:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	taskID, err := EnqueueTask(context.Background(), handler, nil, time.Now())
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	defer CancelTask(context.Background(), taskID) // nolint: errcheck
+
+	worker := newTestTaskWorker(handler)
+	worker.Lease = 50 * time.Millisecond
+
+	ids, err := worker.claim(handler, 10)
+	if err != nil || len(ids) != 1 || ids[0] != taskID {
+		t.Error("Expected task to be claimed, got ", ids, err)
+	}
+
+	ids, err = worker.claim(handler, 10)
+	if err != nil || len(ids) != 0 {
+		t.Error("Expected leased task to not be claimed again, got ", ids, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	ids, err = worker.claim(handler, 10)
+	if err != nil || len(ids) != 1 || ids[0] != taskID {
+		t.Error("Expected task with expired lease to be claimed again, got ", ids, err)
+	}
+}
+
+func TestTaskWorker_retryCancelled(t *testing.T) {
+	handler := "test:tasks:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	taskID, err := EnqueueTask(context.Background(), handler, nil, time.Now())
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+		return
+	}
+	defer CancelTask(context.Background(), taskID) // nolint: errcheck
+
+	worker := newTestTaskWorker(handler)
+	ids, err := worker.claim(handler, 10)
+	if err != nil || len(ids) != 1 {
+		t.Fatal("Expected task to be claimed, got ", ids, err)
+	}
+	task, err := getTask(taskID)
+	if err != nil {
+		t.Fatal("Expected no error, got ", err)
+	}
+
+	// cancelled while running
+	err = CancelTask(context.Background(), taskID)
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+
+	err = worker.retry(task)
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	if _, err = getTask(taskID); err != ErrTaskNotFound {
+		t.Error("Expected cancelled task to not be stored again, got ", err)
+	}
+	due, err := cache.GetRedisClient().ZScore(taskDueKey(handler), taskID).Result()
+	if err != redis.Nil {
+		t.Error("Expected cancelled task to not be due again, got ", due, err)
+	}
+}
+
+func TestPromoteTask_Cancelled(t *testing.T) {
+	handler := "test:tasks:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	task := &Task{ID: "task" + strconv.FormatInt(time.Now().UnixNano(), 10), Handler: handler, DueAt: time.Now()}
+	defer cache.GetRedisClient().Del(taskCancelledKey(task.ID)) // nolint: errcheck
+
+	// marked by CancelTask, before it deletes the task from MongoDB
+	err := cache.GetRedisClient().Set(taskCancelledKey(task.ID), "cancelled", time.Minute).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = promoteTask(task)
+	if err != nil {
+		t.Error("Expected no error, got ", err)
+	}
+	if _, err = getTask(task.ID); err != ErrTaskNotFound {
+		t.Error("Expected cancelled task to not be moved to redis, got ", err)
+	}
+	state, err := cache.GetRedisClient().Get(taskCancelledKey(task.ID)).Result()
+	if err != nil || state != "skipped" {
+		t.Error("Expected cancellation mark to be skipped, got ", state, err)
+	}
+}
@@ -1,7 +1,9 @@
 package dhelpers
 
 import (
+	"strconv"
 	"strings"
+	"sync"
 
 	"text/template"
 
@@ -12,6 +14,10 @@ import (
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"gitlab.com/Cacophony/dhelpers/cache"
 	"gitlab.com/Cacophony/dhelpers/emoji"
+	dhumanize "gitlab.com/Cacophony/dhelpers/humanize"
+	"gitlab.com/Cacophony/dhelpers/state"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
 )
 
 var (
@@ -56,81 +62,253 @@ var (
 			}
 			return defaultPrefix
 		},
+		// UserMention returns a mention for an User ID
+		// example: {{UserMention "116620585638821891"}} => <@116620585638821891>
+		"UserMention": func(userID string) string {
+			return "<@" + userID + ">"
+		},
+		// RoleMention returns a mention for a Role ID
+		// example: {{RoleMention "435420687906111499"}} => <@&435420687906111499>
+		"RoleMention": func(roleID string) string {
+			return "<@&" + roleID + ">"
+		},
+		// ChannelMention returns a mention for a Channel ID
+		// example: {{ChannelMention "435420687906111500"}} => <#435420687906111500>
+		"ChannelMention": func(channelID string) string {
+			return "<#" + channelID + ">"
+		},
+		// UserName returns the username of an User, or the User ID if the user can not be found
+		// example: {{UserName "116620585638821891"}} => Seklfreak
+		"UserName": func(userID string) string {
+			user, err := state.User(userID)
+			if err != nil {
+				return userID
+			}
+			return user.Username
+		},
+		// MemberName returns the nickname, or username, of a Member, or the User ID if the member can not be found
+		// example: {{MemberName "435420687906111498" "116620585638821891"}} => Sekl
+		"MemberName": func(guildID, userID string) string {
+			member, err := state.Member(guildID, userID)
+			if err != nil || member.User == nil {
+				return userID
+			}
+			if member.Nick != "" {
+				return member.Nick
+			}
+			return member.User.Username
+		},
+		// RoleName returns the name of a Role, or the Role ID if the role can not be found
+		// example: {{RoleName "435420687906111498" "435420687906111499"}} => Moderators
+		"RoleName": func(guildID, roleID string) string {
+			role, err := state.Role(guildID, roleID)
+			if err != nil {
+				return roleID
+			}
+			return role.Name
+		},
+		// ChannelName returns the name of a Channel, or the Channel ID if the channel can not be found
+		// example: {{ChannelName "435420687906111500"}} => general
+		"ChannelName": func(channelID string) string {
+			channel, err := state.Channel(channelID)
+			if err != nil {
+				return channelID
+			}
+			return channel.Name
+		},
+		// Duration formats a duration short and human readable
+		// example: {{Duration .duration}} => 1d2h3m4s
+		"Duration": func(duration time.Duration) string {
+			return dhumanize.Duration(duration)
+		},
+		// Bytes formats a size in bytes human readable
+		// example: {{Bytes 82854982}} => 83 MB
+		"Bytes": func(size int) string {
+			return humanize.Bytes(uint64(size))
+		},
+		// DiscordTime formats a time to be used in embed timestamps
+		// example: {{DiscordTime .time}} => 2018-05-01T14:00:00Z
+		"DiscordTime": func(theTime time.Time) string {
+			return DiscordTime(theTime)
+		},
+		// Timestamp formats a time as a Discord timestamp, which will be displayed in the timezone and locale of the reader
+		// style is one of t, T, d, D, f, F, or R
+		// example: {{Timestamp .time "R"}} => <t:1525183200:R>
+		"Timestamp": func(theTime time.Time, style string) string {
+			return "<t:" + strconv.FormatInt(theTime.Unix(), 10) + ":" + style + ">"
+		},
+		// Emoji returns an emoji by name
+		// example: {{Emoji "robyulblush"}} => <:robyulblush:327206930437373952>
+		"Emoji": func(name string) string {
+			return emoji.Get(name)
+		},
+		// Truncate shortens a text to the given number of characters, adds … if the text has been shortened
+		// example: {{Truncate 5 "Hello World"}} => Hell…
+		"Truncate": func(length int, text string) string {
+			runes := []rune(text)
+			if len(runes) <= length || length <= 0 {
+				return text
+			}
+			return string(runes[:length-1]) + "…"
+		},
+		// Plural returns singular if count is 1, plural otherwise
+		// for translated plurals use Tfc, this is intended for nested values
+		// example: {{Plural 3 "apple" "apples"}} => apples
+		"Plural": func(count int, singular, plural string) string {
+			if count == 1 {
+				return singular
+			}
+			return plural
+		},
 	}
+
+	// the locale specific functions, by locale, see localeTranslationFuncs
+	localeTranslationFuncsCache      = make(map[string]template.FuncMap)
+	localeTranslationFuncsCacheMutex sync.RWMutex
 )
 
-// T returns the translation for the given message ID
-// Example: T("HelloWorld")
-func T(messageID string) (result string) {
-	if cache.GetLocalizationBundle() == nil {
-		return messageID
+// localeTranslationFuncs returns the functions to use in the template engine for a locale
+// contains all translationFuncs, and the functions formatting values for the locale
+func localeTranslationFuncs(locale string) (funcs template.FuncMap) {
+	localeTranslationFuncsCacheMutex.RLock()
+	funcs, ok := localeTranslationFuncsCache[locale]
+	localeTranslationFuncsCacheMutex.RUnlock()
+	if ok {
+		return funcs
 	}
 
-	// on panic return message ID
-	defer func() {
-		err := recover()
-		if err != nil {
-			cache.GetLogger().WithField("module", "translate").Errorln(err.(error).Error())
-			result = messageID
-		}
-	}()
-
-	translation, err := i18n.NewLocalizer(cache.GetLocalizationBundle(), "en").Localize(&i18n.LocalizeConfig{
-		MessageID: messageID,
-		Funcs:     translationFuncs,
-	})
+	tag, err := language.Parse(locale)
 	if err != nil {
-		if !strings.Contains(err.Error(), "not found") { // ignore message not found errors
-			cache.GetLogger().WithField("module", "translate").Errorln(err.(error).Error())
-		}
-		return messageID
+		tag = language.English
 	}
+	base, _ := tag.Base()
+	printer := message.NewPrinter(tag)
 
-	return emoji.Replace(translation)
-}
-
-// Tf returns the translation for the given message ID applying the fields
-// Example: Tf("HelloWorld", "key", "value")
-func Tf(messageID string, fields ...interface{}) (result string) {
-	if cache.GetLocalizationBundle() == nil {
-		return messageID
+	dateFormat, ok := localeDateFormats[base.String()]
+	if !ok {
+		dateFormat = localeDateFormats[DefaultLocale]
 	}
 
-	// on panic return message ID
-	defer func() {
-		err := recover()
-		if err != nil {
-			cache.GetLogger().WithField("module", "translate").Errorln(err.(error).Error())
-			result = messageID
-		}
-	}()
+	funcs = make(template.FuncMap, len(translationFuncs)+5)
+	for name, function := range translationFuncs {
+		funcs[name] = function
+	}
 
-	// create map out of fields
-	data := make(map[interface{}]interface{})
-	for i := range fields {
-		if i%2 == 0 && len(fields) > i+1 {
-			data[fields[i]] = fields[i+1]
+	// Number formats a number using the separators of the locale
+	// example: {{Number 1234567}} => 1,234,567 (en), 1.234.567 (de)
+	funcs["Number"] = func(number interface{}) string {
+		switch number.(type) {
+		case float32, float64:
+			return printer.Sprintf("%.2f", number)
 		}
+		return printer.Sprintf("%d", number)
+	}
+	// Ordinal formats a number as an ordinal number of the locale
+	// example: {{Ordinal 3}} => 3rd (en), 3. (de)
+	funcs["Ordinal"] = func(number int) string {
+		return localeOrdinal(base.String(), number)
+	}
+	// Date formats the date of a time in the format of the locale
+	// example: {{Date .time}} => 05/01/2018 (en), 01.05.2018 (de)
+	funcs["Date"] = func(theTime time.Time) string {
+		return theTime.Format(dateFormat[0])
+	}
+	// DateTime formats a time in the format of the locale
+	// example: {{DateTime .time}} => 05/01/2018 2:00 PM (en), 01.05.2018 14:00 (de)
+	funcs["DateTime"] = func(theTime time.Time) string {
+		return theTime.Format(dateFormat[0] + " " + dateFormat[1])
 	}
 
-	translation, err := i18n.NewLocalizer(cache.GetLocalizationBundle(), "en").Localize(&i18n.LocalizeConfig{
-		MessageID:    messageID,
-		TemplateData: data,
-		Funcs:        translationFuncs,
-	})
-	if err != nil {
-		if !strings.Contains(err.Error(), "not found") { // ignore message not found errors
-			cache.GetLogger().WithField("module", "translate").Errorln(err.(error).Error())
+	localeTranslationFuncsCacheMutex.Lock()
+	localeTranslationFuncsCache[locale] = funcs
+	localeTranslationFuncsCacheMutex.Unlock()
+
+	return funcs
+}
+
+// localeDateFormats contains the date and time layout of locales, by base language
+var localeDateFormats = map[string][2]string{
+	"en": {"01/02/2006", "3:04 PM"},
+	"de": {"02.01.2006", "15:04"},
+	"fr": {"02/01/2006", "15:04"},
+	"es": {"02/01/2006", "15:04"},
+	"it": {"02/01/2006", "15:04"},
+	"pt": {"02/01/2006", "15:04"},
+	"nl": {"02-01-2006", "15:04"},
+	"pl": {"02.01.2006", "15:04"},
+	"ru": {"02.01.2006", "15:04"},
+	"ko": {"2006. 01. 02.", "15:04"},
+	"ja": {"2006/01/02", "15:04"},
+	"zh": {"2006/01/02", "15:04"},
+}
+
+// localeOrdinal formats a number as an ordinal number, falls back to english for unknown languages
+func localeOrdinal(base string, number int) string {
+	switch base {
+	case "de", "pl", "cs", "da", "no", "nb", "fi", "tr":
+		return strconv.Itoa(number) + "."
+	case "fr":
+		if number == 1 {
+			return "1er"
 		}
-		return messageID
+		return strconv.Itoa(number) + "e"
+	case "es", "it", "pt":
+		return strconv.Itoa(number) + "º"
+	case "nl":
+		return strconv.Itoa(number) + "e"
+	case "ko":
+		return strconv.Itoa(number) + "번째"
+	case "ja":
+		return strconv.Itoa(number) + "番目"
+	case "zh":
+		return "第" + strconv.Itoa(number)
 	}
+	return humanize.Ordinal(number)
+}
 
-	return emoji.Replace(translation)
+// T returns the translation for the given message ID
+// Example: T("HelloWorld")
+func T(messageID string) (result string) {
+	return localize([]string{DefaultLocale}, messageID, nil)
+}
+
+// Tf returns the translation for the given message ID applying the fields
+// Example: Tf("HelloWorld", "key", "value")
+func Tf(messageID string, fields ...interface{}) (result string) {
+	return localize([]string{DefaultLocale}, messageID, nil, fields...)
 }
 
 // Tfc returns the translation for the given message ID applying the fields and pluralization count
 // Example: Tfc("HelloWorld", 3, "key", "value")
 func Tfc(messageID string, count int, fields ...interface{}) (result string) {
+	return localize([]string{DefaultLocale}, messageID, count, fields...)
+}
+
+// T returns the translation for the given message ID, the event variable is being set
+// uses the locale of the user, or of the guild, see EventContainer.Locales
+// Example: T("HelloWorld")
+func (event EventContainer) T(messageID string) (result string) {
+	return localize(event.Locales(), messageID, nil, "event", event)
+}
+
+// Tf returns the translation for the given message ID applying the fields, the event variable is being set
+// uses the locale of the user, or of the guild, see EventContainer.Locales
+// Example: Tf("HelloWorld", "key", "value")
+func (event EventContainer) Tf(messageID string, fields ...interface{}) (result string) {
+	return localize(event.Locales(), messageID, nil, append(fields, "event", event)...)
+}
+
+// Tfc returns the translation for the given message ID applying the fields and pluralization count, the event variable is being set
+// uses the locale of the user, or of the guild, see EventContainer.Locales
+// Example: Tfc("HelloWorld", 3, "key", "value")
+func (event EventContainer) Tfc(messageID string, count int, fields ...interface{}) (result string) {
+	return localize(event.Locales(), messageID, count, append(fields, "event", event)...)
+}
+
+// localize returns the translation for the given message ID in the first locale containing the message
+// locales	: the locales to try, by priority
+// pluralCount	: the pluralization count, nil if the message should not be pluralized
+func localize(locales []string, messageID string, pluralCount interface{}, fields ...interface{}) (result string) {
 	if cache.GetLocalizationBundle() == nil {
 		return messageID
 	}
@@ -152,11 +330,11 @@ func Tfc(messageID string, count int, fields ...interface{}) (result string) {
 		}
 	}
 
-	translation, err := i18n.NewLocalizer(cache.GetLocalizationBundle(), "en").Localize(&i18n.LocalizeConfig{
+	translation, err := i18n.NewLocalizer(cache.GetLocalizationBundle(), locales...).Localize(&i18n.LocalizeConfig{
 		MessageID:    messageID,
 		TemplateData: data,
-		PluralCount:  count,
-		Funcs:        translationFuncs,
+		PluralCount:  pluralCount,
+		Funcs:        localeTranslationFuncs(locales[0]),
 	})
 	if err != nil {
 		if !strings.Contains(err.Error(), "not found") { // ignore message not found errors
@@ -167,21 +345,3 @@ func Tfc(messageID string, count int, fields ...interface{}) (result string) {
 
 	return emoji.Replace(translation)
 }
-
-// T returns the translation for the given message ID, the event variable is being set
-// Example: T("HelloWorld")
-func (event EventContainer) T(messageID string) (result string) {
-	return Tf(messageID, "event", event)
-}
-
-// Tf returns the translation for the given message ID applying the fields, the event variable is being set
-// Example: Tf("HelloWorld", "key", "value")
-func (event EventContainer) Tf(messageID string, fields ...interface{}) (result string) {
-	return Tf(messageID, append(fields, "event", event)...)
-}
-
-// Tfc returns the translation for the given message ID applying the fields and pluralization count, the event variable is being set
-// Example: Tfc("HelloWorld", 3, "key", "value")
-func (event EventContainer) Tfc(messageID string, count int, fields ...interface{}) (result string) {
-	return Tfc(messageID, count, append(fields, "event", event)...)
-}
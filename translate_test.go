@@ -0,0 +1,138 @@
+package dhelpers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/bwmarrin/discordgo"
+	"github.com/json-iterator/go"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"golang.org/x/text/language"
+)
+
+func TestTranslationFuncs(t *testing.T) {
+	bundle := &i18n.Bundle{DefaultLanguage: language.English}
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	bundle.MustParseMessageFileBytes([]byte(`
+Mentions = "{{UserMention .user}} {{RoleMention .role}} {{ChannelMention .channel}}"
+Duration = "{{Duration .duration}}"
+Bytes = "{{Bytes .size}}"
+DiscordTime = "{{DiscordTime .time}}"
+Timestamp = "{{Timestamp .time \"R\"}}"
+Truncate = "{{Truncate 5 .text}}"
+TruncatePipe = "{{.text | Truncate 20}}"
+Plural = "{{.count}} {{Plural .count \"apple\" \"apples\"}}"
+Number = "{{Number .number}}"
+Float = "{{Number .float}}"
+Ordinal = "{{Ordinal .number}}"
+Date = "{{Date .time}}"
+DateTime = "{{DateTime .time}}"
+`), "active.en.toml")
+	cache.SetLocalizationBundle(bundle)
+
+	theTime := time.Date(2018, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		locales   []string
+		messageID string
+		fields    []interface{}
+		expected  string
+	}{
+		{[]string{"en"}, "Mentions", []interface{}{"user", "1", "role", "2", "channel", "3"}, "<@1> <@&2> <#3>"},
+		{[]string{"en"}, "Duration", []interface{}{"duration", 26*time.Hour + 3*time.Minute + 4*time.Second}, "1d2h3m4s"},
+		{[]string{"en"}, "Bytes", []interface{}{"size", 82854982}, "83 MB"},
+		{[]string{"en"}, "DiscordTime", []interface{}{"time", theTime}, "2018-05-01T14:00:00Z"},
+		{[]string{"en"}, "Timestamp", []interface{}{"time", theTime}, "<t:1525183200:R>"},
+		{[]string{"en"}, "Truncate", []interface{}{"text", "Hello World"}, "Hell…"},
+		{[]string{"en"}, "TruncatePipe", []interface{}{"text", "Hello World"}, "Hello World"},
+		{[]string{"en"}, "Plural", []interface{}{"count", 1}, "1 apple"},
+		{[]string{"en"}, "Plural", []interface{}{"count", 3}, "3 apples"},
+		{[]string{"en"}, "Number", []interface{}{"number", 1234567}, "1,234,567"},
+		{[]string{"de", "en"}, "Number", []interface{}{"number", 1234567}, "1.234.567"},
+		{[]string{"en"}, "Float", []interface{}{"float", 1234.5}, "1,234.50"},
+		{[]string{"de", "en"}, "Float", []interface{}{"float", 1234.5}, "1.234,50"},
+		{[]string{"en"}, "Ordinal", []interface{}{"number", 3}, "3rd"},
+		{[]string{"de", "en"}, "Ordinal", []interface{}{"number", 3}, "3."},
+		{[]string{"ko", "en"}, "Ordinal", []interface{}{"number", 3}, "3번째"},
+		{[]string{"en"}, "Date", []interface{}{"time", theTime}, "05/01/2018"},
+		{[]string{"de", "en"}, "Date", []interface{}{"time", theTime}, "01.05.2018"},
+		{[]string{"en"}, "DateTime", []interface{}{"time", theTime}, "05/01/2018 2:00 PM"},
+		{[]string{"de", "en"}, "DateTime", []interface{}{"time", theTime}, "01.05.2018 14:00"},
+	}
+
+	for _, test := range tests {
+		v := localize(test.locales, test.messageID, nil, test.fields...)
+		if v != test.expected {
+			t.Error("Expected ", test.expected, " for ", test.messageID, " in ", test.locales, ", got ", v)
+		}
+	}
+}
+
+// setStateObject stores an object in the shared state, keys as used by the state package
+func setStateObject(t *testing.T, key string, object interface{}) {
+	data, err := jsoniter.Marshal(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.GetRedisClient().Set(key, data, time.Minute).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTranslationFuncs_State(t *testing.T) {
+	bundle := &i18n.Bundle{DefaultLanguage: language.English}
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	bundle.MustParseMessageFileBytes([]byte(`
+UserName = "{{UserName .user}}"
+MemberName = "{{MemberName .guild .user}}"
+RoleName = "{{RoleName .guild .role}}"
+ChannelName = "{{ChannelName .channel}}"
+Emoji = "{{Emoji .emoji}}"
+`), "active.en.toml")
+	cache.SetLocalizationBundle(bundle)
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	guildID, userID, nickUserID, roleID, channelID := "guild"+suffix, "user"+suffix, "nick"+suffix, "role"+suffix, "channel"+suffix
+
+	setStateObject(t, "project-d:state:user-"+userID, &discordgo.User{ID: userID, Username: "Sekl"})
+	setStateObject(t, "project-d:state:guild-"+guildID+":member-"+userID, &discordgo.Member{
+		User: &discordgo.User{ID: userID, Username: "Sekl"},
+	})
+	setStateObject(t, "project-d:state:guild-"+guildID+":member-"+nickUserID, &discordgo.Member{
+		User: &discordgo.User{ID: nickUserID, Username: "Freak"}, Nick: "Nick",
+	})
+	setStateObject(t, "project-d:state:guild-"+guildID, &discordgo.Guild{
+		ID: guildID, Roles: []*discordgo.Role{{ID: roleID, Name: "Moderators"}},
+	})
+	setStateObject(t, "project-d:state:channel-"+channelID, &discordgo.Channel{ID: channelID, Name: "general"})
+
+	tests := []struct {
+		messageID string
+		fields    []interface{}
+		expected  string
+	}{
+		{"UserName", []interface{}{"user", userID}, "Sekl"},
+		{"UserName", []interface{}{"user", "unknown" + suffix}, "unknown" + suffix},
+		{"MemberName", []interface{}{"guild", guildID, "user", userID}, "Sekl"},
+		{"MemberName", []interface{}{"guild", guildID, "user", nickUserID}, "Nick"},
+		{"MemberName", []interface{}{"guild", guildID, "user", "unknown" + suffix}, "unknown" + suffix},
+		{"RoleName", []interface{}{"guild", guildID, "role", roleID}, "Moderators"},
+		{"RoleName", []interface{}{"guild", guildID, "role", "unknown" + suffix}, "unknown" + suffix},
+		{"ChannelName", []interface{}{"channel", channelID}, "general"},
+		{"ChannelName", []interface{}{"channel", "unknown" + suffix}, "unknown" + suffix},
+		{"Emoji", []interface{}{"emoji", "robyulblush"}, "<:robyulblush:327206930437373952>"},
+		{"Emoji", []interface{}{"emoji", ":robyulblush:"}, "<:robyulblush:327206930437373952>"},
+		{"Emoji", []interface{}{"emoji", "unknown"}, "unknown"},
+	}
+
+	for _, test := range tests {
+		v := localize([]string{DefaultLocale}, test.messageID, nil, test.fields...)
+		if v != test.expected {
+			t.Error("Expected ", test.expected, " for ", test.messageID, " ", test.fields, ", got ", v)
+		}
+	}
+}
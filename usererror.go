@@ -0,0 +1,149 @@
+package dhelpers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/bwmarrin/discordgo"
+	"gitlab.com/Cacophony/dhelpers/state"
+)
+
+// defines the codes of the built in user errors
+const (
+	UserErrorCodeUnknown            = "unknown"
+	UserErrorCodeMissingPermissions = "discord-missing-permissions"
+	UserErrorCodeMissingAccess      = "discord-missing-access"
+	UserErrorCodeCannotMessageUser  = "discord-cannot-message-user"
+	UserErrorCodeNotFound           = "state-not-found"
+	UserErrorCodeWrongServer        = "state-wrong-server"
+	UserErrorCodeWrongType          = "state-wrong-type"
+)
+
+// userErrorFallbacks contains the english messages of the built in user errors, if the message IDs have not been translated
+var userErrorFallbacks = map[string]string{
+	"dhelpers.errors.unknown":             "**Something went wrong.** I sent our top people to fix the issue as soon as possible.",
+	"dhelpers.errors.missing-permissions": "I am missing permissions to do that, please check my roles and the channel permissions.",
+	"dhelpers.errors.missing-access":      "I am not allowed to access that channel.",
+	"dhelpers.errors.cannot-message-user": "I am unable to send you direct messages, please check your privacy settings.",
+	"dhelpers.errors.not-found":           "I could not find what you were looking for.",
+	"dhelpers.errors.wrong-server":        "That is on a different server.",
+	"dhelpers.errors.wrong-type":          "That is not the right kind of channel.",
+}
+
+// UserError is an error which will be shown to the user translated, with a stable code
+type UserError struct {
+	Code      string        // a stable code, users can search for
+	MessageID string        // the message ID of the translation
+	Fields    []interface{} // the fields for the translation
+	Report    bool          // if true the error will be reported to developers
+	Err       error         // the underlying error, can be nil
+}
+
+// NewUserError creates an UserError which will not be reported
+// example: NewUserError("lastfm-not-linked", "lastfm.not-linked", "prefix", "/")
+func NewUserError(code, messageID string, fields ...interface{}) *UserError {
+	return &UserError{
+		Code:      code,
+		MessageID: messageID,
+		Fields:    fields,
+	}
+}
+
+// Error returns the code and the underlying error
+func (e *UserError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Err.Error()
+	}
+	return e.Code
+}
+
+// Wrap returns a copy of the UserError with the underlying error set, marked to be reported
+// the receiver is not modified, so shared errors like var ErrX = NewUserError(…) can be wrapped concurrently
+func (e *UserError) Wrap(err error) *UserError {
+	wrapped := *e
+	wrapped.Err = err
+	wrapped.Report = true
+	return &wrapped
+}
+
+// AsUserError returns the UserError in the chain of wrapped errors
+// permission errors, and state errors, are converted into UserErrors
+func AsUserError(err error) (userError *UserError, ok bool) {
+	type causer interface {
+		Cause() error
+	}
+
+	for err != nil {
+		if userError, ok = err.(*UserError); ok {
+			return userError, true
+		}
+
+		cause, isCauser := err.(causer)
+		if !isCauser {
+			break
+		}
+		err = cause.Cause()
+	}
+
+	return builtinUserError(err)
+}
+
+// builtinUserError maps discord permission errors, and state errors, to user errors
+func builtinUserError(err error) (userError *UserError, ok bool) {
+	if errD, isRESTError := err.(*discordgo.RESTError); isRESTError && errD.Message != nil {
+		switch errD.Message.Code {
+		case discordgo.ErrCodeMissingPermissions:
+			return &UserError{Code: UserErrorCodeMissingPermissions, MessageID: "dhelpers.errors.missing-permissions", Err: err}, true
+		case discordgo.ErrCodeMissingAccess:
+			return &UserError{Code: UserErrorCodeMissingAccess, MessageID: "dhelpers.errors.missing-access", Err: err}, true
+		case discordgo.ErrCodeCannotSendMessagesToThisUser:
+			return &UserError{Code: UserErrorCodeCannotMessageUser, MessageID: "dhelpers.errors.cannot-message-user", Err: err}, true
+		}
+	}
+
+	switch err {
+	case state.ErrStateNotFound:
+		return &UserError{Code: UserErrorCodeNotFound, MessageID: "dhelpers.errors.not-found", Err: err}, true
+	case state.ErrTargetWrongServer:
+		return &UserError{Code: UserErrorCodeWrongServer, MessageID: "dhelpers.errors.wrong-server", Err: err}, true
+	case state.ErrTargetWrongType:
+		return &UserError{Code: UserErrorCodeWrongType, MessageID: "dhelpers.errors.wrong-type", Err: err}, true
+	}
+
+	return nil, false
+}
+
+// UserErrorMessage returns the translated message for an error, including the code and reference ID
+// unknown errors will be shown as dhelpers.errors.unknown
+// referenceID	: the reference ID of the error report, can be empty
+func (event EventContainer) UserErrorMessage(err error, referenceID string) (message string) {
+	userError, ok := AsUserError(err)
+	if !ok {
+		userError = &UserError{Code: UserErrorCodeUnknown, MessageID: "dhelpers.errors.unknown", Report: true}
+	}
+
+	message = event.Tf(userError.MessageID, append(userError.Fields, "code", userError.Code, "reference", referenceID)...)
+	if message == userError.MessageID {
+		if fallback, ok := userErrorFallbacks[userError.MessageID]; ok {
+			message = fallback
+		}
+	}
+
+	if userError.Code != UserErrorCodeUnknown {
+		message += "\nError code: `" + userError.Code + "`"
+	}
+	if referenceID != "" {
+		message += "\nReference: `" + referenceID + "`"
+	}
+	return message
+}
+
+// newReferenceID returns a short random ID to find error reports
+func newReferenceID() string {
+	data := make([]byte, 4)
+	_, err := rand.Read(data)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(data)
+}
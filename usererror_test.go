@@ -0,0 +1,76 @@
+package dhelpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/bwmarrin/discordgo"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/pkg/errors"
+	"gitlab.com/Cacophony/dhelpers/cache"
+	"gitlab.com/Cacophony/dhelpers/state"
+	"golang.org/x/text/language"
+)
+
+func TestAsUserError(t *testing.T) {
+	userError := NewUserError("test-code", "test.message")
+	v, ok := AsUserError(errors.Wrap(userError, "wrapped"))
+	if !ok || v != userError {
+		t.Error("Expected wrapped user error, got ", v)
+	}
+	if isExpectedErr(userError) != true {
+		t.Error("Expected user error to be expected")
+	}
+	wrapped := userError.Wrap(errors.New("cause"))
+	if isExpectedErr(wrapped) != false || wrapped.Code != "test-code" {
+		t.Error("Expected wrapped user error to be reported, got ", wrapped)
+	}
+	if userError.Err != nil || userError.Report {
+		t.Error("Expected shared user error to not be modified by Wrap, got ", userError)
+	}
+
+	v, ok = AsUserError(errors.WithStack(state.ErrStateNotFound))
+	if !ok || v.Code != UserErrorCodeNotFound {
+		t.Error("Expected state error to be converted, got ", v)
+	}
+	v, ok = AsUserError(&discordgo.RESTError{Message: &discordgo.APIErrorMessage{Code: discordgo.ErrCodeMissingPermissions}})
+	if !ok || v.Code != UserErrorCodeMissingPermissions {
+		t.Error("Expected permission error to be converted, got ", v)
+	}
+
+	_, ok = AsUserError(errors.New("unknown"))
+	if ok {
+		t.Error("Expected unknown error to not be an user error")
+	}
+}
+
+func TestUserErrorMessage(t *testing.T) {
+	bundle := &i18n.Bundle{DefaultLanguage: language.English}
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	bundle.MustParseMessageFileBytes([]byte(`
+"test.not-linked" = "You have to link your account first, use {{.prefix}}link."
+`), "active.en.toml")
+	cache.SetLocalizationBundle(bundle)
+
+	event := EventContainer{}
+
+	v := event.UserErrorMessage(NewUserError("not-linked", "test.not-linked", "prefix", "/"), "")
+	if v != "You have to link your account first, use /link.\nError code: `not-linked`" {
+		t.Error("Expected translated message with code, got ", v)
+	}
+
+	// fallback to english if not translated
+	v = event.UserErrorMessage(state.ErrStateNotFound, "")
+	if !strings.HasPrefix(v, userErrorFallbacks["dhelpers.errors.not-found"]) {
+		t.Error("Expected fallback message, got ", v)
+	}
+
+	v = event.UserErrorMessage(errors.New("internal details"), "abcd1234")
+	if strings.Contains(v, "internal details") {
+		t.Error("Expected internal error to be hidden, got ", v)
+	}
+	if !strings.HasSuffix(v, "Reference: `abcd1234`") {
+		t.Error("Expected reference ID, got ", v)
+	}
+}
@@ -2,6 +2,7 @@ package dhelpers
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/bsm/redis-lock"
@@ -17,7 +18,17 @@ type Job struct {
 	Cron string
 	// AtLaunch if set to true will start the Job at launch
 	AtLaunch bool
-	Job      func()
+	// Job is the function to run, use Run for jobs which should stop when they lose their lock
+	// the Scheduler does not lock Job functions, they have to use JobStart themselves to run on only one instance
+	Job func()
+	// Run is the function to run if set, the Scheduler holds the Job lock while it runs, do not call JobStart inside
+	// the context is cancelled if the Job loses its lock or the Scheduler stops
+	Run func(ctx context.Context) error
+	// HealthcheckURL is pinged after each run of Run by the Scheduler, with /fail appended if the run failed
+	// Job functions are not reported to the healthcheck or the job history, use JobFinishSuccess and JobFinishFailure
+	HealthcheckURL string
+	// LockTimeout is the timeout of the Job lock, the Scheduler renews the lock while the Job runs, default one minute
+	LockTimeout time.Duration
 }
 
 func jobLockKey(jobName string) (key string) {
@@ -50,6 +61,18 @@ func JobFinishSuccess(healthcheckURL string) error {
 	return nil
 }
 
+// JobFinishFailure calls the fail endpoint of the healthcheck if exists
+func JobFinishFailure(healthcheckURL string) error {
+	if healthcheckURL != "" {
+		_, err := net.Get(strings.TrimSuffix(healthcheckURL, "/") + "/fail")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // JobErrorHandler handles errors at jobs, defer to this: defer JobErrorHandler(jobName)
 func JobErrorHandler(jobName string) {
 	err := recover()